@@ -15,29 +15,535 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/admin/dlq": {
+            "get": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Возвращает сообщения из DLQ с разобранными заголовками и содержимым",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Список сообщений DLQ",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Этап ошибки (unmarshal, validation, db)",
+                        "name": "stage",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Подстрока текста ошибки",
+                        "name": "error",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Нарушенное правило валидации (например, required, goods_total)",
+                        "name": "rule",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало интервала (RFC3339)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Конец интервала (RFC3339)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 100,
+                        "description": "Максимальное число сообщений",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Сообщения DLQ",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/kafka.DLQMessage"
+                            }
+                        },
+                        "headers": {
+                            "X-DLQ-Scan-Stopped-After": {
+                                "type": "string",
+                                "description": "Чтение DLQ прервано после этого сообщения, список неполный"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные параметры фильтра",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет доступа",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/admin/dlq/replay": {
+            "post": {
+                "security": [
+                    {
+                        "BearerAuth": []
+                    }
+                ],
+                "description": "Переотправляет выбранные или все подходящие под фильтр сообщения в основной топик или напрямую в хранилище",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "admin"
+                ],
+                "summary": "Переотправка сообщений DLQ",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Этап ошибки (unmarshal, validation, db)",
+                        "name": "stage",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Подстрока текста ошибки",
+                        "name": "error",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Нарушенное правило валидации (например, required, goods_total)",
+                        "name": "rule",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Начало интервала (RFC3339)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Конец интервала (RFC3339)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "description": "Параметры переотправки",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/kafka.ReplayRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Результаты по сообщениям",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/kafka.ReplayResult"
+                            }
+                        },
+                        "headers": {
+                            "X-DLQ-Scan-Stopped-After": {
+                                "type": "string",
+                                "description": "Чтение DLQ прервано после этого сообщения, переотправлена только часть"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный запрос",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Нет доступа",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/healthz": {
             "get": {
-                "description": "Возвращает статус 200 OK и тело \"OK\", если сервер работает",
+                "description": "Без verbose отвечает как /readyz; с verbose возвращает отчет по каждой проверке",
+                "produces": [
+                    "text/plain",
+                    "application/json"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Проверка работоспособности сервера",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "Вернуть отчет по каждой проверке",
+                        "name": "verbose",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Все обязательные проверки пройдены",
+                        "schema": {
+                            "$ref": "#/definitions/health.Report"
+                        }
+                    },
+                    "503": {
+                        "description": "Есть проваленные обязательные проверки",
+                        "schema": {
+                            "$ref": "#/definitions/health.Report"
+                        }
+                    }
+                }
+            }
+        },
+        "/livez": {
+            "get": {
+                "description": "Возвращает 200 OK, если процесс работоспособен, и 503 со списком проваленных проверок, если его нужно перезапустить",
                 "produces": [
                     "text/plain"
                 ],
                 "tags": [
                     "health"
                 ],
-                "summary": "Проверка работоспособности сервера",
+                "summary": "Проба liveness",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Проваленные проверки",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/order/{order_uid}": {
+            "get": {
+                "description": "Возвращает данные заказа по его уникальному идентификатору",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Получить заказ по ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Уникальный идентификатор заказа",
+                        "name": "order_uid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Данные заказа",
+                        "schema": {
+                            "$ref": "#/definitions/models.Order"
+                        }
+                    },
+                    "400": {
+                        "description": "Отсутствует параметр ID",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Заказ не найден",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "База данных недоступна",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/order/{order_uid}/diff": {
+            "get": {
+                "description": "Возвращает список изменившихся полей между версиями from и to",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Сравнение версий заказа",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Уникальный идентификатор заказа",
+                        "name": "order_uid",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Номер исходной версии",
+                        "name": "from",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Номер сравниваемой версии",
+                        "name": "to",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Изменения",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.OrderDiff"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные параметры",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Версия не найдена",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "История недоступна",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/order/{order_uid}/history": {
+            "get": {
+                "description": "Возвращает все принятые версии заказа с источником в Kafka и контрольной суммой",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "История версий заказа",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Уникальный идентификатор заказа",
+                        "name": "order_uid",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Версии заказа по возрастанию номера",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/repository.OrderVersion"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректный идентификатор",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Заказ не найден",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "История недоступна",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/orders": {
+            "get": {
+                "description": "Возвращает заказы от новых к старым с курсорной пагинацией по (date_created, order_uid)",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "orders"
+                ],
+                "summary": "Список заказов",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Идентификатор покупателя",
+                        "name": "customer_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Трек-номер",
+                        "name": "track_number",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Служба доставки",
+                        "name": "delivery_service",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Точка входа",
+                        "name": "entry",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Локаль",
+                        "name": "locale",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Валюта оплаты",
+                        "name": "currency",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Создан не раньше (RFC3339)",
+                        "name": "created_from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Создан раньше (RFC3339)",
+                        "name": "created_to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Курсор следующей страницы из next_cursor",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "default": 50,
+                        "description": "Размер страницы (не больше 500)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
-                        "description": "OK",
+                        "description": "Страница заказов",
+                        "schema": {
+                            "$ref": "#/definitions/repository.OrderPage"
+                        }
+                    },
+                    "400": {
+                        "description": "Некорректные параметры запроса",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Внутренняя ошибка сервера",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "База данных недоступна",
                         "schema": {
                             "type": "string"
                         }
                     }
                 }
-            }
-        },
-        "/order/{order_uid}": {
-            "get": {
-                "description": "Возвращает данные заказа по его уникальному идентификатору",
+            },
+            "post": {
+                "description": "Принимает один заказ или массив заказов, валидирует и сохраняет их так же, как Kafka-консьюмер.\nВозвращает итог по каждому заказу. Повтор запроса с тем же заголовком Idempotency-Key\nне создает новых версий: уже принятые заказы получают статус duplicate.",
                 "consumes": [
                     "application/json"
                 ],
@@ -47,37 +553,83 @@ const docTemplate = `{
                 "tags": [
                     "orders"
                 ],
-                "summary": "Получить заказ по ID",
+                "summary": "Принять заказы",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Уникальный идентификатор заказа",
-                        "name": "order_uid",
-                        "in": "path",
-                        "required": true
+                        "description": "Ключ идемпотентности запроса (до 255 символов)",
+                        "name": "Idempotency-Key",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Заказ или массив заказов",
+                        "name": "orders",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/models.Order"
+                        }
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Данные заказа",
+                        "description": "Итоги по заказам",
                         "schema": {
-                            "$ref": "#/definitions/models.Order"
+                            "$ref": "#/definitions/handlers.IngestResponse"
                         }
                     },
                     "400": {
-                        "description": "Отсутствует параметр ID",
+                        "description": "Некорректный запрос",
                         "schema": {
                             "type": "string"
                         }
                     },
-                    "404": {
-                        "description": "Заказ не найден",
+                    "413": {
+                        "description": "Слишком большой запрос",
                         "schema": {
                             "type": "string"
                         }
                     },
+                    "422": {
+                        "description": "Ни один заказ не прошел валидацию",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.IngestResponse"
+                        }
+                    },
                     "500": {
-                        "description": "Внутренняя ошибка сервера",
+                        "description": "Не удалось сохранить заказы",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.IngestResponse"
+                        }
+                    },
+                    "503": {
+                        "description": "Хранилище недоступно",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.IngestResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/readyz": {
+            "get": {
+                "description": "Возвращает 200 OK, если сервис готов обслуживать запросы: БД и Kafka доступны, кеш загружен",
+                "produces": [
+                    "text/plain"
+                ],
+                "tags": [
+                    "health"
+                ],
+                "summary": "Проба readiness",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Проваленные проверки",
                         "schema": {
                             "type": "string"
                         }
@@ -87,6 +639,245 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "diff.Change": {
+            "type": "object",
+            "properties": {
+                "from": {},
+                "path": {
+                    "type": "string"
+                },
+                "to": {}
+            }
+        },
+        "handlers.IngestResponse": {
+            "type": "object",
+            "properties": {
+                "results": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handlers.IngestResult"
+                    }
+                }
+            }
+        },
+        "handlers.IngestResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "index": {
+                    "type": "integer"
+                },
+                "order_uid": {
+                    "type": "string"
+                },
+                "status": {
+                    "$ref": "#/definitions/ingest.Status"
+                },
+                "violations": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/validation.Violation"
+                    }
+                },
+                "warnings": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/validation.Violation"
+                    }
+                }
+            }
+        },
+        "handlers.OrderDiff": {
+            "type": "object",
+            "properties": {
+                "changes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/diff.Change"
+                    }
+                },
+                "from": {
+                    "type": "integer"
+                },
+                "order_uid": {
+                    "type": "string"
+                },
+                "to": {
+                    "type": "integer"
+                }
+            }
+        },
+        "health.Kind": {
+            "type": "string",
+            "enum": [
+                "liveness",
+                "readiness",
+                "optional"
+            ],
+            "x-enum-varnames": [
+                "Liveness",
+                "Readiness",
+                "Optional"
+            ]
+        },
+        "health.Report": {
+            "type": "object",
+            "properties": {
+                "checks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/health.Result"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "health.Result": {
+            "type": "object",
+            "properties": {
+                "duration": {
+                    "type": "string"
+                },
+                "error": {
+                    "type": "string"
+                },
+                "kind": {
+                    "$ref": "#/definitions/health.Kind"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "ingest.Status": {
+            "type": "string",
+            "enum": [
+                "stored",
+                "superseded",
+                "stale",
+                "duplicate",
+                "invalid",
+                "failed"
+            ],
+            "x-enum-varnames": [
+                "StatusStored",
+                "StatusSuperseded",
+                "StatusStale",
+                "StatusDuplicate",
+                "StatusInvalid",
+                "StatusFailed"
+            ]
+        },
+        "kafka.DLQMessage": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "failed_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "offset": {
+                    "type": "integer"
+                },
+                "partition": {
+                    "type": "integer"
+                },
+                "payload": {
+                    "type": "object"
+                },
+                "raw_payload": {
+                    "type": "string"
+                },
+                "replay_attempts": {
+                    "type": "integer"
+                },
+                "source_offset": {
+                    "type": "integer"
+                },
+                "source_partition": {
+                    "type": "integer"
+                },
+                "source_topic": {
+                    "type": "string"
+                },
+                "stage": {
+                    "type": "string"
+                },
+                "violations": {
+                    "description": "Violations — нарушения валидации из заголовка dlq_violations.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/validation.Violation"
+                    }
+                }
+            }
+        },
+        "kafka.ReplayRequest": {
+            "type": "object",
+            "properties": {
+                "all": {
+                    "type": "boolean"
+                },
+                "force": {
+                    "type": "boolean"
+                },
+                "ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "target": {
+                    "$ref": "#/definitions/kafka.ReplayTarget"
+                }
+            }
+        },
+        "kafka.ReplayResult": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "violations": {
+                    "description": "Violations — нарушения валидации, если заказ не прошел проверку при переотправке в хранилище.",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/validation.Violation"
+                    }
+                }
+            }
+        },
+        "kafka.ReplayTarget": {
+            "type": "string",
+            "enum": [
+                "topic",
+                "store"
+            ],
+            "x-enum-varnames": [
+                "ReplayToTopic",
+                "ReplayToStore"
+            ]
+        },
         "models.Delivery": {
             "type": "object",
             "properties": {
@@ -198,6 +989,10 @@ const docTemplate = `{
                 },
                 "track_number": {
                     "type": "string"
+                },
+                "updated_at": {
+                    "description": "UpdatedAt — время изменения заказа у источника. Более старые версии не перезаписывают\nболее новые; если поле не задано, используется DateCreated.",
+                    "type": "string"
                 }
             }
         },
@@ -235,6 +1030,90 @@ const docTemplate = `{
                     "type": "string"
                 }
             }
+        },
+        "repository.OrderPage": {
+            "type": "object",
+            "properties": {
+                "next_cursor": {
+                    "type": "string"
+                },
+                "orders": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Order"
+                    }
+                }
+            }
+        },
+        "repository.OrderVersion": {
+            "type": "object",
+            "properties": {
+                "checksum": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "order": {
+                    "$ref": "#/definitions/models.Order"
+                },
+                "order_uid": {
+                    "type": "string"
+                },
+                "source": {
+                    "$ref": "#/definitions/repository.Source"
+                },
+                "version": {
+                    "type": "integer"
+                }
+            }
+        },
+        "repository.Source": {
+            "type": "object",
+            "properties": {
+                "idempotency_key": {
+                    "type": "string"
+                },
+                "offset": {
+                    "type": "integer"
+                },
+                "partition": {
+                    "type": "integer"
+                },
+                "topic": {
+                    "type": "string"
+                }
+            }
+        },
+        "validation.Violation": {
+            "type": "object",
+            "properties": {
+                "field": {
+                    "description": "Field — путь к полю в JSON заказа, например items[2].nm_id.",
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "param": {
+                    "description": "Param — параметр правила; для правил согласованности сумм — ожидаемое значение.",
+                    "type": "string"
+                },
+                "rule": {
+                    "description": "Rule — тег правила валидатора (required, phone_ru) или правило согласованности сумм.",
+                    "type": "string"
+                },
+                "value": {
+                    "description": "Value — значение поля; персональные данные маскируются."
+                }
+            }
+        }
+    },
+    "securityDefinitions": {
+        "BearerAuth": {
+            "type": "apiKey",
+            "name": "Authorization",
+            "in": "header"
         }
     }
 }`
@@ -0,0 +1,196 @@
+// Package main содержит утилиту просмотра и переотправки сообщений из DLQ.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/config"
+	"github.com/RoGogDBD/wb/internal/config/db"
+	"github.com/RoGogDBD/wb/internal/ingest"
+	"github.com/RoGogDBD/wb/internal/kafka"
+	"github.com/RoGogDBD/wb/internal/logging"
+	"github.com/RoGogDBD/wb/internal/repository"
+	"github.com/RoGogDBD/wb/internal/validation"
+)
+
+const usage = `Использование:
+  dlq list   [-stage STAGE] [-error TEXT] [-rule RULE] [-from RFC3339] [-to RFC3339] [-limit N]
+  dlq replay (-ids P:O,P:O | -all) [-target topic|store] [-force] [фильтры list]
+
+Настройки Kafka и БД берутся из config.yaml (или из CONFIG_PATH) и переменных окружения WB_*.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "list":
+		err = runList(ctx, os.Args[2:])
+	case "replay":
+		err = runReplay(ctx, os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		slog.Error("dlq command failed", logging.Err(err))
+		os.Exit(1)
+	}
+}
+
+// loadConfig загружает конфигурацию и настраивает по ней логирование.
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err := logging.Setup(cfg.Logging.Format, cfg.Logging.Level); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func runList(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	filter := bindFilterFlags(fs)
+	limit := fs.Int("limit", 0, "Maximum number of messages (0 — all)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	f, err := filter()
+	if err != nil {
+		return err
+	}
+	f.Limit = *limit
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	dlq := kafka.NewDLQ(cfg.Kafka, nil)
+	defer closeDLQ(dlq)
+
+	// при прерванном чтении печатаются сообщения, найденные до остановки
+	msgs, err := dlq.List(ctx, f)
+	if printErr := printNDJSON(msgs); printErr != nil {
+		return printErr
+	}
+	return err
+}
+
+func runReplay(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	filter := bindFilterFlags(fs)
+	ids := fs.String("ids", "", "Comma-separated message ids (partition:offset)")
+	all := fs.Bool("all", false, "Replay all messages matching the filter")
+	target := fs.String("target", string(kafka.ReplayToTopic), "Replay target: topic or store")
+	force := fs.Bool("force", false, "Replay messages that reached the replay limit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	f, err := filter()
+	if err != nil {
+		return err
+	}
+
+	req := kafka.ReplayRequest{
+		All:    *all,
+		Target: kafka.ReplayTarget(*target),
+		Force:  *force,
+		Filter: f,
+	}
+	if *ids != "" {
+		req.IDs = strings.Split(*ids, ",")
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	var pipeline *ingest.Pipeline
+	if req.Target == kafka.ReplayToStore {
+		if cfg.Database.Driver != config.DriverPostgres {
+			return fmt.Errorf("target store requires database.driver %q", config.DriverPostgres)
+		}
+		pool, poolMetrics, err := db.NewPool(ctx, cfg.Database.DSN)
+		if err != nil {
+			return err
+		}
+		defer pool.Close()
+		if poolMetrics != nil {
+			defer poolMetrics.Unregister()
+		}
+		validate, err := validation.NewOrderValidator(cfg.Validation.Rules)
+		if err != nil {
+			return err
+		}
+		pipeline = ingest.NewPipeline(cfg.Kafka, validate, repository.NewPostgresStorage(pool), nil)
+	}
+
+	dlq := kafka.NewDLQ(cfg.Kafka, pipeline)
+	defer closeDLQ(dlq)
+
+	results, err := dlq.Replay(ctx, req)
+	if printErr := printNDJSON(results); printErr != nil {
+		return printErr
+	}
+	return err
+}
+
+// bindFilterFlags регистрирует флаги фильтра и возвращает функцию их разбора.
+func bindFilterFlags(fs *flag.FlagSet) func() (kafka.DLQFilter, error) {
+	stage := fs.String("stage", "", "Failure stage: unmarshal, validation or db")
+	errText := fs.String("error", "", "Substring of the failure error")
+	rule := fs.String("rule", "", "Violated validation rule, e.g. required or goods_total")
+	from := fs.String("from", "", "Failed at or after (RFC3339)")
+	to := fs.String("to", "", "Failed at or before (RFC3339)")
+
+	return func() (kafka.DLQFilter, error) {
+		f := kafka.DLQFilter{Stage: *stage, ErrorContains: *errText, Rule: *rule}
+		var err error
+		if *from != "" {
+			if f.From, err = time.Parse(time.RFC3339, *from); err != nil {
+				return f, fmt.Errorf("invalid -from: %w", err)
+			}
+		}
+		if *to != "" {
+			if f.To, err = time.Parse(time.RFC3339, *to); err != nil {
+				return f, fmt.Errorf("invalid -to: %w", err)
+			}
+		}
+		return f, nil
+	}
+}
+
+func printNDJSON[T any](items []T) error {
+	enc := json.NewEncoder(os.Stdout)
+	for _, item := range items {
+		if err := enc.Encode(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func closeDLQ(dlq *kafka.DLQ) {
+	if err := dlq.Close(); err != nil {
+		slog.Warn("dlq close error", logging.Err(err))
+	}
+}
@@ -0,0 +1,264 @@
+// Package main содержит утилиту массового импорта и экспорта заказов в формате NDJSON.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/config"
+	"github.com/RoGogDBD/wb/internal/config/db"
+	"github.com/RoGogDBD/wb/internal/ingest"
+	"github.com/RoGogDBD/wb/internal/logging"
+	"github.com/RoGogDBD/wb/internal/repository"
+	"github.com/RoGogDBD/wb/internal/validation"
+)
+
+const usage = `Использование:
+  orderctl import [-file PATH] [-workers N] [-batch N] [-checkpoint PATH] [-key KEY]
+  orderctl export [-from RFC3339] [-to RFC3339] [-customer ID] [-out PATH]
+
+Настройки БД, валидации и повторов записи берутся из config.yaml (или из CONFIG_PATH) и переменных окружения WB_*.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "import":
+		err = runImport(ctx, os.Args[2:])
+	case "export":
+		err = runExport(ctx, os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		slog.Error("orderctl command failed", logging.Err(err))
+		os.Exit(1)
+	}
+}
+
+func runImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	file := fs.String("file", "-", "NDJSON file with orders, - for stdin")
+	workers := fs.Int("workers", 4, "Number of batches stored concurrently")
+	batch := fs.Int("batch", 100, "Number of lines per batch")
+	checkpointPath := fs.String("checkpoint", "", "Checkpoint file to resume an interrupted import")
+	key := fs.String("key", "", "Idempotency key: lines already imported with the same key are skipped")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	source := *file
+	in := io.Reader(os.Stdin)
+	if source != "-" {
+		f, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				slog.Warn("input close error", logging.Err(err))
+			}
+		}()
+		in = f
+		if source, err = filepath.Abs(source); err != nil {
+			return err
+		}
+	}
+
+	var skip int64
+	var saveCheckpoint func(int64) error
+	if *checkpointPath != "" {
+		cp, err := loadCheckpoint(*checkpointPath, source)
+		if err != nil {
+			return err
+		}
+		skip = cp.Lines
+		saveCheckpoint = func(lines int64) error {
+			return writeCheckpoint(*checkpointPath, checkpoint{File: source, Lines: lines})
+		}
+		if skip > 0 {
+			slog.Info("resuming import", "file", source, "after_line", skip)
+		}
+	}
+
+	cfg, store, closeStore, err := openStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+	validate, err := validation.NewOrderValidator(cfg.Validation.Rules)
+	if err != nil {
+		return err
+	}
+
+	pipeline := ingest.NewPipeline(cfg.Kafka, validate, store, nil)
+	stats, err := pipeline.Import(ctx, in, ingest.ImportOptions{
+		Workers:        *workers,
+		BatchSize:      *batch,
+		SkipLines:      skip,
+		IdempotencyKey: *key,
+		Checkpoint:     saveCheckpoint,
+	})
+	if printErr := json.NewEncoder(os.Stdout).Encode(stats); printErr != nil {
+		return printErr
+	}
+	if err != nil {
+		return err
+	}
+	if failed := stats.Statuses[ingest.StatusFailed]; failed > 0 {
+		return fmt.Errorf("%d orders failed to store; rerun with the same checkpoint to retry them", failed)
+	}
+	return nil
+}
+
+func runExport(ctx context.Context, args []string) (err error) {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	from := fs.String("from", "", "Created at or after (RFC3339)")
+	to := fs.String("to", "", "Created before (RFC3339)")
+	customer := fs.String("customer", "", "Customer id")
+	outPath := fs.String("out", "-", "Output file, - for stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	filter := repository.OrderFilter{CustomerID: *customer, Limit: repository.MaxListLimit}
+	if *from != "" {
+		if filter.CreatedFrom, err = time.Parse(time.RFC3339, *from); err != nil {
+			return fmt.Errorf("invalid -from: %w", err)
+		}
+	}
+	if *to != "" {
+		if filter.CreatedTo, err = time.Parse(time.RFC3339, *to); err != nil {
+			return fmt.Errorf("invalid -to: %w", err)
+		}
+	}
+
+	_, store, closeStore, err := openStore(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	out := io.Writer(os.Stdout)
+	if *outPath != "-" {
+		f, err := os.Create(*outPath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := f.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	enc := json.NewEncoder(w)
+
+	exported := 0
+	for {
+		page, err := store.ListOrders(ctx, filter)
+		if err != nil {
+			return err
+		}
+		for i := range page.Orders {
+			if err := enc.Encode(&page.Orders[i]); err != nil {
+				return err
+			}
+		}
+		exported += len(page.Orders)
+		if page.NextCursor == "" {
+			break
+		}
+		filter.Cursor = page.NextCursor
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	slog.Info("export finished", "orders", exported)
+	return nil
+}
+
+// openStore загружает конфигурацию и подключается к PostgreSQL.
+func openStore(ctx context.Context) (*config.Config, repository.OrderStore, func(), error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := logging.Setup(cfg.Logging.Format, cfg.Logging.Level); err != nil {
+		return nil, nil, nil, err
+	}
+	if cfg.Database.Driver != config.DriverPostgres {
+		return nil, nil, nil, fmt.Errorf("orderctl requires database.driver %q", config.DriverPostgres)
+	}
+	pool, poolMetrics, err := db.NewPool(ctx, cfg.Database.DSN)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	closeStore := func() {
+		if poolMetrics != nil {
+			_ = poolMetrics.Unregister()
+		}
+		pool.Close()
+	}
+	return cfg, repository.NewPostgresStorage(pool), closeStore, nil
+}
+
+// checkpoint — контрольная точка импорта: число полностью обработанных строк файла.
+type checkpoint struct {
+	File  string `json:"file"`
+	Lines int64  `json:"lines"`
+}
+
+// loadCheckpoint читает контрольную точку импорта файла file. Отсутствующий файл
+// контрольной точки означает импорт с начала.
+func loadCheckpoint(path, file string) (checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoint{File: file}, nil
+	}
+	if err != nil {
+		return checkpoint{}, err
+	}
+	var cp checkpoint
+	if err := json.Unmarshal(data, &cp); err != nil {
+		return checkpoint{}, fmt.Errorf("decode checkpoint %s: %w", path, err)
+	}
+	if cp.File != file {
+		return checkpoint{}, fmt.Errorf("checkpoint %s belongs to %s, not %s", path, cp.File, file)
+	}
+	return cp, nil
+}
+
+// writeCheckpoint атомарно записывает контрольную точку через временный файл.
+func writeCheckpoint(path string, cp checkpoint) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
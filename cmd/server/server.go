@@ -4,7 +4,9 @@ package main
 import (
 	"context"
 	"errors"
-	"log"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -16,31 +18,59 @@ import (
 	"github.com/RoGogDBD/wb/internal/config"
 	"github.com/RoGogDBD/wb/internal/config/db"
 	"github.com/RoGogDBD/wb/internal/handlers"
+	"github.com/RoGogDBD/wb/internal/health"
+	"github.com/RoGogDBD/wb/internal/kafka"
+	"github.com/RoGogDBD/wb/internal/logging"
 	"github.com/RoGogDBD/wb/internal/repository"
 	"github.com/RoGogDBD/wb/internal/telemetry"
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	httpSwagger "github.com/swaggo/http-swagger"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/metric"
 )
 
 func main() {
-	// Загрузка конфигурации
-	cfg, err := config.LoadConfig()
+	// Загрузка конфигурации: значения по умолчанию, файл, переменные окружения WB_*, флаги
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	printConfig := fs.Bool("print-config", false, "print the effective config with secrets redacted and exit")
+	checkConfig := fs.Bool("check-config", false, "validate the config, report every problem and exit")
+	cfg, err := config.Load(fs, os.Args[1:])
+	if *checkConfig {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println("config OK")
+		return
+	}
 	if err != nil {
-		log.Fatal(err)
+		fatal("config load error", err)
+	}
+	if *printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fatal("config print error", err)
+		}
+		return
+	}
+	if err := logging.Setup(cfg.Logging.Format, cfg.Logging.Level); err != nil {
+		fatal("logging setup error", err)
 	}
 
 	// Инициализация зависимостей приложения
 	cache := repository.NewMemStorageWithConfig(cfg.Cache.MaxItems, cfg.Cache.TTL)
 	var dbPool *pgxpool.Pool
+	var dbMetrics metric.Registration
 	var store repository.OrderStore
-	if cfg.Database.DSN == "" {
-		log.Println("No DSN provided, running without database")
-	} else {
-		dbPool, err = db.NewPool(context.Background(), cfg.Database.DSN)
+	switch {
+	case cfg.Database.Driver == config.DriverMemory:
+		slog.Warn("using in-memory order store, data will not survive restart")
+		store = repository.NewMemoryOrderStore()
+	case cfg.Database.DSN == "":
+		slog.Warn("no DSN provided, running without database")
+	default:
+		dbPool, dbMetrics, err = db.NewPool(context.Background(), cfg.Database.DSN)
 		if err != nil {
-			log.Printf("Warning: cannot connect to DB: %v. Running without database.", err)
+			slog.Warn("cannot connect to DB, running without database", logging.Err(err))
 		} else {
 			store = repository.NewPostgresStorage(dbPool)
 		}
@@ -48,27 +78,29 @@ func main() {
 
 	// Инициализация приложения
 	application, err := app.NewApp(cfg, app.Deps{
-		Cache:  cache,
-		Store:  store,
-		DBPool: dbPool,
+		Cache:     cache,
+		Store:     store,
+		DBPool:    dbPool,
+		DBMetrics: dbMetrics,
 	})
 	if err != nil {
-		log.Fatal(err)
+		fatal("application create error", err)
 	}
 	if err := application.Init(); err != nil {
-		log.Fatal(err)
+		fatal("application init error", err)
 	}
 	defer application.Close()
 
 	telemetryProviders, err := telemetry.Init(context.Background(), cfg.Telemetry)
 	if err != nil {
-		log.Printf("Telemetry init failed: %v", err)
+		slog.Error("telemetry init failed", logging.Err(err))
 	} else {
+		application.Health.Register("telemetry", health.Optional, time.Second, telemetryProviders.Check)
 		defer func() {
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			defer cancel()
 			if err := telemetryProviders.Shutdown(ctx); err != nil {
-				log.Printf("Telemetry shutdown error: %v", err)
+				slog.Error("telemetry shutdown error", logging.Err(err))
 			}
 		}()
 	}
@@ -78,27 +110,45 @@ func main() {
 		metricsHandler = telemetryProviders.MetricsHandler
 	}
 
-	srv := setupHTTPServer(cfg, application, metricsHandler)
-	if err := run(srv); err != nil {
-		log.Fatal(err)
+	var dlq *kafka.DLQ
+	if cfg.Admin.Token != "" {
+		dlq = kafka.NewDLQ(cfg.Kafka, application.Pipeline)
+		defer func() {
+			if err := dlq.Close(); err != nil {
+				slog.Warn("DLQ writer close error", logging.Err(err))
+			}
+		}()
+	}
+
+	srv := setupHTTPServer(cfg, application, metricsHandler, dlq)
+	if err := run(srv, application.Fatal()); err != nil {
+		fatal("server error", err)
 	}
 }
 
+// fatal пишет ошибку в лог и завершает процесс с кодом 1.
+func fatal(msg string, err error) {
+	slog.Error(msg, logging.Err(err))
+	os.Exit(1)
+}
+
 // @title API заказов
 // @version 1.0
 // @description API для получения информации о заказах
-func run(srv *http.Server) error {
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+func run(srv *http.Server, fatal <-chan error) error {
 	// Плавное завершение
-	return startServerWithGracefulShutdown(srv)
+	return startServerWithGracefulShutdown(srv, fatal)
 }
 
 // setupHTTPServer настраивает и возвращает HTTP сервер
-func setupHTTPServer(cfg *config.Config, application *app.App, metricsHandler http.Handler) *http.Server {
+// Административные маршруты регистрируются, только если передан dlq.
+// Прием заказов по HTTP доступен, только если у приложения есть хранилище.
+func setupHTTPServer(cfg *config.Config, application *app.App, metricsHandler http.Handler, dlq *kafka.DLQ) *http.Server {
 	r := chi.NewRouter()
-	config.SetupMiddlewares(r)
-	if cfg.Telemetry.TracesEnabled || cfg.Telemetry.MetricsEnabled {
-		r.Use(otelhttp.NewMiddleware("http-server"))
-	}
+	config.SetupMiddlewares(r, cfg.Telemetry)
 
 	// Настройка Swagger
 	docs.SwaggerInfo.Title = "Order API"
@@ -111,11 +161,28 @@ func setupHTTPServer(cfg *config.Config, application *app.App, metricsHandler ht
 		http.ServeFile(w, r, "./api/index.html")
 	})
 	r.Get("/swagger/*", httpSwagger.WrapHandler)
-	r.Get("/healthz", h.HealthHandler)
+	probes := handlers.NewHealthHandler(application.Health)
+	r.Get("/livez", probes.LivenessHandler)
+	r.Get("/readyz", probes.ReadinessHandler)
+	r.Get("/healthz", probes.HealthzHandler)
 	r.Get("/order/{order_uid}", h.OrderHandler)
+	r.Get("/order/{order_uid}/history", h.OrderHistoryHandler)
+	r.Get("/order/{order_uid}/diff", h.OrderDiffHandler)
+	r.Get("/orders", h.OrderListHandler)
+	if application.Pipeline != nil {
+		r.Post("/orders", handlers.NewIngestHandler(application.Pipeline).CreateOrdersHandler)
+	}
 	if metricsHandler != nil {
 		r.Handle(cfg.Telemetry.MetricsPath, metricsHandler)
 	}
+	if dlq != nil {
+		admin := handlers.NewAdminHandler(dlq)
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(handlers.AdminAuth(cfg.Admin.Token))
+			r.Get("/dlq", admin.DLQListHandler)
+			r.Post("/dlq/replay", admin.DLQReplayHandler)
+		})
+	}
 
 	return &http.Server{
 		Addr:         cfg.Server.Address(),
@@ -126,8 +193,9 @@ func setupHTTPServer(cfg *config.Config, application *app.App, metricsHandler ht
 	}
 }
 
-// startServerWithGracefulShutdown запускает сервер с плавным завершением
-func startServerWithGracefulShutdown(srv *http.Server) error {
+// startServerWithGracefulShutdown запускает сервер с плавным завершением.
+// Ошибка из fatal останавливает сервер так же, как сигнал завершения.
+func startServerWithGracefulShutdown(srv *http.Server, fatal <-chan error) error {
 	// Канал для приема сигналов завершения
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
@@ -137,18 +205,21 @@ func startServerWithGracefulShutdown(srv *http.Server) error {
 
 	// Запуск сервера в отдельной горутине
 	go func() {
-		log.Printf("Server started on %s", srv.Addr)
+		slog.Info("server started", "addr", srv.Addr)
 		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			serverErrors <- err
 		}
 	}()
 
 	// Ожидание сигнала завершения или ошибки
+	var fatalErr error
 	select {
 	case err := <-serverErrors:
 		return err
 	case <-quit:
-		log.Println("Received shutdown signal")
+		slog.Info("received shutdown signal")
+	case fatalErr = <-fatal:
+		slog.Error("fatal application error", logging.Err(fatalErr))
 	}
 
 	// Плавное завершение
@@ -156,9 +227,12 @@ func startServerWithGracefulShutdown(srv *http.Server) error {
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		return err
+		return errors.Join(fatalErr, err)
+	}
+	if fatalErr != nil {
+		return fatalErr
 	}
 
-	log.Println("Server exited gracefully")
+	slog.Info("server exited gracefully")
 	return nil
 }
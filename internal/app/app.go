@@ -4,22 +4,43 @@ package app
 import (
 	"context"
 	"errors"
-	"log"
+	"log/slog"
+	"sync/atomic"
+	"time"
 
 	"github.com/RoGogDBD/wb/internal/config"
+	"github.com/RoGogDBD/wb/internal/health"
+	"github.com/RoGogDBD/wb/internal/ingest"
 	"github.com/RoGogDBD/wb/internal/kafka"
+	"github.com/RoGogDBD/wb/internal/logging"
+	"github.com/RoGogDBD/wb/internal/models"
 	"github.com/RoGogDBD/wb/internal/repository"
+	"github.com/RoGogDBD/wb/internal/retry"
+	"github.com/RoGogDBD/wb/internal/validation"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/metric"
 )
 
+// stopTimeout ограничивает ожидание остановки фоновых компонентов в Close.
+const stopTimeout = 15 * time.Second
+
 // App содержит все зависимости приложения
 type App struct {
-	Config    *config.Config
-	DBPool    *pgxpool.Pool
-	Storage   repository.Cache
-	PgStorage repository.OrderStore
-	ctx       context.Context
-	cancel    context.CancelFunc
+	Config     *config.Config
+	DBPool     *pgxpool.Pool
+	dbMetrics  metric.Registration
+	Storage    repository.Cache
+	PgStorage  repository.OrderStore
+	Validator  *validation.OrderValidator
+	Pipeline   *ingest.Pipeline
+	Health     *health.Registry
+	cacheReady atomic.Bool
+	warmUpDone chan struct{}
+	consumer   *supervisor
+	relay      *supervisor
+	fatal      chan error
+	ctx        context.Context
+	cancel     context.CancelFunc
 }
 
 // Deps содержит внешние зависимости приложения.
@@ -27,6 +48,8 @@ type Deps struct {
 	Cache  repository.Cache
 	Store  repository.OrderStore
 	DBPool *pgxpool.Pool
+	// DBMetrics — регистрация метрик пула DBPool, отменяется в Close до закрытия пула.
+	DBMetrics metric.Registration
 }
 
 // NewApp создает новое приложение.
@@ -38,88 +61,239 @@ func NewApp(cfg *config.Config, deps Deps) (*App, error) {
 		return nil, errors.New("cache dependency is required")
 	}
 
+	validator, err := validation.NewOrderValidator(cfg.Validation.Rules)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
 	app := &App{
 		Config:    cfg,
 		Storage:   deps.Cache,
 		PgStorage: deps.Store,
+		Validator: validator,
 		DBPool:    deps.DBPool,
+		dbMetrics: deps.DBMetrics,
+		Health:    health.NewRegistry(),
+		fatal:     make(chan error, 1),
 		ctx:       ctx,
 		cancel:    cancel,
 	}
+	if deps.Store != nil {
+		app.Pipeline = ingest.NewPipeline(cfg.Kafka, validator, deps.Store, deps.Cache)
+	}
 
 	return app, nil
 }
 
-// Init выполняет инициализацию зависимостей приложения.
+// Init выполняет инициализацию зависимостей приложения и регистрирует проверки компонентов в Health.
+// Загрузка кеша из БД и следующий за ней запуск Kafka-консьюмера выполняются в фоне,
+// до их завершения проверка готовности cache не проходит.
 func (a *App) Init() error {
-	log.Printf("Initialized cache with max %d items", a.Config.Cache.MaxItems)
-	if a.Config.Cache.TTL > 0 {
-		log.Printf("Cache TTL set to %s", a.Config.Cache.TTL)
-	}
+	slog.Info("cache initialized", "max_items", a.Config.Cache.MaxItems, "ttl", a.Config.Cache.TTL)
 	a.Storage.StartJanitor(a.ctx, a.Config.Cache.CleanupInterval)
 
-	// Загрузка данных из БД в кэш
+	// Kafka-консьюмер запускается после загрузки кеша в warmUp
 	if a.PgStorage != nil {
-		if err := a.loadOrdersToCache(a.ctx); err != nil {
-			log.Printf("Warning: failed to load orders from DB: %v", err)
-		}
+		kafkaCfg := a.Config.Kafka
+		a.consumer = newSupervisor(
+			"kafka consumer",
+			kafkaCfg.ConsumerMaxRestarts,
+			retry.NewBackoff(kafkaCfg.ConsumerRestartBackoff, kafkaCfg.ConsumerRestartBackoffCap, true),
+			func(ctx context.Context) error {
+				return kafka.RunConsumer(ctx, kafkaCfg, a.Pipeline)
+			},
+		)
 	}
 
-	// Запуск Kafka-консьюмера
-	if a.PgStorage != nil {
-		go kafka.RunConsumer(
-			a.ctx,
-			a.Config.Kafka.Brokers,
-			a.Config.Kafka.Topic,
-			a.Config.Kafka.GroupID,
-			a.Config.Kafka.DLQTopic,
-			a.Config.Kafka.DLQMaxRetries,
-			a.Config.Kafka.DLQBackoff,
-			a.Config.Kafka.DLQBackoffCap,
-			a.Config.Kafka.DLQBackoffJitter,
-			a.PgStorage,
-			a.Storage,
+	// Публикация событий изменения заказов из outbox
+	if outbox, ok := a.PgStorage.(repository.Outbox); ok && a.Config.Kafka.OutboxTopic != "" {
+		kafkaCfg := a.Config.Kafka
+		a.relay = newSupervisor(
+			"outbox relay",
+			kafkaCfg.ConsumerMaxRestarts,
+			retry.NewBackoff(kafkaCfg.ConsumerRestartBackoff, kafkaCfg.ConsumerRestartBackoffCap, true),
+			func(ctx context.Context) error {
+				return kafka.RunOutboxRelay(ctx, kafkaCfg, outbox)
+			},
 		)
+		a.relay.Start(a.ctx)
+		go a.forwardFatal(a.relay)
 	}
 
+	// Очистка журнала обработанных сообщений
+	if ledger, ok := a.PgStorage.(repository.MessageLedger); ok {
+		a.startLedgerPruner(a.ctx, ledger)
+	}
+
+	a.registerChecks()
+	a.warmUpDone = make(chan struct{})
+	go func() {
+		defer close(a.warmUpDone)
+		a.warmUp()
+	}()
 	return nil
 }
 
-// loadOrdersToCache загружает все заказы из БД в кэш при старте
-func (a *App) loadOrdersToCache(ctx context.Context) error {
-	log.Println("Loading orders from DB to cache...")
+// warmUp загружает кеш из БД и затем запускает Kafka-консьюмер. Консьюмер, запущенный раньше,
+// мог бы сохранить в кеш новую версию заказа, которую загрузка затем перезаписала бы старой.
+// Ошибка загрузки не мешает работе: недостающие заказы читаются из БД при промахе кеша.
+func (a *App) warmUp() {
+	if a.PgStorage != nil {
+		if err := a.loadOrdersToCache(a.ctx); err != nil {
+			slog.Warn("failed to load orders from DB", logging.Err(err))
+		}
+	}
+	if a.ctx.Err() != nil {
+		return
+	}
+	a.cacheReady.Store(true)
 
-	orders, err := a.PgStorage.GetAllOrders(ctx)
+	if a.consumer != nil {
+		a.consumer.Start(a.ctx)
+		go a.forwardFatal(a.consumer)
+	}
+}
+
+// startLedgerPruner периодически удаляет из журнала обработанных сообщений записи
+// старше database.ledger_retention. Нулевой интервал отключает очистку.
+func (a *App) startLedgerPruner(ctx context.Context, ledger repository.MessageLedger) {
+	interval := a.Config.Database.LedgerPruneInterval
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				a.pruneLedger(ctx, ledger)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// pruneLedger выполняет одну очистку журнала обработанных сообщений.
+func (a *App) pruneLedger(ctx context.Context, ledger repository.MessageLedger) {
+	pruned, err := ledger.PruneProcessedMessages(ctx, time.Now().Add(-a.Config.Database.LedgerRetention))
 	if err != nil {
-		return err
+		if ctx.Err() == nil {
+			slog.ErrorContext(ctx, "processed messages prune error", logging.Err(err))
+		}
+		return
+	}
+	if pruned > 0 {
+		slog.InfoContext(ctx, "pruned processed messages", "pruned", pruned, "retention", a.Config.Database.LedgerRetention)
 	}
+}
+
+// loadOrdersToCache загружает в кеш последние заказы из БД при старте.
+// Загружается не больше заказов, чем вмещает кеш; самые новые оказываются
+// последними использованными и вытесняются последними.
+func (a *App) loadOrdersToCache(ctx context.Context) error {
+	slog.InfoContext(ctx, "loading orders from DB to cache")
 
 	loaded := 0
-	for _, order := range orders {
-		a.Storage.Save(&order)
+	err := a.PgStorage.IterateOrders(ctx, a.Config.Cache.MaxItems, func(order *models.Order) error {
+		a.Storage.Save(order)
 		loaded++
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
-	log.Printf("Loaded %d/%d orders into cache", loaded, len(orders))
+	slog.InfoContext(ctx, "loaded orders into cache", "loaded", loaded, "limit", a.Config.Cache.MaxItems)
 	return nil
 }
 
-// Close освобождает все ресурсы приложения
+// ConsumerState возвращает состояние Kafka-консьюмера.
+func (a *App) ConsumerState() ComponentState {
+	if a.consumer == nil {
+		return StateStopped
+	}
+	return a.consumer.State()
+}
+
+// RelayState возвращает состояние публикации событий из outbox.
+func (a *App) RelayState() ComponentState {
+	if a.relay == nil {
+		return StateStopped
+	}
+	return a.relay.State()
+}
+
+// Fatal возвращает канал с ошибкой, после которой приложение должно завершиться.
+func (a *App) Fatal() <-chan error {
+	return a.fatal
+}
+
+// forwardFatal передает в общий канал Fatal ошибку супервизора s.
+func (a *App) forwardFatal(s *supervisor) {
+	select {
+	case err := <-s.Fatal():
+		select {
+		case a.fatal <- err:
+		default:
+		}
+	case <-a.ctx.Done():
+	}
+}
+
+// Close освобождает все ресурсы приложения. Перед закрытием пула БД ждет
+// (не дольше stopTimeout), пока остановятся Kafka-консьюмер и публикация событий из outbox.
 func (a *App) Close() {
-	log.Println("Shutting down application...")
+	slog.Info("shutting down application")
 
 	// Отменяем контекст (остановит Kafka-консьюмер)
 	if a.cancel != nil {
 		a.cancel()
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+	defer cancel()
+	// консьюмер запускается в конце warmUp: пока она не завершилась, Wait мог бы
+	// не застать консьюмер запущенным
+	if a.warmUpDone != nil {
+		select {
+		case <-a.warmUpDone:
+		case <-ctx.Done():
+		}
+	}
+	for _, s := range []*supervisor{a.consumer, a.relay} {
+		if s == nil {
+			continue
+		}
+		if err := s.Wait(ctx); err != nil {
+			slog.Warn("component did not stop in time", "component", s.name, "timeout", stopTimeout, logging.Err(err))
+		}
+	}
+
+	// Отменяем наблюдение за размером кеша
+	if c, ok := a.Storage.(interface{ Close() error }); ok {
+		if err := c.Close(); err != nil {
+			slog.Warn("cache close error", logging.Err(err))
+		}
+	}
+
+	// Отменяем метрики пула до его закрытия
+	if a.dbMetrics != nil {
+		if err := a.dbMetrics.Unregister(); err != nil {
+			slog.Warn("db pool metrics unregister error", logging.Err(err))
+		}
+	}
+
 	// Закрываем подключение к БД
 	if a.DBPool != nil {
 		a.DBPool.Close()
-		log.Println("Database connection closed")
+		slog.Info("database connection closed")
 	}
 
-	log.Println("Application shutdown complete")
+	slog.Info("application shutdown complete")
 }
 
 // Context возвращает контекст приложения
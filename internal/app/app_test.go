@@ -0,0 +1,221 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/config"
+	"github.com/RoGogDBD/wb/internal/health"
+	"github.com/RoGogDBD/wb/internal/models"
+	"github.com/RoGogDBD/wb/internal/repository/mocks"
+	"github.com/RoGogDBD/wb/internal/retry"
+	"go.opentelemetry.io/otel/metric/embedded"
+)
+
+func TestLoadOrdersToCache(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxItems   int
+		available  int
+		iterErr    error
+		wantSaved  int
+		wantErr    bool
+		wantLimits []int
+	}{
+		{
+			name:       "loads up to cache capacity",
+			maxItems:   2,
+			available:  2,
+			wantSaved:  2,
+			wantLimits: []int{2},
+		},
+		{
+			name:       "store error",
+			maxItems:   5,
+			available:  1,
+			iterErr:    errors.New("db down"),
+			wantSaved:  1,
+			wantErr:    true,
+			wantLimits: []int{5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var limits []int
+			store := &mocks.OrderStoreMock{
+				IterateOrdersFunc: func(_ context.Context, limit int, fn func(*models.Order) error) error {
+					limits = append(limits, limit)
+					for i := 0; i < tt.available; i++ {
+						if err := fn(&models.Order{OrderUID: string(rune('a' + i))}); err != nil {
+							return err
+						}
+					}
+					return tt.iterErr
+				},
+			}
+			cache := &mocks.CacheMock{}
+			cfg := &config.Config{Cache: config.CacheConfig{MaxItems: tt.maxItems}}
+
+			a, err := NewApp(cfg, Deps{Cache: cache, Store: store})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			defer a.Close()
+
+			err = a.loadOrdersToCache(context.Background())
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if cache.SaveCalls != tt.wantSaved {
+				t.Fatalf("expected %d cached orders, got %d", tt.wantSaved, cache.SaveCalls)
+			}
+			if len(limits) != len(tt.wantLimits) || limits[0] != tt.wantLimits[0] {
+				t.Fatalf("expected limits %v, got %v", tt.wantLimits, limits)
+			}
+		})
+	}
+}
+
+func TestReadinessWaitsForCacheWarmUp(t *testing.T) {
+	release := make(chan struct{})
+	store := &mocks.OrderStoreMock{
+		IterateOrdersFunc: func(ctx context.Context, _ int, fn func(*models.Order) error) error {
+			select {
+			case <-release:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			return fn(&models.Order{OrderUID: "a"})
+		},
+	}
+	cfg := &config.Config{Cache: config.CacheConfig{MaxItems: 10}}
+	a, err := NewApp(cfg, Deps{Cache: &mocks.CacheMock{}, Store: store})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer a.Close()
+	// консьюмер перезапускается после сбоя: чтение заказов от него не зависит
+	a.consumer = newSupervisor("kafka consumer", -1, retry.NewBackoff(time.Hour, 0, false), func(context.Context) error {
+		return errors.New("broker unavailable")
+	})
+
+	a.registerChecks()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a.warmUp()
+	}()
+
+	if report := a.Health.Readiness(context.Background()); report.OK() {
+		t.Fatalf("expected readiness to fail during cache warm-up, got %+v", report)
+	}
+	close(release)
+	<-done
+	if report := a.Health.Readiness(context.Background()); !report.OK() {
+		t.Fatalf("expected readiness after cache warm-up, got %+v", report)
+	}
+	if report := a.Health.Verbose(context.Background()); !report.OK() || !slices.ContainsFunc(report.Checks, func(r health.Result) bool {
+		return r.Name == "kafka" && r.Status == health.StatusFail
+	}) {
+		t.Fatalf("expected kafka failure only in the verbose report, got %+v", report)
+	}
+}
+
+// fakeLedger запоминает границу, переданную в PruneProcessedMessages.
+type fakeLedger struct {
+	before time.Time
+	err    error
+}
+
+func (l *fakeLedger) PruneProcessedMessages(_ context.Context, before time.Time) (int64, error) {
+	l.before = before
+	return 1, l.err
+}
+
+func TestPruneLedgerUsesRetention(t *testing.T) {
+	const retention = 24 * time.Hour
+	cfg := &config.Config{Database: config.DatabaseConfig{LedgerRetention: retention}}
+	a, err := NewApp(cfg, Deps{Cache: &mocks.CacheMock{}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer a.Close()
+
+	ledger := &fakeLedger{}
+	start := time.Now()
+	a.pruneLedger(context.Background(), ledger)
+
+	if ledger.before.Before(start.Add(-retention)) || ledger.before.After(time.Now().Add(-retention)) {
+		t.Fatalf("unexpected prune boundary %s for retention %s", ledger.before, retention)
+	}
+}
+
+func TestCloseWaitsForConsumer(t *testing.T) {
+	a, err := NewApp(&config.Config{Cache: config.CacheConfig{MaxItems: 10}}, Deps{Cache: &mocks.CacheMock{}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var flushed atomic.Bool
+	a.consumer = newSupervisor("kafka consumer", 0, retry.NewBackoff(time.Millisecond, 0, false), func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		// финальная фиксация оффсетов после отмены
+		<-release
+		flushed.Store(true)
+		return nil
+	})
+	a.consumer.Start(a.ctx)
+	<-started
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		a.Close()
+	}()
+
+	select {
+	case <-closed:
+		t.Fatal("Close returned before the consumer stopped")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not return after the consumer stopped")
+	}
+	if !flushed.Load() {
+		t.Fatal("expected consumer to finish before Close returned")
+	}
+}
+
+func TestCloseUnregistersPoolMetrics(t *testing.T) {
+	reg := &fakeRegistration{}
+	a, err := NewApp(&config.Config{}, Deps{Cache: &mocks.CacheMock{}, DBMetrics: reg})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	a.Close()
+	if reg.unregistered != 1 {
+		t.Fatalf("expected pool metrics to be unregistered once, got %d", reg.unregistered)
+	}
+}
+
+// fakeRegistration считает отмены регистрации метрик.
+type fakeRegistration struct {
+	embedded.Registration
+	unregistered int
+}
+
+func (r *fakeRegistration) Unregister() error {
+	r.unregistered++
+	return nil
+}
@@ -0,0 +1,65 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/health"
+	"github.com/RoGogDBD/wb/internal/kafka"
+)
+
+// Таймауты проверок компонентов.
+const (
+	dbCheckTimeout    = 2 * time.Second
+	kafkaCheckTimeout = 3 * time.Second
+)
+
+// registerChecks регистрирует в a.Health проверки компонентов приложения:
+//   - cache — загрузка кеша из БД завершена (readiness);
+//   - postgres — пул подключений отвечает на ping (readiness);
+//   - kafka consumer — консьюмер не остановлен окончательно (liveness);
+//   - kafka — консьюмер работает и брокер доступен (только в подробном отчете);
+//   - outbox relay — публикация событий работает (только в подробном отчете).
+//
+// Чтение заказов обслуживается из кеша и БД, поэтому недоступность брокера или
+// перезапуск консьюмера не выводят реплику из балансировки.
+func (a *App) registerChecks() {
+	a.Health.Register("cache", health.Readiness, 0, func(context.Context) error {
+		if !a.cacheReady.Load() {
+			return errors.New("cache warm-up in progress")
+		}
+		return nil
+	})
+	if a.DBPool != nil {
+		a.Health.Register("postgres", health.Readiness, dbCheckTimeout, a.DBPool.Ping)
+	}
+	if a.consumer != nil {
+		a.Health.Register("kafka consumer", health.Liveness, 0, func(context.Context) error {
+			if a.consumer.State() == StateFailed {
+				return errors.New("kafka consumer failed permanently")
+			}
+			return nil
+		})
+		a.Health.Register("kafka", health.Optional, kafkaCheckTimeout, func(ctx context.Context) error {
+			if err := stateCheck(a.consumer); err != nil {
+				return err
+			}
+			return kafka.Ping(ctx, a.Config.Kafka.Brokers)
+		})
+	}
+	if a.relay != nil {
+		a.Health.Register("outbox relay", health.Optional, 0, func(context.Context) error {
+			return stateCheck(a.relay)
+		})
+	}
+}
+
+// stateCheck возвращает ошибку, если задача супервизора s не работает.
+func stateCheck(s *supervisor) error {
+	if state := s.State(); state != StateRunning {
+		return fmt.Errorf("%s is %s", s.name, state)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/logging"
+	"github.com/RoGogDBD/wb/internal/retry"
+)
+
+// ComponentState описывает состояние фонового компонента под наблюдением супервизора.
+type ComponentState string
+
+const (
+	// StateStopped — компонент не запущен или остановлен штатно.
+	StateStopped ComponentState = "stopped"
+	// StateRunning — компонент работает.
+	StateRunning ComponentState = "running"
+	// StateRestarting — компонент упал и ожидает перезапуска.
+	StateRestarting ComponentState = "restarting"
+	// StateFailed — лимит перезапусков исчерпан, компонент больше не запускается.
+	StateFailed ComponentState = "failed"
+)
+
+// supervisor перезапускает фоновую задачу с экспоненциальной задержкой.
+type supervisor struct {
+	name        string
+	run         func(ctx context.Context) error
+	maxRestarts int
+	backoff     *retry.Backoff
+
+	mu      sync.RWMutex
+	state   ComponentState
+	fatal   chan error
+	started atomic.Bool
+	done    chan struct{}
+}
+
+func newSupervisor(name string, maxRestarts int, backoff *retry.Backoff, run func(ctx context.Context) error) *supervisor {
+	return &supervisor{
+		name:        name,
+		run:         run,
+		maxRestarts: maxRestarts,
+		backoff:     backoff,
+		state:       StateStopped,
+		fatal:       make(chan error, 1),
+		done:        make(chan struct{}),
+	}
+}
+
+// Start запускает задачу в отдельной горутине. Повторный вызов ничего не делает.
+func (s *supervisor) Start(ctx context.Context) {
+	if !s.started.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer close(s.done)
+		s.loop(ctx)
+	}()
+}
+
+// Done возвращает канал, который закрывается, когда супервизор остановлен
+// и последний запуск задачи завершился. Для незапущенного супервизора канал не закрывается.
+func (s *supervisor) Done() <-chan struct{} {
+	return s.done
+}
+
+// Wait ждет остановки запущенного супервизора (см. Done) и сразу возвращает nil для незапущенного.
+// Если ctx завершится раньше, возвращает ошибку ctx.
+func (s *supervisor) Wait(ctx context.Context) error {
+	if !s.started.Load() {
+		return nil
+	}
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// State возвращает текущее состояние задачи.
+func (s *supervisor) State() ComponentState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.state
+}
+
+// Fatal возвращает канал, в который попадает ошибка после исчерпания перезапусков.
+func (s *supervisor) Fatal() <-chan error {
+	return s.fatal
+}
+
+// loop запускает задачу и перезапускает ее после ошибок.
+// Счетчик перезапусков сбрасывается, если задача проработала дольше максимальной задержки.
+func (s *supervisor) loop(ctx context.Context) {
+	restarts := 0
+	for {
+		s.setState(StateRunning)
+		started := time.Now()
+		err := s.runOnce(ctx)
+		if ctx.Err() != nil {
+			s.setState(StateStopped)
+			return
+		}
+		if err == nil {
+			err = fmt.Errorf("%s exited unexpectedly", s.name)
+		}
+
+		if s.backoff != nil && s.backoff.Cap > 0 && time.Since(started) >= s.backoff.Cap {
+			restarts = 0
+		}
+		if s.maxRestarts >= 0 && restarts >= s.maxRestarts {
+			s.setState(StateFailed)
+			slog.ErrorContext(ctx, "component failed permanently", "component", s.name, "restarts", restarts, logging.Err(err))
+			s.fatal <- fmt.Errorf("%s failed permanently: %w", s.name, err)
+			return
+		}
+
+		wait := s.backoff.WaitDuration(restarts)
+		restarts++
+		s.setState(StateRestarting)
+		slog.WarnContext(ctx, "component stopped, restarting", "component", s.name, "retry_in", wait, "restart", restarts, logging.Err(err))
+
+		select {
+		case <-ctx.Done():
+			s.setState(StateStopped)
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// runOnce выполняет задачу, превращая панику в ошибку.
+func (s *supervisor) runOnce(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s panic: %v", s.name, r)
+		}
+	}()
+	return s.run(ctx)
+}
+
+func (s *supervisor) setState(state ComponentState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state = state
+}
@@ -0,0 +1,151 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/retry"
+)
+
+func TestSupervisor(t *testing.T) {
+	tests := []struct {
+		name        string
+		maxRestarts int
+		failures    int
+		wantFatal   bool
+		wantRuns    int32
+	}{
+		{
+			name:        "recovers after failures",
+			maxRestarts: 3,
+			failures:    2,
+			wantFatal:   false,
+			wantRuns:    3,
+		},
+		{
+			name:        "fails permanently",
+			maxRestarts: 2,
+			failures:    10,
+			wantFatal:   true,
+			wantRuns:    3,
+		},
+		{
+			name:        "panic is restarted",
+			maxRestarts: 1,
+			failures:    -1,
+			wantFatal:   false,
+			wantRuns:    2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var runs atomic.Int32
+			running := make(chan struct{}, 1)
+			s := newSupervisor("test", tt.maxRestarts, retry.NewBackoff(time.Millisecond, 0, false), func(ctx context.Context) error {
+				n := runs.Add(1)
+				if tt.failures < 0 && n == 1 {
+					panic("boom")
+				}
+				if int(n) <= tt.failures {
+					return errors.New("run failed")
+				}
+				running <- struct{}{}
+				<-ctx.Done()
+				return nil
+			})
+			s.Start(ctx)
+
+			select {
+			case err := <-s.Fatal():
+				if !tt.wantFatal {
+					t.Fatalf("unexpected fatal error: %v", err)
+				}
+				if s.State() != StateFailed {
+					t.Fatalf("expected state %q, got %q", StateFailed, s.State())
+				}
+			case <-running:
+				if tt.wantFatal {
+					t.Fatalf("expected fatal error")
+				}
+				if s.State() != StateRunning {
+					t.Fatalf("expected state %q, got %q", StateRunning, s.State())
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("supervisor did not settle, state %q", s.State())
+			}
+
+			if got := runs.Load(); got != tt.wantRuns {
+				t.Fatalf("expected %d runs, got %d", tt.wantRuns, got)
+			}
+		})
+	}
+}
+
+func TestSupervisorStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	s := newSupervisor("test", 0, retry.NewBackoff(time.Millisecond, 0, false), func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return nil
+	})
+	s.Start(ctx)
+	<-started
+	cancel()
+
+	deadline := time.After(time.Second)
+	for s.State() != StateStopped {
+		select {
+		case <-deadline:
+			t.Fatalf("expected state %q, got %q", StateStopped, s.State())
+		case <-time.After(time.Millisecond):
+		}
+	}
+}
+
+func TestSupervisorWait(t *testing.T) {
+	s := newSupervisor("test", 0, retry.NewBackoff(time.Millisecond, 0, false), nil)
+	if err := s.Wait(context.Background()); err != nil {
+		t.Fatalf("expected no wait for a supervisor that was never started, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	release := make(chan struct{})
+	s = newSupervisor("test", 0, retry.NewBackoff(time.Millisecond, 0, false), func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		// задача дорабатывает после отмены, например фиксирует оффсеты
+		<-release
+		return nil
+	})
+	s.Start(ctx)
+	<-started
+	cancel()
+
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer waitCancel()
+	if err := s.Wait(waitCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected Wait to block while the run is finishing, got %v", err)
+	}
+
+	close(release)
+	if err := s.Wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	select {
+	case <-s.Done():
+	default:
+		t.Fatal("expected Done to be closed after Wait returned")
+	}
+	if s.State() != StateStopped {
+		t.Fatalf("expected state %q, got %q", StateStopped, s.State())
+	}
+}
@@ -3,19 +3,21 @@ package config
 
 import (
 	"fmt"
-	"os"
 	"time"
 
-	"gopkg.in/yaml.v3"
+	"github.com/RoGogDBD/wb/internal/validation"
 )
 
 // Config содержит конфигурацию приложения
 type Config struct {
-	Server    ServerConfig    `yaml:"server"`
-	Database  DatabaseConfig  `yaml:"database"`
-	Kafka     KafkaConfig     `yaml:"kafka"`
-	Cache     CacheConfig     `yaml:"cache"`
-	Telemetry TelemetryConfig `yaml:"telemetry"`
+	Server     ServerConfig     `yaml:"server"`
+	Database   DatabaseConfig   `yaml:"database"`
+	Kafka      KafkaConfig      `yaml:"kafka"`
+	Cache      CacheConfig      `yaml:"cache"`
+	Telemetry  TelemetryConfig  `yaml:"telemetry"`
+	Logging    LoggingConfig    `yaml:"logging"`
+	Admin      AdminConfig      `yaml:"admin"`
+	Validation ValidationConfig `yaml:"validation"`
 }
 
 // ServerConfig содержит настройки HTTP сервера
@@ -27,9 +29,21 @@ type ServerConfig struct {
 	IdleTimeout  time.Duration `yaml:"idle_timeout"`
 }
 
+// Драйверы хранилища заказов.
+const (
+	DriverPostgres = "postgres"
+	DriverMemory   = "memory"
+)
+
 // DatabaseConfig содержит настройки подключения к БД
 type DatabaseConfig struct {
-	DSN string `yaml:"dsn"`
+	// Driver — хранилище заказов: postgres или memory (в памяти процесса, без DSN).
+	Driver string `yaml:"driver"`
+	DSN    string `yaml:"dsn" secret:"dsn"`
+	// LedgerRetention — сколько хранить записи журнала обработанных сообщений.
+	LedgerRetention time.Duration `yaml:"ledger_retention"`
+	// LedgerPruneInterval — период очистки журнала обработанных сообщений (0 — не очищать).
+	LedgerPruneInterval time.Duration `yaml:"ledger_prune_interval"`
 }
 
 // KafkaConfig содержит настройки Kafka
@@ -42,6 +56,20 @@ type KafkaConfig struct {
 	DLQBackoff       time.Duration `yaml:"dlq_backoff"`
 	DLQBackoffCap    time.Duration `yaml:"dlq_backoff_cap"`
 	DLQBackoffJitter bool          `yaml:"dlq_backoff_jitter"`
+	DLQMaxReplays    int           `yaml:"dlq_max_replays"`
+	CommitInterval   time.Duration `yaml:"commit_interval"`
+	Workers          int           `yaml:"workers"`
+	BatchSize        int           `yaml:"batch_size"`
+	BatchTimeout     time.Duration `yaml:"batch_timeout"`
+
+	// OutboxTopic — топик событий изменения заказов (пустое значение отключает публикацию).
+	OutboxTopic        string        `yaml:"outbox_topic"`
+	OutboxBatchSize    int           `yaml:"outbox_batch_size"`
+	OutboxPollInterval time.Duration `yaml:"outbox_poll_interval"`
+
+	ConsumerMaxRestarts       int           `yaml:"consumer_max_restarts"`
+	ConsumerRestartBackoff    time.Duration `yaml:"consumer_restart_backoff"`
+	ConsumerRestartBackoffCap time.Duration `yaml:"consumer_restart_backoff_cap"`
 }
 
 // CacheConfig содержит настройки кеша.
@@ -59,29 +87,34 @@ type TelemetryConfig struct {
 	OTLPInsecure     bool    `yaml:"otlp_insecure"`
 	TracesEnabled    bool    `yaml:"traces_enabled"`
 	MetricsEnabled   bool    `yaml:"metrics_enabled"`
-	TraceSampleRatio float64 `yaml:"trace_sample_ratio"`
+	TraceSampleRatio float64 `yaml:"trace_sample_ratio"` // 0 — не сэмплировать ничего, 1 — все трассировки
 	MetricsPath      string  `yaml:"metrics_path"`
 }
 
-// LoadConfig загружает конфигурацию из файла
-func LoadConfig() (*Config, error) {
-	path := os.Getenv("CONFIG_PATH")
-	if path == "" {
-		path = "config.yaml"
-	}
+// LoggingConfig содержит настройки логирования.
+type LoggingConfig struct {
+	// Level — минимальный уровень записей: debug, info, warn или error.
+	Level string `yaml:"level"`
+	// Format — формат вывода: text или json.
+	Format string `yaml:"format"`
+}
 
-	cfg := defaultConfig()
+// AdminConfig содержит настройки административного API.
+type AdminConfig struct {
+	// Token — bearer-токен доступа; пустое значение отключает административный API.
+	Token string `yaml:"token" secret:"true"`
+}
 
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read config file %q: %w", path, err)
-	}
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return nil, fmt.Errorf("failed to parse config file %q: %w", path, err)
-	}
+// ValidationConfig содержит настройки проверки заказов.
+type ValidationConfig struct {
+	// Rules — режимы правил согласованности сумм (strict или warn); правила без режима строгие.
+	Rules validation.Rules `yaml:"rules"`
+}
 
-	normalizeConfig(&cfg)
-	return &cfg, nil
+// LoadConfig загружает конфигурацию из значений по умолчанию, файла и переменных окружения,
+// без флагов командной строки (см. Load).
+func LoadConfig() (*Config, error) {
+	return Load(nil, nil)
 }
 
 // Address возвращает адрес сервера в формате host:port
@@ -102,7 +135,10 @@ func defaultConfig() Config {
 			IdleTimeout:  60 * time.Second,
 		},
 		Database: DatabaseConfig{
-			DSN: "",
+			Driver:              DriverPostgres,
+			DSN:                 "",
+			LedgerRetention:     7 * 24 * time.Hour,
+			LedgerPruneInterval: time.Hour,
 		},
 		Kafka: KafkaConfig{
 			Brokers:          []string{"localhost:9092"},
@@ -113,6 +149,19 @@ func defaultConfig() Config {
 			DLQBackoff:       500 * time.Millisecond,
 			DLQBackoffCap:    5 * time.Second,
 			DLQBackoffJitter: true,
+			DLQMaxReplays:    3,
+			CommitInterval:   time.Second,
+			Workers:          4,
+			BatchSize:        100,
+			BatchTimeout:     50 * time.Millisecond,
+
+			OutboxTopic:        "orders.events",
+			OutboxBatchSize:    100,
+			OutboxPollInterval: time.Second,
+
+			ConsumerMaxRestarts:       5,
+			ConsumerRestartBackoff:    time.Second,
+			ConsumerRestartBackoffCap: 30 * time.Second,
 		},
 		Cache: CacheConfig{
 			MaxItems:        10000,
@@ -129,9 +178,15 @@ func defaultConfig() Config {
 			TraceSampleRatio: 1.0,
 			MetricsPath:      "/metrics",
 		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "text",
+		},
 	}
 }
 
+// normalizeConfig заполняет незаданные (нулевые) параметры значениями по умолчанию.
+// Недопустимые значения не исправляются: их отклоняет Validate.
 func normalizeConfig(cfg *Config) {
 	if cfg.Server.Port == 0 {
 		cfg.Server.Port = 8080
@@ -145,14 +200,11 @@ func normalizeConfig(cfg *Config) {
 	if cfg.Server.IdleTimeout == 0 {
 		cfg.Server.IdleTimeout = 60 * time.Second
 	}
-	if cfg.Cache.MaxItems <= 0 {
-		cfg.Cache.MaxItems = 10000
-	}
-	if cfg.Cache.CleanupInterval < 0 {
-		cfg.Cache.CleanupInterval = 0
+	if cfg.Database.Driver == "" {
+		cfg.Database.Driver = DriverPostgres
 	}
-	if cfg.Cache.TTL < 0 {
-		cfg.Cache.TTL = 0
+	if cfg.Cache.MaxItems == 0 {
+		cfg.Cache.MaxItems = 10000
 	}
 	if cfg.Telemetry.ServiceName == "" {
 		cfg.Telemetry.ServiceName = "wb-orders"
@@ -160,22 +212,31 @@ func normalizeConfig(cfg *Config) {
 	if cfg.Telemetry.OTLPEndpoint == "" {
 		cfg.Telemetry.OTLPEndpoint = "localhost:4318"
 	}
-	if cfg.Telemetry.TraceSampleRatio <= 0 || cfg.Telemetry.TraceSampleRatio > 1 {
-		cfg.Telemetry.TraceSampleRatio = 1.0
-	}
 	if cfg.Telemetry.MetricsPath == "" {
 		cfg.Telemetry.MetricsPath = "/metrics"
 	}
+	if cfg.Logging.Level == "" {
+		cfg.Logging.Level = "info"
+	}
+	if cfg.Logging.Format == "" {
+		cfg.Logging.Format = "text"
+	}
 	if cfg.Kafka.DLQTopic == "" && cfg.Kafka.Topic != "" {
 		cfg.Kafka.DLQTopic = cfg.Kafka.Topic + ".dlq"
 	}
-	if cfg.Kafka.DLQMaxRetries < 0 {
-		cfg.Kafka.DLQMaxRetries = 0
+	if cfg.Kafka.Workers == 0 {
+		cfg.Kafka.Workers = 1
+	}
+	if cfg.Kafka.BatchSize == 0 {
+		cfg.Kafka.BatchSize = 1
+	}
+	if cfg.Kafka.OutboxBatchSize == 0 {
+		cfg.Kafka.OutboxBatchSize = 1
 	}
-	if cfg.Kafka.DLQBackoff < 0 {
-		cfg.Kafka.DLQBackoff = 0
+	if cfg.Kafka.OutboxPollInterval == 0 {
+		cfg.Kafka.OutboxPollInterval = time.Second
 	}
-	if cfg.Kafka.DLQBackoffCap < 0 {
-		cfg.Kafka.DLQBackoffCap = 0
+	if cfg.Kafka.ConsumerRestartBackoff == 0 {
+		cfg.Kafka.ConsumerRestartBackoff = time.Second
 	}
 }
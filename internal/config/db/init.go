@@ -4,19 +4,29 @@ package db
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 
 	"github.com/RoGogDBD/wb/internal/config"
+	"github.com/RoGogDBD/wb/internal/logging"
+	"github.com/RoGogDBD/wb/internal/repository"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/metric"
 )
 
 // NewPool создает пул подключений к PostgreSQL с повторами и миграциями.
-func NewPool(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
-	var pool *pgxpool.Pool
+// Запросы пула трассируются repository.QueryTracer, состояние пула экспортируется метриками db.pool.*.
+// Регистрацию метрик metrics нужно отменить до закрытия пула; она равна nil,
+// если метрики не удалось зарегистрировать.
+func NewPool(ctx context.Context, dsn string) (pool *pgxpool.Pool, metrics metric.Registration, err error) {
+	poolConfig, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse DB DSN: %w", err)
+	}
+	poolConfig.ConnConfig.Tracer = repository.QueryTracer{}
 
 	if err := config.GetRetryIntervals(ctx, func() error {
 		var err error
-		pool, err = pgxpool.New(ctx, dsn)
+		pool, err = pgxpool.NewWithConfig(ctx, poolConfig)
 		if err != nil {
 			return err
 		}
@@ -26,17 +36,22 @@ func NewPool(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
 		}
 		return nil
 	}); err != nil {
-		return nil, fmt.Errorf("failed to connect to DB: %w", err)
+		return nil, nil, fmt.Errorf("failed to connect to DB: %w", err)
 	}
 
-	log.Println("Connected to PostgreSQL")
+	slog.InfoContext(ctx, "connected to PostgreSQL")
 
 	if err := config.GetRetryIntervals(ctx, func() error {
 		return RunMigrations(dsn)
 	}); err != nil {
 		pool.Close()
-		return nil, fmt.Errorf("failed to run migrations after retries: %w", err)
+		return nil, nil, fmt.Errorf("failed to run migrations after retries: %w", err)
+	}
+
+	metrics, err = registerPoolMetrics(pool)
+	if err != nil {
+		slog.ErrorContext(ctx, "DB pool metrics init error", logging.Err(err))
 	}
 
-	return pool, nil
+	return pool, metrics, nil
 }
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// meterName — имя инструментирования метрик пула подключений.
+const meterName = "github.com/RoGogDBD/wb/internal/config/db"
+
+// registerPoolMetrics регистрирует метрики пула по pool.Stat(): число занятых, свободных
+// и всех соединений и суммарное время ожидания соединения, когда все соединения заняты.
+// Значения снимаются при каждом сборе метрик. Возвращенную регистрацию нужно отменить
+// до закрытия пула, иначе сбор метрик продолжит обращаться к закрытому пулу.
+func registerPoolMetrics(pool *pgxpool.Pool) (metric.Registration, error) {
+	meter := otel.Meter(meterName)
+	acquired, err := meter.Int64ObservableGauge("db.pool.acquired_connections",
+		metric.WithDescription("Connections currently acquired from the pool"),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		return nil, err
+	}
+	idle, err := meter.Int64ObservableGauge("db.pool.idle_connections",
+		metric.WithDescription("Idle connections in the pool"),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		return nil, err
+	}
+	total, err := meter.Int64ObservableGauge("db.pool.total_connections",
+		metric.WithDescription("Connections in the pool, including ones being established"),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		return nil, err
+	}
+	maxConns, err := meter.Int64ObservableGauge("db.pool.max_connections",
+		metric.WithDescription("Maximum number of connections in the pool"),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		return nil, err
+	}
+	wait, err := meter.Float64ObservableCounter("db.pool.wait_duration",
+		metric.WithDescription("Total time spent waiting for a connection because the pool was exhausted"),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	waits, err := meter.Int64ObservableCounter("db.pool.waits",
+		metric.WithDescription("Connection acquires that had to wait because the pool was exhausted"),
+		metric.WithUnit("{acquire}"))
+	if err != nil {
+		return nil, err
+	}
+
+	return meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		s := pool.Stat()
+		o.ObserveInt64(acquired, int64(s.AcquiredConns()))
+		o.ObserveInt64(idle, int64(s.IdleConns()))
+		o.ObserveInt64(total, int64(s.TotalConns()))
+		o.ObserveInt64(maxConns, int64(s.MaxConns()))
+		o.ObserveFloat64(wait, s.EmptyAcquireWaitTime().Seconds())
+		o.ObserveInt64(waits, s.EmptyAcquireCount())
+		return nil
+	}, acquired, idle, total, maxConns, wait, waits)
+}
@@ -3,7 +3,7 @@ package db
 import (
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres" // регистрация драйвера Postgres
@@ -19,16 +19,16 @@ func RunMigrations(dsn string) error {
 		return fmt.Errorf("failed to init migrations: %v", err)
 	}
 
-	log.Println("Migration files found. Applying migrations...")
+	slog.Info("applying migrations", "path", migrationsPath)
 
 	if err := m.Up(); err != nil {
 		if errors.Is(err, migrate.ErrNoChange) {
-			log.Println("No new migrations to apply. Database is up-to-date.")
+			slog.Info("no new migrations to apply, database is up to date")
 		} else {
 			return fmt.Errorf("failed to apply migrations: %v", err)
 		}
 	} else {
-		log.Println("Migrations applied successfully.")
+		slog.Info("migrations applied")
 	}
 	return nil
 }
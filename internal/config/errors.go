@@ -4,9 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
 	"time"
 
+	"github.com/RoGogDBD/wb/internal/logging"
 	"github.com/jackc/pgx/v5/pgconn"
 )
 
@@ -23,7 +25,7 @@ func GetRetryIntervals(ctx context.Context, op func() error) error {
 		if err := op(); err != nil {
 			if isRetriableError(err) {
 				lastErr = err
-				log.Printf("Retriable error: %v (attempt %d/%d). Retrying in %v...", err, i+1, len(retryIntervals), wait)
+				slog.WarnContext(ctx, "retriable error", "attempt", i+1, "max_attempts", len(retryIntervals), "retry_in", wait, logging.Err(err))
 				select {
 				case <-ctx.Done():
 					return ctx.Err()
@@ -47,3 +49,78 @@ func isRetriableError(err error) bool {
 	}
 	return false
 }
+
+// FieldError — недопустимое значение параметра конфигурации.
+type FieldError struct {
+	// Field — путь параметра по yaml-тегам, например kafka.topic.
+	Field string
+	Msg   string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Msg
+}
+
+// ValidationError содержит все ошибки проверки конфигурации.
+// Отдельные ошибки доступны через errors.As с *FieldError.
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid config (%d problems):", len(e.Errors))
+	for _, fe := range e.Errors {
+		b.WriteString("\n  ")
+		b.WriteString(fe.Error())
+	}
+	return b.String()
+}
+
+// Unwrap возвращает отдельные ошибки для errors.Is и errors.As.
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, fe := range e.Errors {
+		errs[i] = fe
+	}
+	return errs
+}
+
+// errorList накапливает ошибки проверки, чтобы вернуть их все разом.
+type errorList struct {
+	errs []*FieldError
+}
+
+// add добавляет ошибку параметра field.
+func (l *errorList) add(field, format string, args ...any) {
+	l.errs = append(l.errs, &FieldError{Field: field, Msg: fmt.Sprintf(format, args...)})
+}
+
+// check добавляет ошибку параметра field, если err не nil.
+func (l *errorList) check(field string, err error) {
+	if err != nil {
+		l.add(field, "%s", err)
+	}
+}
+
+// nonNegative добавляет ошибку, если длительность field отрицательна.
+func (l *errorList) nonNegative(field string, d time.Duration) {
+	if d < 0 {
+		l.add(field, "must not be negative, got %s", d)
+	}
+}
+
+// nonNegativeInt добавляет ошибку, если значение field отрицательно.
+func (l *errorList) nonNegativeInt(field string, n int) {
+	if n < 0 {
+		l.add(field, "must not be negative, got %d", n)
+	}
+}
+
+// err возвращает *ValidationError с накопленными ошибками или nil.
+func (l *errorList) err() error {
+	if len(l.errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: l.errs}
+}
@@ -0,0 +1,259 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix — префикс переменных окружения, переопределяющих настройки.
+const envPrefix = "WB_"
+
+// defaultConfigPath — файл конфигурации по умолчанию. В отличие от файла,
+// заданного через --config или CONFIG_PATH, он может отсутствовать.
+const defaultConfigPath = "config.yaml"
+
+// secretDSN — значение тега secret для строки подключения: при печати скрывается
+// только пароль. Значения полей с другим непустым тегом secret скрываются целиком.
+const secretDSN = "dsn"
+
+const redactedValue = "[REDACTED]"
+
+// Load загружает конфигурацию по слоям; каждый следующий слой переопределяет предыдущий:
+//  1. значения по умолчанию;
+//  2. YAML-файл из --config, CONFIG_PATH или config.yaml (файл по умолчанию необязателен);
+//  3. переменные окружения WB_<СЕКЦИЯ>_<ПОЛЕ>, например WB_DATABASE_DSN;
+//  4. флаги командной строки --<секция>.<поле>, например --database.dsn.
+//
+// Имена переменных и флагов выводятся из yaml-тегов Config. Списки задаются через запятую
+// (WB_KAFKA_BROKERS=kafka-1:9092,kafka-2:9092), словари — парами через запятую
+// (WB_VALIDATION_RULES=amount=warn,goods_total=strict), длительности — в формате time.ParseDuration.
+// Итоговая конфигурация проверяется Validate; ошибка проверки — *ValidationError.
+// Если fs не nil, в нем регистрируются флаги конфигурации и разбираются args;
+// флаги, добавленные в fs вызывающим, разбираются вместе с ними.
+func Load(fs *flag.FlagSet, args []string) (*Config, error) {
+	cfg := defaultConfig()
+	path := os.Getenv("CONFIG_PATH")
+
+	// флаги разбираются в отдельную копию, чтобы ошибки в значениях находились
+	// при разборе, а применялись флаги поверх файла и окружения
+	flagCfg := defaultConfig()
+	flagSettings := make(map[string]setting)
+	if fs != nil {
+		fs.StringVar(&path, "config", path, "path to the YAML config file (env CONFIG_PATH)")
+		for _, s := range settings(&flagCfg) {
+			flagSettings[s.key] = s
+			fs.Func(s.key, fmt.Sprintf("overrides %s (env %s)", s.key, s.env()), s.set)
+		}
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+	}
+
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigPath
+	}
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		// неизвестные ключи отклоняются: опечатка в имени параметра иначе молча игнорируется
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse config file %q: %w", path, err)
+		}
+	case errors.Is(err, os.ErrNotExist) && !explicit:
+	default:
+		return nil, fmt.Errorf("failed to read config file %q: %w", path, err)
+	}
+
+	current := settings(&cfg)
+	for _, s := range current {
+		raw, ok := os.LookupEnv(s.env())
+		if !ok {
+			continue
+		}
+		if err := s.set(raw); err != nil {
+			return nil, fmt.Errorf("invalid environment variable %s: %w", s.env(), err)
+		}
+	}
+
+	if fs != nil {
+		byKey := make(map[string]setting, len(current))
+		for _, s := range current {
+			byKey[s.key] = s
+		}
+		fs.Visit(func(f *flag.Flag) {
+			if s, ok := byKey[f.Name]; ok {
+				s.value.Set(flagSettings[f.Name].value)
+			}
+		})
+	}
+
+	normalizeConfig(&cfg)
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Print записывает действующую конфигурацию в w в формате YAML; секреты скрываются.
+func (c *Config) Print(w io.Writer) error {
+	out := c.redacted()
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&out); err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	return enc.Close()
+}
+
+// redacted возвращает копию конфигурации, в которой скрыты значения полей с тегом secret.
+func (c *Config) redacted() Config {
+	out := *c
+	for _, s := range settings(&out) {
+		if s.secret == "" || s.value.String() == "" {
+			continue
+		}
+		switch s.secret {
+		case secretDSN:
+			s.value.SetString(redactDSN(s.value.String()))
+		default:
+			s.value.SetString(redactedValue)
+		}
+	}
+	return out
+}
+
+// dsnPassword находит пароль в DSN формата ключ=значение: password=secret или password='a b'.
+var dsnPassword = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// redactDSN скрывает пароль в строке подключения PostgreSQL в формате URL или ключ=значение.
+func redactDSN(dsn string) string {
+	if strings.Contains(dsn, "://") {
+		u, err := url.Parse(dsn)
+		if err != nil {
+			return redactedValue
+		}
+		return u.Redacted()
+	}
+	return dsnPassword.ReplaceAllString(dsn, "${1}xxxxx")
+}
+
+// setting — настраиваемое поле Config.
+type setting struct {
+	// key — путь по yaml-тегам, например database.dsn; он же имя флага.
+	key string
+	// secret — значение тега secret.
+	secret string
+	value  reflect.Value
+}
+
+// env возвращает имя переменной окружения: database.dsn → WB_DATABASE_DSN.
+func (s setting) env() string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(s.key, ".", "_"))
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// set разбирает raw и записывает значение в поле.
+func (s setting) set(raw string) error {
+	v := s.value
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		items := splitList(raw)
+		list := reflect.MakeSlice(v.Type(), len(items), len(items))
+		for i, item := range items {
+			list.Index(i).SetString(item)
+		}
+		v.Set(list)
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String && v.Type().Elem().Kind() == reflect.String:
+		m := reflect.MakeMap(v.Type())
+		for _, pair := range splitList(raw) {
+			key, val, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("expected key=value, got %q", pair)
+			}
+			m.SetMapIndex(
+				reflect.ValueOf(strings.TrimSpace(key)).Convert(v.Type().Key()),
+				reflect.ValueOf(strings.TrimSpace(val)).Convert(v.Type().Elem()),
+			)
+		}
+		v.Set(m)
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// splitList разбивает список через запятую, отбрасывая пустые элементы.
+func splitList(raw string) []string {
+	var out []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// settings возвращает настраиваемые поля cfg в порядке объявления.
+func settings(cfg *Config) []setting {
+	return appendSettings(nil, "", reflect.ValueOf(cfg).Elem())
+}
+
+func appendSettings(out []setting, prefix string, v reflect.Value) []setting {
+	t := v.Type()
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + name
+		if f.Type.Kind() == reflect.Struct {
+			out = appendSettings(out, key+".", v.Field(i))
+			continue
+		}
+		out = append(out, setting{key: key, secret: f.Tag.Get("secret"), value: v.Field(i)})
+	}
+	return out
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/validation"
+)
+
+func TestLoadLayers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `
+server:
+  port: 9000
+database:
+  dsn: postgres://file
+kafka:
+  topic: file-orders
+  workers: 2
+cache:
+  ttl: 1m
+`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	t.Setenv("CONFIG_PATH", path)
+	t.Setenv("WB_DATABASE_DSN", "postgres://env")
+	t.Setenv("WB_KAFKA_BROKERS", "kafka-1:9092, kafka-2:9092")
+	t.Setenv("WB_KAFKA_WORKERS", "8")
+	t.Setenv("WB_VALIDATION_RULES", "amount=warn")
+	t.Setenv("WB_TELEMETRY_TRACE_SAMPLE_RATIO", "0")
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg, err := Load(fs, []string{"--kafka.workers=16", "--cache.ttl", "2m", "--telemetry.traces_enabled=false"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{name: "default", got: cfg.Kafka.GroupID, want: "orders-consumer"},
+		{name: "file", got: cfg.Server.Port, want: 9000},
+		{name: "file without override", got: cfg.Kafka.Topic, want: "file-orders"},
+		{name: "env over file", got: cfg.Database.DSN, want: "postgres://env"},
+		{name: "env list", got: cfg.Kafka.Brokers, want: []string{"kafka-1:9092", "kafka-2:9092"}},
+		{name: "env map", got: cfg.Validation.Rules, want: validation.Rules{"amount": validation.ModeWarn}},
+		{name: "flag over env", got: cfg.Kafka.Workers, want: 16},
+		{name: "flag over file", got: cfg.Cache.TTL, want: 2 * time.Minute},
+		{name: "flag bool", got: cfg.Telemetry.TracesEnabled, want: false},
+		{name: "zero is kept", got: cfg.Telemetry.TraceSampleRatio, want: 0.0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, tt.got)
+			}
+		})
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	t.Setenv("CONFIG_PATH", "")
+	cfg, err := Load(nil, nil)
+	if err != nil {
+		t.Fatalf("missing default config file must be optional, got %v", err)
+	}
+	if cfg.Server.Port != 8080 {
+		t.Fatalf("expected default port, got %d", cfg.Server.Port)
+	}
+
+	t.Setenv("CONFIG_PATH", "missing.yaml")
+	if _, err := Load(nil, nil); err == nil {
+		t.Fatal("expected error for missing explicit config file")
+	}
+
+	t.Setenv("CONFIG_PATH", "")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	if _, err := Load(fs, []string{"--config", "missing.yaml"}); err == nil {
+		t.Fatal("expected error for missing config file from flag")
+	}
+}
+
+func TestLoadInvalidValues(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("CONFIG_PATH", "")
+
+	t.Run("env", func(t *testing.T) {
+		t.Setenv("WB_KAFKA_DLQ_BACKOFF", "soon")
+		_, err := Load(nil, nil)
+		if err == nil || !strings.Contains(err.Error(), "WB_KAFKA_DLQ_BACKOFF") {
+			t.Fatalf("expected error naming the variable, got %v", err)
+		}
+	})
+	t.Run("flag", func(t *testing.T) {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		if _, err := Load(fs, []string{"--server.port=http"}); err == nil {
+			t.Fatal("expected error for invalid flag value")
+		}
+	})
+	t.Run("map", func(t *testing.T) {
+		t.Setenv("WB_VALIDATION_RULES", "amount")
+		if _, err := Load(nil, nil); err == nil {
+			t.Fatal("expected error for rule without mode")
+		}
+	})
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		dsn     string
+		wantDSN string
+	}{
+		{name: "url", dsn: "postgres://user:secret@db:5432/orders", wantDSN: "postgres://user:xxxxx@db:5432/orders"},
+		{name: "key value", dsn: "host=db user=user password=secret dbname=orders", wantDSN: "host=db user=user password=xxxxx dbname=orders"},
+		{name: "quoted key value", dsn: "host=db password='se cret' dbname=orders", wantDSN: "host=db password=xxxxx dbname=orders"},
+		{name: "without password", dsn: "postgres://user@db/orders", wantDSN: "postgres://user@db/orders"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			cfg.Database.DSN = tt.dsn
+			cfg.Admin.Token = "token-secret"
+
+			var buf bytes.Buffer
+			if err := cfg.Print(&buf); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out := buf.String()
+			if strings.Contains(out, "secret") {
+				t.Fatalf("secret leaked into output:\n%s", out)
+			}
+			if !strings.Contains(out, "dsn: "+tt.wantDSN) || !strings.Contains(out, "token: '"+redactedValue+"'") {
+				t.Fatalf("unexpected output:\n%s", out)
+			}
+			if cfg.Admin.Token != "token-secret" || cfg.Database.DSN != tt.dsn {
+				t.Fatal("Print must not modify the config")
+			}
+		})
+	}
+}
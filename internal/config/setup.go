@@ -1,14 +1,20 @@
 package config
 
 import (
+	"github.com/RoGogDBD/wb/internal/logging"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 // SetupMiddlewares регистрирует общие HTTP-мидлвары.
-func SetupMiddlewares(r *chi.Mux) {
+// otelhttp подключается до журнала запросов, чтобы записи журнала содержали trace_id.
+func SetupMiddlewares(r *chi.Mux, telemetry TelemetryConfig) {
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Logger)
+	if telemetry.TracesEnabled || telemetry.MetricsEnabled {
+		r.Use(otelhttp.NewMiddleware("http-server"))
+	}
+	r.Use(logging.AccessLog)
 	r.Use(middleware.Recoverer)
 }
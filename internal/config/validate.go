@@ -0,0 +1,119 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/RoGogDBD/wb/internal/logging"
+)
+
+// Validate проверяет конфигурацию и возвращает *ValidationError со всеми найденными
+// проблемами или nil. Нулевые значения, которые normalizeConfig заменяет значениями
+// по умолчанию, Validate не проверяет, поэтому вызывается после нормализации.
+func (c *Config) Validate() error {
+	var l errorList
+
+	if c.Server.Port < 1 || c.Server.Port > 65535 {
+		l.add("server.port", "must be between 1 and 65535, got %d", c.Server.Port)
+	}
+	l.nonNegative("server.read_timeout", c.Server.ReadTimeout)
+	l.nonNegative("server.write_timeout", c.Server.WriteTimeout)
+	l.nonNegative("server.idle_timeout", c.Server.IdleTimeout)
+
+	if c.Database.Driver != DriverPostgres && c.Database.Driver != DriverMemory {
+		l.add("database.driver", "unknown driver %q (known: %s, %s)", c.Database.Driver, DriverPostgres, DriverMemory)
+	}
+	l.nonNegative("database.ledger_prune_interval", c.Database.LedgerPruneInterval)
+	// при нулевом сроке хранения очистка удаляла бы весь журнал и отключала защиту от повторов
+	if c.Database.LedgerPruneInterval > 0 && c.Database.LedgerRetention <= 0 {
+		l.add("database.ledger_retention", "must be positive when database.ledger_prune_interval is set, got %s", c.Database.LedgerRetention)
+	} else {
+		l.nonNegative("database.ledger_retention", c.Database.LedgerRetention)
+	}
+
+	c.Kafka.validate(&l)
+
+	l.nonNegativeInt("cache.max_items", c.Cache.MaxItems)
+	l.nonNegative("cache.ttl", c.Cache.TTL)
+	l.nonNegative("cache.cleanup_interval", c.Cache.CleanupInterval)
+
+	if r := c.Telemetry.TraceSampleRatio; r < 0 || r > 1 {
+		l.add("telemetry.trace_sample_ratio", "must be between 0 and 1, got %g", r)
+	}
+	if !strings.HasPrefix(c.Telemetry.MetricsPath, "/") {
+		l.add("telemetry.metrics_path", "must start with /, got %q", c.Telemetry.MetricsPath)
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Logging.Level)); err != nil {
+		l.add("logging.level", "unknown level %q (known: debug, info, warn, error)", c.Logging.Level)
+	}
+	if f := strings.ToLower(c.Logging.Format); f != logging.FormatText && f != logging.FormatJSON {
+		l.add("logging.format", "unknown format %q (known: %s, %s)", c.Logging.Format, logging.FormatText, logging.FormatJSON)
+	}
+
+	l.check("validation.rules", c.Validation.Rules.Check())
+	return l.err()
+}
+
+func (k *KafkaConfig) validate(l *errorList) {
+	if len(k.Brokers) == 0 {
+		l.add("kafka.brokers", "must not be empty")
+	}
+	for i, broker := range k.Brokers {
+		if err := checkBroker(broker); err != nil {
+			l.add(fmt.Sprintf("kafka.brokers[%d]", i), "%s", err)
+		}
+	}
+
+	if k.Topic == "" {
+		l.add("kafka.topic", "must not be empty")
+	}
+	if k.GroupID == "" {
+		l.add("kafka.group_id", "must not be empty")
+	}
+	if k.Topic != "" && k.DLQTopic == k.Topic {
+		l.add("kafka.dlq_topic", "must differ from kafka.topic %q", k.Topic)
+	}
+	if k.Topic != "" && k.OutboxTopic == k.Topic {
+		l.add("kafka.outbox_topic", "must differ from kafka.topic %q", k.Topic)
+	}
+	if k.OutboxTopic != "" && k.DLQTopic == k.OutboxTopic {
+		l.add("kafka.dlq_topic", "must differ from kafka.outbox_topic %q", k.OutboxTopic)
+	}
+
+	l.nonNegativeInt("kafka.dlq_max_retries", k.DLQMaxRetries)
+	l.nonNegativeInt("kafka.dlq_max_replays", k.DLQMaxReplays)
+	l.nonNegativeInt("kafka.workers", k.Workers)
+	l.nonNegativeInt("kafka.batch_size", k.BatchSize)
+	l.nonNegativeInt("kafka.outbox_batch_size", k.OutboxBatchSize)
+	if k.ConsumerMaxRestarts < -1 {
+		l.add("kafka.consumer_max_restarts", "must be -1 (unlimited) or greater, got %d", k.ConsumerMaxRestarts)
+	}
+
+	l.nonNegative("kafka.dlq_backoff", k.DLQBackoff)
+	l.nonNegative("kafka.dlq_backoff_cap", k.DLQBackoffCap)
+	l.nonNegative("kafka.commit_interval", k.CommitInterval)
+	l.nonNegative("kafka.batch_timeout", k.BatchTimeout)
+	l.nonNegative("kafka.outbox_poll_interval", k.OutboxPollInterval)
+	l.nonNegative("kafka.consumer_restart_backoff", k.ConsumerRestartBackoff)
+	l.nonNegative("kafka.consumer_restart_backoff_cap", k.ConsumerRestartBackoffCap)
+}
+
+// checkBroker проверяет, что адрес брокера задан в формате host:port.
+func checkBroker(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid broker address %q: expected host:port", addr)
+	}
+	if host == "" {
+		return fmt.Errorf("invalid broker address %q: empty host", addr)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid broker address %q: bad port %q", addr, port)
+	}
+	return nil
+}
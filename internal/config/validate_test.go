@@ -0,0 +1,153 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/validation"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		modify     func(*Config)
+		wantFields []string
+	}{
+		{name: "defaults", modify: func(*Config) {}},
+		{
+			name:       "negative ttl",
+			modify:     func(c *Config) { c.Cache.TTL = -time.Minute },
+			wantFields: []string{"cache.ttl"},
+		},
+		{
+			name:       "sample ratio above one",
+			modify:     func(c *Config) { c.Telemetry.TraceSampleRatio = 2 },
+			wantFields: []string{"telemetry.trace_sample_ratio"},
+		},
+		{
+			name:       "zero ledger retention with pruning",
+			modify:     func(c *Config) { c.Database.LedgerRetention = 0 },
+			wantFields: []string{"database.ledger_retention"},
+		},
+		{
+			name: "zero ledger retention without pruning",
+			modify: func(c *Config) {
+				c.Database.LedgerRetention = 0
+				c.Database.LedgerPruneInterval = 0
+			},
+		},
+		{
+			name:       "invalid brokers",
+			modify:     func(c *Config) { c.Kafka.Brokers = []string{"localhost", ":9092", "kafka:port", "kafka:9092"} },
+			wantFields: []string{"kafka.brokers[0]", "kafka.brokers[1]", "kafka.brokers[2]"},
+		},
+		{
+			name:       "no brokers",
+			modify:     func(c *Config) { c.Kafka.Brokers = nil },
+			wantFields: []string{"kafka.brokers"},
+		},
+		{
+			name:       "empty topic",
+			modify:     func(c *Config) { c.Kafka.Topic = "" },
+			wantFields: []string{"kafka.topic"},
+		},
+		{
+			name:       "dlq topic equals topic",
+			modify:     func(c *Config) { c.Kafka.DLQTopic = c.Kafka.Topic },
+			wantFields: []string{"kafka.dlq_topic"},
+		},
+		{
+			name:       "dlq topic equals outbox topic",
+			modify:     func(c *Config) { c.Kafka.DLQTopic = c.Kafka.OutboxTopic },
+			wantFields: []string{"kafka.dlq_topic"},
+		},
+		{
+			name:   "outbox disabled",
+			modify: func(c *Config) { c.Kafka.OutboxTopic = "" },
+		},
+		{
+			name: "all problems at once",
+			modify: func(c *Config) {
+				c.Server.Port = 70000
+				c.Database.Driver = "mysql"
+				c.Kafka.Workers = -1
+				c.Kafka.ConsumerMaxRestarts = -2
+				c.Logging.Level = "verbose"
+				c.Validation.Rules = validation.Rules{"unknown": validation.ModeStrict}
+			},
+			wantFields: []string{
+				"server.port", "database.driver", "kafka.workers",
+				"kafka.consumer_max_restarts", "logging.level", "validation.rules",
+			},
+		},
+		{
+			name:   "unlimited consumer restarts",
+			modify: func(c *Config) { c.Kafka.ConsumerMaxRestarts = -1 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			tt.modify(&cfg)
+			normalizeConfig(&cfg)
+
+			err := cfg.Validate()
+			if len(tt.wantFields) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected *ValidationError, got %v", err)
+			}
+			var fields []string
+			for _, fe := range verr.Errors {
+				fields = append(fields, fe.Field)
+			}
+			if !slices.Equal(fields, tt.wantFields) {
+				t.Fatalf("expected problems in %v, got %v", tt.wantFields, err)
+			}
+
+			var fe *FieldError
+			if !errors.As(err, &fe) || fe.Field != tt.wantFields[0] {
+				t.Fatalf("expected errors.As to find the first *FieldError, got %v", fe)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("kafka:\n  topik: orders\n"), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	t.Setenv("CONFIG_PATH", path)
+
+	_, err := Load(nil, nil)
+	if err == nil || !strings.Contains(err.Error(), "topik") {
+		t.Fatalf("expected error naming the unknown key, got %v", err)
+	}
+}
+
+func TestLoadValidates(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("CONFIG_PATH", "")
+	t.Setenv("WB_CACHE_TTL", "-1m")
+	t.Setenv("WB_KAFKA_TOPIC", "orders")
+	t.Setenv("WB_KAFKA_DLQ_TOPIC", "orders")
+
+	_, err := Load(nil, nil)
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Errors) != 2 {
+		t.Fatalf("expected two validation problems, got %v", err)
+	}
+}
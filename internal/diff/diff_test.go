@@ -0,0 +1,60 @@
+package diff
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestJSON(t *testing.T) {
+	type item struct {
+		Name  string  `json:"name"`
+		Price float64 `json:"price"`
+	}
+	type order struct {
+		ID    string `json:"id"`
+		Total int    `json:"total"`
+		Items []item `json:"items"`
+	}
+
+	tests := []struct {
+		name     string
+		from, to any
+		want     []Change
+	}{
+		{
+			name: "equal",
+			from: order{ID: "a", Items: []item{{Name: "x"}}},
+			to:   order{ID: "a", Items: []item{{Name: "x"}}},
+			want: []Change{},
+		},
+		{
+			name: "nested field and added item",
+			from: order{ID: "a", Total: 10, Items: []item{{Name: "x", Price: 1.5}}},
+			to:   order{ID: "a", Total: 12, Items: []item{{Name: "x", Price: 2}, {Name: "y"}}},
+			want: []Change{
+				{Path: "items[0].price", From: json.Number("1.5"), To: json.Number("2")},
+				{Path: "items[1]", From: nil, To: map[string]any{"name": "y", "price": json.Number("0")}},
+				{Path: "total", From: json.Number("10"), To: json.Number("12")},
+			},
+		},
+		{
+			name: "removed key",
+			from: map[string]any{"a": 1, "b": true},
+			to:   map[string]any{"a": 1},
+			want: []Change{{Path: "b", From: true, To: nil}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := JSON(tt.from, tt.to)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
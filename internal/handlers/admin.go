@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/kafka"
+	"github.com/RoGogDBD/wb/internal/logging"
+)
+
+const (
+	defaultDLQListLimit = 100
+	maxDLQListLimit     = 1000
+	// headerDLQScanStoppedAfter — идентификатор последнего прочитанного сообщения DLQ,
+	// если чтение топика прервано и ответ содержит только часть результатов.
+	headerDLQScanStoppedAfter = "X-DLQ-Scan-Stopped-After"
+)
+
+// DLQService описывает операции с DLQ, доступные через административный API.
+type DLQService interface {
+	List(ctx context.Context, filter kafka.DLQFilter) ([]kafka.DLQMessage, error)
+	Replay(ctx context.Context, req kafka.ReplayRequest) ([]kafka.ReplayResult, error)
+}
+
+// AdminHandler содержит административные HTTP-обработчики.
+type AdminHandler struct {
+	dlq DLQService
+}
+
+// NewAdminHandler создает новый AdminHandler.
+func NewAdminHandler(dlq DLQService) *AdminHandler {
+	return &AdminHandler{dlq: dlq}
+}
+
+// AdminAuth пропускает только запросы с заголовком "Authorization: Bearer <token>".
+func AdminAuth(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// DLQListHandler возвращает сообщения из DLQ.
+// @Summary Список сообщений DLQ
+// @Description Возвращает сообщения из DLQ с разобранными заголовками и содержимым
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param stage query string false "Этап ошибки (unmarshal, validation, db)"
+// @Param error query string false "Подстрока текста ошибки"
+// @Param rule query string false "Нарушенное правило валидации (например, required, goods_total)"
+// @Param from query string false "Начало интервала (RFC3339)"
+// @Param to query string false "Конец интервала (RFC3339)"
+// @Param limit query int false "Максимальное число сообщений" default(100)
+// @Success 200 {array} kafka.DLQMessage "Сообщения DLQ"
+// @Header 200 {string} X-DLQ-Scan-Stopped-After "Чтение DLQ прервано после этого сообщения, список неполный"
+// @Failure 400 {string} string "Некорректные параметры фильтра"
+// @Failure 401 {string} string "Нет доступа"
+// @Failure 500 {string} string "Внутренняя ошибка сервера"
+// @Router /admin/dlq [get]
+func (h *AdminHandler) DLQListHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseDLQFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	msgs, err := h.dlq.List(r.Context(), filter)
+	if err != nil && !partialScan(w, r, err) {
+		slog.ErrorContext(r.Context(), "dlq list error", logging.Err(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, msgs)
+}
+
+// DLQReplayHandler переотправляет сообщения из DLQ.
+// @Summary Переотправка сообщений DLQ
+// @Description Переотправляет выбранные или все подходящие под фильтр сообщения в основной топик или напрямую в хранилище
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param stage query string false "Этап ошибки (unmarshal, validation, db)"
+// @Param error query string false "Подстрока текста ошибки"
+// @Param rule query string false "Нарушенное правило валидации (например, required, goods_total)"
+// @Param from query string false "Начало интервала (RFC3339)"
+// @Param to query string false "Конец интервала (RFC3339)"
+// @Param request body kafka.ReplayRequest true "Параметры переотправки"
+// @Success 200 {array} kafka.ReplayResult "Результаты по сообщениям"
+// @Header 200 {string} X-DLQ-Scan-Stopped-After "Чтение DLQ прервано после этого сообщения, переотправлена только часть"
+// @Failure 400 {string} string "Некорректный запрос"
+// @Failure 401 {string} string "Нет доступа"
+// @Failure 500 {string} string "Внутренняя ошибка сервера"
+// @Router /admin/dlq/replay [post]
+func (h *AdminHandler) DLQReplayHandler(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseDLQFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req kafka.ReplayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if !req.All && len(req.IDs) == 0 {
+		http.Error(w, "Either ids or all must be set", http.StatusBadRequest)
+		return
+	}
+	if req.Target != "" && req.Target != kafka.ReplayToTopic && req.Target != kafka.ReplayToStore {
+		http.Error(w, "Invalid target", http.StatusBadRequest)
+		return
+	}
+	req.Filter = filter
+
+	results, err := h.dlq.Replay(r.Context(), req)
+	if err != nil && !partialScan(w, r, err) {
+		slog.ErrorContext(r.Context(), "dlq replay error", logging.Err(err))
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// partialScan сообщает, что err — прерванное после хотя бы одного сообщения чтение DLQ,
+// и тогда отмечает ответ как неполный заголовком X-DLQ-Scan-Stopped-After.
+func partialScan(w http.ResponseWriter, r *http.Request, err error) bool {
+	var scanErr *kafka.ScanError
+	if !errors.As(err, &scanErr) || scanErr.LastID == "" {
+		return false
+	}
+	slog.WarnContext(r.Context(), "dlq scan stopped, returning partial results", "last_id", scanErr.LastID, logging.Err(err))
+	w.Header().Set(headerDLQScanStoppedAfter, scanErr.LastID)
+	return true
+}
+
+// parseDLQFilter разбирает параметры фильтра DLQ из строки запроса.
+func parseDLQFilter(r *http.Request) (kafka.DLQFilter, error) {
+	q := r.URL.Query()
+	filter := kafka.DLQFilter{
+		Stage:         q.Get("stage"),
+		ErrorContains: q.Get("error"),
+		Rule:          q.Get("rule"),
+		Limit:         defaultDLQListLimit,
+	}
+
+	var err error
+	if filter.From, err = parseTimeParam(q.Get("from")); err != nil {
+		return filter, fmt.Errorf("invalid from parameter: %w", err)
+	}
+	if filter.To, err = parseTimeParam(q.Get("to")); err != nil {
+		return filter, fmt.Errorf("invalid to parameter: %w", err)
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return filter, fmt.Errorf("invalid limit parameter")
+		}
+		filter.Limit = min(limit, maxDLQListLimit)
+	}
+	return filter, nil
+}
+
+func parseTimeParam(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+// writeJSON записывает v в ответ в формате JSON.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("response encode error", logging.Err(err))
+	}
+}
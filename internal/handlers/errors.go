@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/RoGogDBD/wb/internal/repository"
+	"github.com/RoGogDBD/wb/internal/validation"
+)
+
+// errorStatus сопоставляет доменную ошибку хранилища с HTTP-статусом и текстом ответа.
+func errorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		return http.StatusNotFound, "Order not found"
+	case errors.Is(err, repository.ErrInvalidCursor):
+		return http.StatusBadRequest, "Invalid cursor parameter"
+	case errors.Is(err, repository.ErrConflict):
+		return http.StatusConflict, "Conflict"
+	case errors.Is(err, repository.ErrStale):
+		return http.StatusConflict, "A newer version of the order already exists"
+	case errors.Is(err, repository.ErrUnavailable):
+		return http.StatusServiceUnavailable, "Service unavailable"
+	default:
+		return http.StatusInternalServerError, "Internal server error"
+	}
+}
+
+// writeError отвечает статусом и текстом, соответствующими ошибке err.
+// Ошибка валидации заказа возвращается как отчет о нарушениях в JSON со статусом 422.
+func writeError(w http.ResponseWriter, err error) {
+	var report *validation.Report
+	if errors.As(err, &report) {
+		writeJSON(w, http.StatusUnprocessableEntity, report)
+		return
+	}
+	status, msg := errorStatus(err)
+	http.Error(w, msg, status)
+}
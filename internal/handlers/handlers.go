@@ -4,13 +4,18 @@ package handlers
 import (
 	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
 
+	"github.com/RoGogDBD/wb/internal/logging"
 	"github.com/RoGogDBD/wb/internal/repository"
+	"github.com/RoGogDBD/wb/internal/telemetry"
 	"github.com/RoGogDBD/wb/internal/validation"
 	"github.com/go-chi/chi/v5"
-	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 )
 
 // Handler содержит HTTP-обработчики и их зависимости.
@@ -18,31 +23,28 @@ type Handler struct {
 	cacheReader repository.CacheReader
 	cacheWriter repository.CacheWriter
 	pgStorage   repository.OrderStore
+	history     repository.OrderHistory
+	dbFallbacks metric.Int64Counter
 }
 
+// meterName — имя инструментирования метрик HTTP-обработчиков.
+const meterName = "github.com/RoGogDBD/wb/internal/handlers"
+
 var validate = validation.MustNew()
 
 // NewHandler создает новый Handler.
+// История заказов доступна, если pgStorage реализует repository.OrderHistory.
 func NewHandler(cacheReader repository.CacheReader, cacheWriter repository.CacheWriter, pgStorage repository.OrderStore) *Handler {
-	return &Handler{
+	h := &Handler{
 		cacheReader: cacheReader,
 		cacheWriter: cacheWriter,
 		pgStorage:   pgStorage,
+		dbFallbacks: telemetry.Int64Counter(meterName, "orders.cache_fallbacks", "Order lookups served from the database after a cache miss", "{request}"),
 	}
-}
-
-// HealthHandler отвечает OK на проверку здоровья.
-// @Summary Проверка работоспособности сервера
-// @Description Возвращает статус 200 OK и тело "OK", если сервер работает
-// @Tags health
-// @Produce plain
-// @Success 200 {string} string "OK"
-// @Router /healthz [get]
-func (h *Handler) HealthHandler(w http.ResponseWriter, _ *http.Request) {
-	w.WriteHeader(http.StatusOK)
-	if _, err := w.Write([]byte("OK")); err != nil {
-		log.Printf("health response write error: %v", err)
+	if history, ok := pgStorage.(repository.OrderHistory); ok {
+		h.history = history
 	}
+	return h
 }
 
 // OrderHandler возвращает заказ по идентификатору.
@@ -56,6 +58,7 @@ func (h *Handler) HealthHandler(w http.ResponseWriter, _ *http.Request) {
 // @Failure 400 {string} string "Отсутствует параметр ID"
 // @Failure 404 {string} string "Заказ не найден"
 // @Failure 500 {string} string "Внутренняя ошибка сервера"
+// @Failure 503 {string} string "База данных недоступна"
 // @Router /order/{order_uid} [get]
 func (h *Handler) OrderHandler(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "order_uid")
@@ -69,35 +72,123 @@ func (h *Handler) OrderHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Сначала пытаемся получить из кеша
+	ctx := logging.With(r.Context(), "order_uid", id)
 	order, err := h.cacheReader.GetByID(id)
 	if err != nil {
 		// Если не найден в кеше и есть доступ к БД, пытаемся получить из БД
 		if h.pgStorage != nil {
-			log.Printf("Order %s not found in cache, checking database", id)
-			order, err = h.pgStorage.GetOrderByID(r.Context(), id)
+			slog.DebugContext(ctx, "order not found in cache, checking database")
+			order, err = h.pgStorage.GetOrderByID(ctx, id)
+			result := "found"
+			switch {
+			case errors.Is(err, repository.ErrNotFound):
+				result = "not_found"
+			case err != nil:
+				result = "error"
+			}
+			h.dbFallbacks.Add(ctx, 1, metric.WithAttributes(attribute.String("result", result)))
 			if err != nil {
-				if errors.Is(err, pgx.ErrNoRows) {
-					log.Printf("Order %s not found in database", id)
-					http.Error(w, "Order not found", http.StatusNotFound)
+				if errors.Is(err, repository.ErrNotFound) {
+					slog.DebugContext(ctx, "order not found in database")
 				} else {
-					log.Printf("Order %s database error: %v", id, err)
-					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					slog.ErrorContext(ctx, "order database error", logging.Err(err))
 				}
+				writeError(w, err)
 				return
 			}
 
 			// Сохраняем в кеш для последующих запросов
 			h.cacheWriter.Save(order)
-			log.Printf("Order %s loaded from DB and cached", id)
+			slog.DebugContext(ctx, "order loaded from database and cached")
 		} else {
-			http.Error(w, "Order not found", http.StatusNotFound)
+			writeError(w, repository.ErrNotFound)
 			return
 		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(order); err != nil {
-		log.Printf("order response encode error: %v", err)
+		slog.ErrorContext(ctx, "order response encode error", logging.Err(err))
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 	}
 }
+
+// OrderListHandler возвращает страницу заказов по фильтру.
+// @Summary Список заказов
+// @Description Возвращает заказы от новых к старым с курсорной пагинацией по (date_created, order_uid)
+// @Tags orders
+// @Produce json
+// @Param customer_id query string false "Идентификатор покупателя"
+// @Param track_number query string false "Трек-номер"
+// @Param delivery_service query string false "Служба доставки"
+// @Param entry query string false "Точка входа"
+// @Param locale query string false "Локаль"
+// @Param currency query string false "Валюта оплаты"
+// @Param created_from query string false "Создан не раньше (RFC3339)"
+// @Param created_to query string false "Создан раньше (RFC3339)"
+// @Param cursor query string false "Курсор следующей страницы из next_cursor"
+// @Param limit query int false "Размер страницы (не больше 500)" default(50)
+// @Success 200 {object} repository.OrderPage "Страница заказов"
+// @Failure 400 {string} string "Некорректные параметры запроса"
+// @Failure 500 {string} string "Внутренняя ошибка сервера"
+// @Failure 503 {string} string "База данных недоступна"
+// @Router /orders [get]
+func (h *Handler) OrderListHandler(w http.ResponseWriter, r *http.Request) {
+	if h.pgStorage == nil {
+		http.Error(w, "Database unavailable", http.StatusServiceUnavailable)
+		return
+	}
+
+	filter, err := parseOrderFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.pgStorage.ListOrders(r.Context(), filter)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "list orders error", logging.Err(err))
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// parseOrderFilter разбирает параметры списка заказов из строки запроса.
+func parseOrderFilter(r *http.Request) (repository.OrderFilter, error) {
+	q := r.URL.Query()
+	filter := repository.OrderFilter{
+		CustomerID:      q.Get("customer_id"),
+		TrackNumber:     q.Get("track_number"),
+		DeliveryService: q.Get("delivery_service"),
+		Entry:           q.Get("entry"),
+		Locale:          q.Get("locale"),
+		Currency:        q.Get("currency"),
+		Cursor:          q.Get("cursor"),
+		Limit:           repository.DefaultListLimit,
+	}
+
+	var err error
+	if filter.CreatedFrom, err = parseTimeParam(q.Get("created_from")); err != nil {
+		return filter, fmt.Errorf("invalid created_from parameter: %w", err)
+	}
+	if filter.CreatedTo, err = parseTimeParam(q.Get("created_to")); err != nil {
+		return filter, fmt.Errorf("invalid created_to parameter: %w", err)
+	}
+	if !filter.CreatedFrom.IsZero() && !filter.CreatedTo.IsZero() && !filter.CreatedFrom.Before(filter.CreatedTo) {
+		return filter, fmt.Errorf("created_from must be before created_to")
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > repository.MaxListLimit {
+			return filter, fmt.Errorf("invalid limit parameter")
+		}
+		filter.Limit = limit
+	}
+	if filter.Cursor != "" {
+		if _, err := repository.DecodeCursor(filter.Cursor); err != nil {
+			return filter, fmt.Errorf("invalid cursor parameter")
+		}
+	}
+	return filter, nil
+}
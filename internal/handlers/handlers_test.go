@@ -1,16 +1,24 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/RoGogDBD/wb/internal/config"
+	"github.com/RoGogDBD/wb/internal/health"
+	"github.com/RoGogDBD/wb/internal/ingest"
 	"github.com/RoGogDBD/wb/internal/models"
+	"github.com/RoGogDBD/wb/internal/repository"
 	"github.com/RoGogDBD/wb/internal/repository/mocks"
+	"github.com/RoGogDBD/wb/internal/validation"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 )
@@ -43,7 +51,7 @@ func TestOrderHandler(t *testing.T) {
 			orderID: testOrder().OrderUID,
 			cache: &mocks.CacheMock{
 				GetByIDFunc: func(_ string) (*models.Order, error) {
-					return nil, errors.New("not found")
+					return nil, repository.ErrNotFound
 				},
 			},
 			store: &mocks.OrderStoreMock{
@@ -55,12 +63,52 @@ func TestOrderHandler(t *testing.T) {
 			wantCacheSave:   1,
 			wantOrderInBody: true,
 		},
+		{
+			name:    "not found anywhere",
+			orderID: testOrder().OrderUID,
+			cache: &mocks.CacheMock{
+				GetByIDFunc: func(_ string) (*models.Order, error) {
+					return nil, repository.ErrNotFound
+				},
+			},
+			store: &mocks.OrderStoreMock{
+				GetOrderByIDFunc: func(_ context.Context, _ string) (*models.Order, error) {
+					return nil, fmt.Errorf("get order: %w", repository.ErrNotFound)
+				},
+			},
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			name:    "database unavailable",
+			orderID: testOrder().OrderUID,
+			cache: &mocks.CacheMock{
+				GetByIDFunc: func(_ string) (*models.Order, error) {
+					return nil, repository.ErrNotFound
+				},
+			},
+			store: &mocks.OrderStoreMock{
+				GetOrderByIDFunc: func(_ context.Context, _ string) (*models.Order, error) {
+					return nil, repository.ErrUnavailable
+				},
+			},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:    "cache miss without database",
+			orderID: testOrder().OrderUID,
+			cache: &mocks.CacheMock{
+				GetByIDFunc: func(_ string) (*models.Order, error) {
+					return nil, repository.ErrNotFound
+				},
+			},
+			wantStatus: http.StatusNotFound,
+		},
 		{
 			name:    "invalid id",
 			orderID: "not-a-uuid",
 			cache: &mocks.CacheMock{
 				GetByIDFunc: func(_ string) (*models.Order, error) {
-					return nil, errors.New("not found")
+					return nil, repository.ErrNotFound
 				},
 			},
 			wantStatus:      http.StatusBadRequest,
@@ -71,7 +119,12 @@ func TestOrderHandler(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			h := NewHandler(tt.cache, tt.cache, tt.store)
+			// без хранилища обработчик должен получить nil-интерфейс, а не nil-указатель
+			var store repository.OrderStore
+			if tt.store != nil {
+				store = tt.store
+			}
+			h := NewHandler(tt.cache, tt.cache, store)
 
 			r := chi.NewRouter()
 			r.Get("/order/{order_uid}", h.OrderHandler)
@@ -99,6 +152,145 @@ func TestOrderHandler(t *testing.T) {
 	}
 }
 
+func TestOrderListHandler(t *testing.T) {
+	next := repository.EncodeCursor(testOrder())
+	tests := []struct {
+		name       string
+		query      string
+		store      *mocks.OrderStoreMock
+		wantStatus int
+		wantFilter repository.OrderFilter
+	}{
+		{
+			name:       "filters and cursor",
+			query:      "?customer_id=c1&currency=USD&created_from=2025-01-01T00:00:00Z&limit=10&cursor=" + next,
+			wantStatus: http.StatusOK,
+			wantFilter: repository.OrderFilter{
+				CustomerID:  "c1",
+				Currency:    "USD",
+				CreatedFrom: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+				Cursor:      next,
+				Limit:       10,
+			},
+		},
+		{
+			name:       "default limit",
+			wantStatus: http.StatusOK,
+			wantFilter: repository.OrderFilter{Limit: repository.DefaultListLimit},
+		},
+		{name: "limit too large", query: "?limit=1000", wantStatus: http.StatusBadRequest},
+		{name: "invalid date", query: "?created_to=yesterday", wantStatus: http.StatusBadRequest},
+		{name: "empty range", query: "?created_from=2025-01-02T00:00:00Z&created_to=2025-01-01T00:00:00Z", wantStatus: http.StatusBadRequest},
+		{name: "invalid cursor", query: "?cursor=%21%21", wantStatus: http.StatusBadRequest},
+		{
+			name:  "store error",
+			query: "",
+			store: &mocks.OrderStoreMock{
+				ListOrdersFunc: func(_ context.Context, _ repository.OrderFilter) (*repository.OrderPage, error) {
+					return nil, errors.New("db down")
+				},
+			},
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got repository.OrderFilter
+			store := tt.store
+			if store == nil {
+				store = &mocks.OrderStoreMock{
+					ListOrdersFunc: func(_ context.Context, f repository.OrderFilter) (*repository.OrderPage, error) {
+						got = f
+						return &repository.OrderPage{Orders: []models.Order{*testOrder()}, NextCursor: next}, nil
+					},
+				}
+			}
+			h := NewHandler(&mocks.CacheMock{}, &mocks.CacheMock{}, store)
+
+			req := httptest.NewRequest(http.MethodGet, "/orders"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			h.OrderListHandler(rr, req)
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("unexpected status: %d (%s)", rr.Code, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.wantFilter) {
+				t.Fatalf("unexpected filter: %+v", got)
+			}
+			var page repository.OrderPage
+			if err := json.NewDecoder(rr.Body).Decode(&page); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if len(page.Orders) != 1 || page.NextCursor != next {
+				t.Fatalf("unexpected page: %+v", page)
+			}
+		})
+	}
+}
+
+func TestOrderDiffHandler(t *testing.T) {
+	id := testOrder().OrderUID
+	versionOf := func(n int) *repository.OrderVersion {
+		o := testOrderWithID(id)
+		o.DateCreated = time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+		o.Payment.PaymentDt = 1735689600
+		o.Payment.Amount = 100 * n
+		return &repository.OrderVersion{OrderUID: id, Version: n, Order: *o}
+	}
+	store := &mocks.OrderStoreMock{
+		GetOrderVersionFunc: func(_ context.Context, _ string, version int) (*repository.OrderVersion, error) {
+			if version > 2 {
+				return nil, repository.ErrNotFound
+			}
+			return versionOf(version), nil
+		},
+	}
+
+	tests := []struct {
+		name        string
+		query       string
+		wantStatus  int
+		wantChanges int
+	}{
+		{name: "changed amount", query: "?from=1&to=2", wantStatus: http.StatusOK, wantChanges: 1},
+		{name: "same version", query: "?from=2&to=2", wantStatus: http.StatusOK, wantChanges: 0},
+		{name: "missing version", query: "?from=1&to=3", wantStatus: http.StatusNotFound},
+		{name: "missing params", query: "?from=1", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(&mocks.CacheMock{}, &mocks.CacheMock{}, store)
+			r := chi.NewRouter()
+			r.Get("/order/{order_uid}/diff", h.OrderDiffHandler)
+
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/order/"+id+"/diff"+tt.query, nil))
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("unexpected status: %d (%s)", rr.Code, rr.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var got OrderDiff
+			if err := json.NewDecoder(rr.Body).Decode(&got); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if len(got.Changes) != tt.wantChanges {
+				t.Fatalf("expected %d changes, got %+v", tt.wantChanges, got.Changes)
+			}
+			if tt.wantChanges == 1 && got.Changes[0].Path != "payment.amount" {
+				t.Fatalf("unexpected change: %+v", got.Changes[0])
+			}
+		})
+	}
+}
+
 func testOrder() *models.Order {
 	id := uuid.New().String()
 	return testOrderWithID(id)
@@ -133,12 +325,12 @@ func testOrderWithID(id string) *models.Order {
 			{
 				ChrtID:      1,
 				TrackNumber: "TRACK-" + id[:8],
-				Price:       50,
+				Price:       90,
 				Rid:         "rid",
 				Name:        "item",
 				Sale:        0,
 				Size:        "0",
-				TotalPrice:  50,
+				TotalPrice:  90,
 				NmID:        1,
 				Brand:       "brand",
 				Status:      202,
@@ -153,3 +345,218 @@ func testOrderWithID(id string) *models.Order {
 		OofShard:        "1",
 	}
 }
+
+func TestWriteErrorValidationReport(t *testing.T) {
+	report := &validation.Report{Violations: []validation.Violation{
+		{Field: "items[2].nm_id", Rule: "gt", Param: "0", Value: 0},
+	}}
+	rec := httptest.NewRecorder()
+	writeError(rec, fmt.Errorf("decode order: %w", report))
+
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status %d, got %d", http.StatusUnprocessableEntity, rec.Code)
+	}
+	var got validation.Report
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got.Violations) != 1 || got.Violations[0].Field != "items[2].nm_id" || got.Violations[0].Rule != "gt" {
+		t.Fatalf("unexpected report: %+v", got)
+	}
+}
+
+func TestCreateOrdersHandler(t *testing.T) {
+	invalid := testOrder()
+	invalid.Payment.GoodsTotal = 1
+
+	tests := []struct {
+		name         string
+		body         []byte
+		store        repository.OrderStore
+		wantStatus   int
+		wantStatuses []ingest.Status
+		// wantViolations — индексы заказов, для которых ожидается отчет о нарушениях
+		wantViolations []int
+	}{
+		{
+			name:         "single order",
+			body:         mustMarshal(t, testOrder()),
+			wantStatus:   http.StatusOK,
+			wantStatuses: []ingest.Status{ingest.StatusStored},
+		},
+		{
+			name:           "array with invalid order",
+			body:           mustMarshal(t, []*models.Order{testOrder(), invalid}),
+			wantStatus:     http.StatusOK,
+			wantStatuses:   []ingest.Status{ingest.StatusStored, ingest.StatusInvalid},
+			wantViolations: []int{1},
+		},
+		{
+			name:           "only invalid orders",
+			body:           mustMarshal(t, []any{invalid, "order"}),
+			wantStatus:     http.StatusUnprocessableEntity,
+			wantStatuses:   []ingest.Status{ingest.StatusInvalid, ingest.StatusInvalid},
+			wantViolations: []int{0},
+		},
+		{
+			name: "store unavailable",
+			body: mustMarshal(t, testOrder()),
+			store: &mocks.OrderStoreMock{
+				InsertOrderFunc: func(_ context.Context, _ *models.Order) error {
+					return repository.ErrUnavailable
+				},
+			},
+			wantStatus:   http.StatusServiceUnavailable,
+			wantStatuses: []ingest.Status{ingest.StatusFailed},
+		},
+		{
+			name:       "empty array",
+			body:       []byte("[]"),
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "malformed body",
+			body:       []byte(`{"order_uid":`),
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := tt.store
+			if store == nil {
+				store = repository.NewMemoryOrderStore()
+			}
+			h := NewIngestHandler(ingest.NewPipeline(config.KafkaConfig{}, validation.MustNewOrderValidator(nil), store, &mocks.CacheMock{}))
+
+			rec := httptest.NewRecorder()
+			h.CreateOrdersHandler(rec, httptest.NewRequest(http.MethodPost, "/orders", bytes.NewReader(tt.body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if tt.wantStatuses == nil {
+				return
+			}
+			var resp IngestResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(resp.Results) != len(tt.wantStatuses) {
+				t.Fatalf("expected %d results, got %+v", len(tt.wantStatuses), resp.Results)
+			}
+			for i, res := range resp.Results {
+				if res.Index != i || res.Status != tt.wantStatuses[i] {
+					t.Errorf("result %d: expected status %s, got %+v", i, tt.wantStatuses[i], res)
+				}
+			}
+			for _, i := range tt.wantViolations {
+				if len(resp.Results[i].Violations) == 0 {
+					t.Errorf("result %d: expected violations, got %+v", i, resp.Results[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCreateOrdersHandlerIdempotencyKey(t *testing.T) {
+	store := repository.NewMemoryOrderStore()
+	cache := &mocks.CacheMock{}
+	h := NewIngestHandler(ingest.NewPipeline(config.KafkaConfig{}, validation.MustNewOrderValidator(nil), store, cache))
+	order := testOrder()
+	body := mustMarshal(t, []*models.Order{order})
+
+	for _, want := range []ingest.Status{ingest.StatusStored, ingest.StatusDuplicate} {
+		req := httptest.NewRequest(http.MethodPost, "/orders", bytes.NewReader(body))
+		req.Header.Set("Idempotency-Key", "request-1")
+		rec := httptest.NewRecorder()
+		h.CreateOrdersHandler(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+		var resp IngestResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(resp.Results) != 1 || resp.Results[0].Status != want {
+			t.Fatalf("expected status %s, got %+v", want, resp.Results)
+		}
+	}
+
+	versions, err := store.ListOrderVersions(context.Background(), order.OrderUID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(versions) != 1 || versions[0].Source == nil || versions[0].Source.IdempotencyKey != "request-1" {
+		t.Fatalf("expected one version from the request, got %+v", versions)
+	}
+	if cache.SaveCalls != 1 {
+		t.Fatalf("expected 1 cache save, got %d", cache.SaveCalls)
+	}
+}
+
+func TestHealthHandler(t *testing.T) {
+	registry := health.NewRegistry()
+	var dbErr error
+	registry.Register("postgres", health.Readiness, time.Second, func(context.Context) error { return dbErr })
+	registry.Register("telemetry", health.Optional, time.Second, func(context.Context) error {
+		return errors.New("collector unavailable")
+	})
+	h := NewHealthHandler(registry)
+
+	r := chi.NewRouter()
+	r.Get("/livez", h.LivenessHandler)
+	r.Get("/readyz", h.ReadinessHandler)
+	r.Get("/healthz", h.HealthzHandler)
+
+	tests := []struct {
+		name       string
+		path       string
+		dbErr      error
+		wantStatus int
+		wantBody   string
+		wantChecks int
+	}{
+		{name: "ready", path: "/readyz", wantStatus: http.StatusOK, wantBody: "OK"},
+		{name: "not ready", path: "/readyz", dbErr: errors.New("db down"), wantStatus: http.StatusServiceUnavailable, wantBody: "postgres: db down"},
+		{name: "alive while db is down", path: "/livez", dbErr: errors.New("db down"), wantStatus: http.StatusOK, wantBody: "OK"},
+		{name: "healthz follows readiness", path: "/healthz", dbErr: errors.New("db down"), wantStatus: http.StatusServiceUnavailable, wantBody: "postgres: db down"},
+		{name: "verbose report", path: "/healthz?verbose", wantStatus: http.StatusOK, wantChecks: 2},
+		{name: "verbose report not ready", path: "/healthz?verbose=1", dbErr: errors.New("db down"), wantStatus: http.StatusServiceUnavailable, wantChecks: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbErr = tt.dbErr
+			rr := httptest.NewRecorder()
+			r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rr.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rr.Code, rr.Body.String())
+			}
+			if tt.wantChecks == 0 {
+				if rr.Body.String() != tt.wantBody {
+					t.Fatalf("expected body %q, got %q", tt.wantBody, rr.Body.String())
+				}
+				return
+			}
+			var report health.Report
+			if err := json.NewDecoder(rr.Body).Decode(&report); err != nil {
+				t.Fatalf("decode report: %v", err)
+			}
+			if len(report.Checks) != tt.wantChecks {
+				t.Fatalf("expected %d checks, got %+v", tt.wantChecks, report)
+			}
+		})
+	}
+}
+
+func mustMarshal(t *testing.T, v any) []byte {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return data
+}
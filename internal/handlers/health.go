@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/RoGogDBD/wb/internal/health"
+	"github.com/RoGogDBD/wb/internal/logging"
+)
+
+// HealthHandler отвечает на пробы liveness и readiness по реестру проверок компонентов.
+type HealthHandler struct {
+	registry *health.Registry
+}
+
+// NewHealthHandler создает HealthHandler.
+func NewHealthHandler(registry *health.Registry) *HealthHandler {
+	return &HealthHandler{registry: registry}
+}
+
+// LivenessHandler отвечает на пробу liveness.
+// @Summary Проба liveness
+// @Description Возвращает 200 OK, если процесс работоспособен, и 503 со списком проваленных проверок, если его нужно перезапустить
+// @Tags health
+// @Produce plain
+// @Success 200 {string} string "OK"
+// @Failure 503 {string} string "Проваленные проверки"
+// @Router /livez [get]
+func (h *HealthHandler) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	writeProbe(w, r, h.registry.Liveness(r.Context()))
+}
+
+// ReadinessHandler отвечает на пробу readiness.
+// @Summary Проба readiness
+// @Description Возвращает 200 OK, если сервис готов обслуживать запросы: БД и Kafka доступны, кеш загружен
+// @Tags health
+// @Produce plain
+// @Success 200 {string} string "OK"
+// @Failure 503 {string} string "Проваленные проверки"
+// @Router /readyz [get]
+func (h *HealthHandler) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	writeProbe(w, r, h.registry.Readiness(r.Context()))
+}
+
+// HealthzHandler возвращает состояние сервиса. С параметром verbose возвращает JSON-отчет
+// по всем проверкам, включая необязательные; статус ответа совпадает со статусом readiness.
+// @Summary Проверка работоспособности сервера
+// @Description Без verbose отвечает как /readyz; с verbose возвращает отчет по каждой проверке
+// @Tags health
+// @Produce plain,json
+// @Param verbose query bool false "Вернуть отчет по каждой проверке"
+// @Success 200 {object} health.Report "Все обязательные проверки пройдены"
+// @Failure 503 {object} health.Report "Есть проваленные обязательные проверки"
+// @Router /healthz [get]
+func (h *HealthHandler) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	if !r.URL.Query().Has("verbose") {
+		h.ReadinessHandler(w, r)
+		return
+	}
+	report := h.registry.Verbose(r.Context())
+	status := http.StatusOK
+	if !report.OK() {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
+
+// writeProbe отвечает OK или 503 со списком проваленных проверок по одной в строке.
+func writeProbe(w http.ResponseWriter, r *http.Request, report health.Report) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	body := "OK"
+	if report.OK() {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		var failed []string
+		for _, res := range report.Checks {
+			if res.Status == health.StatusFail {
+				failed = append(failed, res.Name+": "+res.Error)
+			}
+		}
+		body = strings.Join(failed, "\n")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if _, err := w.Write([]byte(body)); err != nil {
+		slog.ErrorContext(r.Context(), "health response write error", logging.Err(err))
+	}
+}
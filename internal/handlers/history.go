@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/RoGogDBD/wb/internal/diff"
+	"github.com/RoGogDBD/wb/internal/logging"
+	"github.com/RoGogDBD/wb/internal/repository"
+	"github.com/go-chi/chi/v5"
+)
+
+// OrderDiff — изменения заказа между двумя версиями.
+type OrderDiff struct {
+	OrderUID string        `json:"order_uid"`
+	From     int           `json:"from"`
+	To       int           `json:"to"`
+	Changes  []diff.Change `json:"changes"`
+}
+
+// OrderHistoryHandler возвращает историю версий заказа.
+// @Summary История версий заказа
+// @Description Возвращает все принятые версии заказа с источником в Kafka и контрольной суммой
+// @Tags orders
+// @Produce json
+// @Param order_uid path string true "Уникальный идентификатор заказа"
+// @Success 200 {array} repository.OrderVersion "Версии заказа по возрастанию номера"
+// @Failure 400 {string} string "Некорректный идентификатор"
+// @Failure 404 {string} string "Заказ не найден"
+// @Failure 500 {string} string "Внутренняя ошибка сервера"
+// @Failure 503 {string} string "История недоступна"
+// @Router /order/{order_uid}/history [get]
+func (h *Handler) OrderHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.historyOrderID(w, r)
+	if !ok {
+		return
+	}
+
+	versions, err := h.history.ListOrderVersions(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			slog.DebugContext(r.Context(), "order history not found", "order_uid", id)
+		} else {
+			slog.ErrorContext(r.Context(), "order history error", "order_uid", id, logging.Err(err))
+		}
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, versions)
+}
+
+// OrderDiffHandler возвращает изменения заказа между двумя версиями.
+// @Summary Сравнение версий заказа
+// @Description Возвращает список изменившихся полей между версиями from и to
+// @Tags orders
+// @Produce json
+// @Param order_uid path string true "Уникальный идентификатор заказа"
+// @Param from query int true "Номер исходной версии"
+// @Param to query int true "Номер сравниваемой версии"
+// @Success 200 {object} OrderDiff "Изменения"
+// @Failure 400 {string} string "Некорректные параметры"
+// @Failure 404 {string} string "Версия не найдена"
+// @Failure 500 {string} string "Внутренняя ошибка сервера"
+// @Failure 503 {string} string "История недоступна"
+// @Router /order/{order_uid}/diff [get]
+func (h *Handler) OrderDiffHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.historyOrderID(w, r)
+	if !ok {
+		return
+	}
+	from, errFrom := strconv.Atoi(r.URL.Query().Get("from"))
+	to, errTo := strconv.Atoi(r.URL.Query().Get("to"))
+	if errFrom != nil || errTo != nil || from < 1 || to < 1 {
+		http.Error(w, "Invalid from or to parameter", http.StatusBadRequest)
+		return
+	}
+
+	versions := make([]*repository.OrderVersion, 0, 2)
+	for _, n := range []int{from, to} {
+		v, err := h.history.GetOrderVersion(r.Context(), id, n)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				slog.DebugContext(r.Context(), "order version not found", "order_uid", id, "version", n)
+			} else {
+				slog.ErrorContext(r.Context(), "order version error", "order_uid", id, "version", n, logging.Err(err))
+			}
+			writeError(w, err)
+			return
+		}
+		versions = append(versions, v)
+	}
+
+	changes, err := diff.JSON(versions[0].Order, versions[1].Order)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "order diff error", "order_uid", id, logging.Err(err))
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, OrderDiff{OrderUID: id, From: from, To: to, Changes: changes})
+}
+
+// historyOrderID проверяет доступность истории и возвращает order_uid из пути.
+func (h *Handler) historyOrderID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if h.history == nil {
+		http.Error(w, "History unavailable", http.StatusServiceUnavailable)
+		return "", false
+	}
+	id := chi.URLParam(r, "order_uid")
+	if err := validate.Var(id, "required,uuid"); err != nil {
+		http.Error(w, "Invalid id parameter", http.StatusBadRequest)
+		return "", false
+	}
+	return id, true
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/RoGogDBD/wb/internal/ingest"
+	"github.com/RoGogDBD/wb/internal/logging"
+	"github.com/RoGogDBD/wb/internal/models"
+	"github.com/RoGogDBD/wb/internal/repository"
+	"github.com/RoGogDBD/wb/internal/validation"
+)
+
+const (
+	// maxIngestBodySize ограничивает размер тела запроса приема заказов.
+	maxIngestBodySize = 10 << 20
+	// maxIngestOrders ограничивает число заказов в одном запросе.
+	maxIngestOrders = 1000
+	// maxIdempotencyKeyLen ограничивает длину заголовка Idempotency-Key.
+	maxIdempotencyKeyLen = 255
+)
+
+// OrderIngester описывает конвейер приема заказов.
+type OrderIngester interface {
+	Decode(ctx context.Context, data []byte) (*models.Order, []validation.Violation, error)
+	Store(ctx context.Context, orders []*models.Order) []ingest.Result
+}
+
+// IngestHandler принимает заказы по HTTP тем же конвейером, что и Kafka-консьюмер.
+type IngestHandler struct {
+	pipeline OrderIngester
+}
+
+// NewIngestHandler создает новый IngestHandler.
+func NewIngestHandler(pipeline OrderIngester) *IngestHandler {
+	return &IngestHandler{pipeline: pipeline}
+}
+
+// IngestResult — итог приема одного заказа из запроса.
+type IngestResult struct {
+	Index      int                    `json:"index"`
+	OrderUID   string                 `json:"order_uid,omitempty"`
+	Status     ingest.Status          `json:"status"`
+	Error      string                 `json:"error,omitempty"`
+	Violations []validation.Violation `json:"violations,omitempty"`
+	Warnings   []validation.Violation `json:"warnings,omitempty"`
+}
+
+// IngestResponse — ответ на запрос приема заказов.
+type IngestResponse struct {
+	Results []IngestResult `json:"results"`
+}
+
+// CreateOrdersHandler принимает один заказ или массив заказов.
+// @Summary Принять заказы
+// @Description Принимает один заказ или массив заказов, валидирует и сохраняет их так же, как Kafka-консьюмер.
+// @Description Возвращает итог по каждому заказу. Повтор запроса с тем же заголовком Idempotency-Key
+// @Description не создает новых версий: уже принятые заказы получают статус duplicate.
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param Idempotency-Key header string false "Ключ идемпотентности запроса (до 255 символов)"
+// @Param orders body models.Order true "Заказ или массив заказов"
+// @Success 200 {object} IngestResponse "Итоги по заказам"
+// @Failure 400 {string} string "Некорректный запрос"
+// @Failure 413 {string} string "Слишком большой запрос"
+// @Failure 422 {object} IngestResponse "Ни один заказ не прошел валидацию"
+// @Failure 500 {object} IngestResponse "Не удалось сохранить заказы"
+// @Failure 503 {object} IngestResponse "Хранилище недоступно"
+// @Router /orders [post]
+func (h *IngestHandler) CreateOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("Idempotency-Key")
+	if len(key) > maxIdempotencyKeyLen {
+		http.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+		return
+	}
+
+	raw, err := readOrders(w, r)
+	if err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	results := make([]IngestResult, len(raw))
+	orders := make([]*models.Order, 0, len(raw))
+	indexes := make([]int, 0, len(raw))
+	sources := make(map[*models.Order]repository.Source, len(raw))
+	for i, data := range raw {
+		results[i] = IngestResult{Index: i}
+		ord, warnings, err := h.pipeline.Decode(ctx, data)
+		if err != nil {
+			results[i].Status = ingest.StatusInvalid
+			results[i].Error = err.Error()
+			var report *validation.Report
+			if errors.As(err, &report) {
+				results[i].Violations = report.Violations
+			}
+			continue
+		}
+		results[i].OrderUID = ord.OrderUID
+		results[i].Warnings = warnings
+		orders = append(orders, ord)
+		indexes = append(indexes, i)
+		if key != "" {
+			sources[ord] = repository.Source{IdempotencyKey: key, Offset: int64(i)}
+		}
+	}
+
+	// при ошибках сохранения недоступность хранилища (503) важнее прочих ошибок (500)
+	status := 0
+	if len(orders) > 0 {
+		for j, res := range h.pipeline.Store(repository.WithSources(ctx, sources), orders) {
+			result := &results[indexes[j]]
+			result.Status = res.Status
+			if res.Status == ingest.StatusFailed {
+				slog.ErrorContext(ctx, "order ingest error", "order_uid", result.OrderUID, logging.Err(res.Err))
+				var code int
+				code, result.Error = errorStatus(res.Err)
+				status = max(status, code)
+			}
+		}
+	}
+	switch {
+	case status != 0:
+	case len(orders) == 0:
+		status = http.StatusUnprocessableEntity
+	default:
+		status = http.StatusOK
+	}
+
+	writeJSON(w, status, IngestResponse{Results: results})
+}
+
+// readOrders читает тело запроса с одним заказом или массивом заказов.
+func readOrders(w http.ResponseWriter, r *http.Request) ([]json.RawMessage, error) {
+	var body json.RawMessage
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxIngestBodySize)).Decode(&body); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return nil, err
+		}
+		return nil, errors.New("invalid request body")
+	}
+
+	trimmed := bytes.TrimSpace(body)
+	switch {
+	case len(trimmed) > 0 && trimmed[0] == '{':
+		return []json.RawMessage{trimmed}, nil
+	case len(trimmed) > 0 && trimmed[0] == '[':
+		var raw []json.RawMessage
+		if err := json.Unmarshal(trimmed, &raw); err != nil {
+			return nil, errors.New("invalid request body")
+		}
+		if len(raw) == 0 {
+			return nil, errors.New("no orders in request")
+		}
+		if len(raw) > maxIngestOrders {
+			return nil, errors.New("too many orders in request")
+		}
+		return raw, nil
+	default:
+		return nil, errors.New("request body must be an order or an array of orders")
+	}
+}
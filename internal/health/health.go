@@ -0,0 +1,176 @@
+// Package health содержит реестр проверок состояния компонентов приложения
+// для проб liveness и readiness.
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Kind определяет, на какие пробы влияет проверка.
+type Kind string
+
+const (
+	// Liveness — проверка процесса: ее провал означает, что процесс нужно перезапустить.
+	// Провал влияет на /livez и /readyz.
+	Liveness Kind = "liveness"
+	// Readiness — проверка зависимости, без которой сервис не может обслуживать запросы.
+	// Провал влияет на /readyz.
+	Readiness Kind = "readiness"
+	// Optional — проверка только попадает в подробный отчет и не влияет на пробы.
+	Optional Kind = "optional"
+)
+
+// DefaultTimeout — таймаут проверки, зарегистрированной без таймаута.
+const DefaultTimeout = 2 * time.Second
+
+// Check проверяет компонент и возвращает ошибку, если он неработоспособен.
+type Check func(ctx context.Context) error
+
+// Статусы проверок и отчета.
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// Result — итог одной проверки.
+type Result struct {
+	Name     string `json:"name"`
+	Kind     Kind   `json:"kind"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// Report — итог проверок для пробы. Status равен StatusFail, если провалилась
+// хотя бы одна проверка, влияющая на пробу.
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// OK сообщает, что проба пройдена.
+func (r Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+type registration struct {
+	name    string
+	kind    Kind
+	timeout time.Duration
+	check   Check
+}
+
+// Registry хранит проверки компонентов. Безопасен для конкурентного использования.
+type Registry struct {
+	mu     sync.RWMutex
+	checks []registration
+}
+
+// NewRegistry создает пустой реестр.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register добавляет проверку name. Проверка, не завершившаяся за timeout
+// (DefaultTimeout, если timeout не положителен), считается проваленной.
+// Повторная регистрация с тем же именем заменяет проверку.
+func (r *Registry) Register(name string, kind Kind, timeout time.Duration, check Check) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	reg := registration{name: name, kind: kind, timeout: timeout, check: check}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.checks {
+		if r.checks[i].name == name {
+			r.checks[i] = reg
+			return
+		}
+	}
+	r.checks = append(r.checks, reg)
+}
+
+// Liveness выполняет проверки Liveness.
+func (r *Registry) Liveness(ctx context.Context) Report {
+	return r.run(ctx, func(k Kind) bool { return k == Liveness }, func(k Kind) bool { return k == Liveness })
+}
+
+// Readiness выполняет проверки Liveness и Readiness.
+func (r *Registry) Readiness(ctx context.Context) Report {
+	return r.run(ctx, isCritical, isCritical)
+}
+
+// Verbose выполняет все проверки, включая Optional; статус отчета — статус readiness.
+func (r *Registry) Verbose(ctx context.Context) Report {
+	return r.run(ctx, func(Kind) bool { return true }, isCritical)
+}
+
+func isCritical(k Kind) bool {
+	return k == Liveness || k == Readiness
+}
+
+// run параллельно выполняет проверки, выбранные include; провал проверок,
+// выбранных critical, проваливает отчет.
+func (r *Registry) run(ctx context.Context, include, critical func(Kind) bool) Report {
+	r.mu.RLock()
+	var checks []registration
+	for _, reg := range r.checks {
+		if include(reg.kind) {
+			checks = append(checks, reg)
+		}
+	}
+	r.mu.RUnlock()
+
+	report := Report{Status: StatusOK, Checks: make([]Result, len(checks))}
+	var wg sync.WaitGroup
+	for i, reg := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = runCheck(ctx, reg)
+		}()
+	}
+	wg.Wait()
+
+	for i, res := range report.Checks {
+		if res.Status == StatusFail && critical(checks[i].kind) {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+// runCheck выполняет проверку с таймаутом. Проверка, не уважающая ctx,
+// по истечении таймаута считается проваленной и дорабатывает в фоне.
+func runCheck(ctx context.Context, reg registration) Result {
+	ctx, cancel := context.WithTimeout(ctx, reg.timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		done <- reg.check(ctx)
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		err = fmt.Errorf("timed out after %s", reg.timeout)
+	}
+
+	res := Result{Name: reg.name, Kind: reg.kind, Status: StatusOK, Duration: time.Since(start).String()}
+	if err != nil {
+		res.Status = StatusFail
+		res.Error = err.Error()
+	}
+	return res
+}
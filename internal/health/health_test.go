@@ -0,0 +1,119 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	ok := func(context.Context) error { return nil }
+	fail := func(context.Context) error { return errors.New("down") }
+
+	tests := []struct {
+		name          string
+		checks        map[string]Kind
+		failing       map[string]bool
+		wantLiveness  string
+		wantReadiness string
+		wantVerbose   int
+	}{
+		{
+			name:          "all healthy",
+			checks:        map[string]Kind{"consumer": Liveness, "db": Readiness, "telemetry": Optional},
+			wantLiveness:  StatusOK,
+			wantReadiness: StatusOK,
+			wantVerbose:   3,
+		},
+		{
+			name:          "readiness failure",
+			checks:        map[string]Kind{"consumer": Liveness, "db": Readiness},
+			failing:       map[string]bool{"db": true},
+			wantLiveness:  StatusOK,
+			wantReadiness: StatusFail,
+			wantVerbose:   2,
+		},
+		{
+			name:          "liveness failure fails readiness",
+			checks:        map[string]Kind{"consumer": Liveness, "db": Readiness},
+			failing:       map[string]bool{"consumer": true},
+			wantLiveness:  StatusFail,
+			wantReadiness: StatusFail,
+			wantVerbose:   2,
+		},
+		{
+			name:          "optional failure is only reported",
+			checks:        map[string]Kind{"db": Readiness, "telemetry": Optional},
+			failing:       map[string]bool{"telemetry": true},
+			wantLiveness:  StatusOK,
+			wantReadiness: StatusOK,
+			wantVerbose:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			for name, kind := range tt.checks {
+				check := ok
+				if tt.failing[name] {
+					check = fail
+				}
+				r.Register(name, kind, time.Second, check)
+			}
+
+			if got := r.Liveness(context.Background()).Status; got != tt.wantLiveness {
+				t.Fatalf("expected liveness %s, got %s", tt.wantLiveness, got)
+			}
+			if got := r.Readiness(context.Background()).Status; got != tt.wantReadiness {
+				t.Fatalf("expected readiness %s, got %s", tt.wantReadiness, got)
+			}
+			verbose := r.Verbose(context.Background())
+			if verbose.Status != tt.wantReadiness || len(verbose.Checks) != tt.wantVerbose {
+				t.Fatalf("expected verbose status %s with %d checks, got %+v", tt.wantReadiness, tt.wantVerbose, verbose)
+			}
+			for _, res := range verbose.Checks {
+				wantStatus := StatusOK
+				if tt.failing[res.Name] {
+					wantStatus = StatusFail
+				}
+				if res.Status != wantStatus || res.Kind != tt.checks[res.Name] {
+					t.Fatalf("unexpected result %+v", res)
+				}
+			}
+		})
+	}
+}
+
+func TestRegistryTimeout(t *testing.T) {
+	r := NewRegistry()
+	release := make(chan struct{})
+	defer close(release)
+	// проверка не уважает ctx, но отчет не ждет ее дольше таймаута
+	r.Register("stuck", Readiness, 20*time.Millisecond, func(context.Context) error {
+		<-release
+		return nil
+	})
+
+	start := time.Now()
+	report := r.Readiness(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("readiness waited %s for a stuck check", elapsed)
+	}
+	if report.OK() || !strings.Contains(report.Checks[0].Error, "timed out") {
+		t.Fatalf("expected timed out check, got %+v", report)
+	}
+}
+
+func TestRegistryReplacesCheck(t *testing.T) {
+	r := NewRegistry()
+	r.Register("db", Readiness, 0, func(context.Context) error { return errors.New("down") })
+	r.Register("db", Readiness, 0, func(context.Context) error { return nil })
+
+	report := r.Readiness(context.Background())
+	if !report.OK() || len(report.Checks) != 1 {
+		t.Fatalf("expected single passing check, got %+v", report)
+	}
+}
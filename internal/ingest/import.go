@@ -0,0 +1,223 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+
+	"github.com/RoGogDBD/wb/internal/logging"
+	"github.com/RoGogDBD/wb/internal/models"
+	"github.com/RoGogDBD/wb/internal/repository"
+)
+
+// maxImportLineSize ограничивает длину одной строки NDJSON.
+const maxImportLineSize = 10 << 20
+
+// ImportOptions — параметры импорта заказов из NDJSON.
+type ImportOptions struct {
+	// Workers — число параллельно сохраняемых пачек.
+	Workers int
+	// BatchSize — число строк в пачке.
+	BatchSize int
+	// SkipLines — число строк от начала потока, обработанных предыдущим запуском.
+	SkipLines int64
+	// IdempotencyKey — ключ, с которым строки записываются в журнал обработанных сообщений
+	// (номер строки используется как номер заказа). Пустой ключ отключает журнал.
+	IdempotencyKey string
+	// Checkpoint вызывается с числом строк от начала потока, которые обработаны полностью.
+	// Строки с ошибкой записи и все следующие за ними не входят в контрольную точку,
+	// поэтому при возобновлении с нее они будут обработаны заново.
+	Checkpoint func(lines int64) error
+}
+
+// ImportStats — итоги импорта.
+type ImportStats struct {
+	Lines    int64            `json:"lines"`
+	Skipped  int64            `json:"skipped"`
+	Statuses map[Status]int64 `json:"statuses"`
+}
+
+// importBatch — пачка строк потока; last — номер последней строки, вошедшей в пачку,
+// включая пустые строки, которые не передаются.
+type importBatch struct {
+	seq   int
+	last  int64
+	lines []importLine
+}
+
+type importLine struct {
+	n    int64
+	data []byte
+}
+
+// batchResult — итог пачки; failedAt — номер первой строки с ошибкой записи или 0.
+type batchResult struct {
+	batch    importBatch
+	statuses map[Status]int64
+	failedAt int64
+}
+
+// Import читает заказы из NDJSON (по одному JSON-объекту в строке) и сохраняет их пачками
+// в opts.Workers потоков тем же конвейером, что и остальные пути приема.
+// Невалидные строки пропускаются и учитываются в итогах со статусом StatusInvalid.
+// Возвращает ошибку чтения потока, контрольной точки или отмены ctx.
+func (p *Pipeline) Import(ctx context.Context, r io.Reader, opts ImportOptions) (ImportStats, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	workers := max(opts.Workers, 1)
+	batchSize := max(opts.BatchSize, 1)
+	stats := ImportStats{Skipped: opts.SkipLines, Statuses: make(map[Status]int64)}
+
+	batches := make(chan importBatch, workers)
+	results := make(chan batchResult, workers)
+
+	var readErr error
+	go func() {
+		defer close(batches)
+		readErr = readBatches(ctx, r, opts.SkipLines, batchSize, batches)
+	}()
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for b := range batches {
+				results <- p.importBatch(ctx, b, opts.IdempotencyKey)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	// контрольная точка продвигается только по непрерывной последовательности пачек
+	checkpoint := opts.SkipLines
+	frozen := false
+	pending := make(map[int]batchResult)
+	next := 0
+	for res := range results {
+		stats.Lines += int64(len(res.batch.lines))
+		for status, n := range res.statuses {
+			stats.Statuses[status] += n
+		}
+
+		pending[res.batch.seq] = res
+		advanced := false
+		for {
+			done, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if frozen {
+				continue
+			}
+			if done.failedAt > 0 {
+				checkpoint = done.failedAt - 1
+				frozen = true
+			} else {
+				checkpoint = done.batch.last
+			}
+			advanced = true
+		}
+		if advanced && opts.Checkpoint != nil && context.Cause(ctx) == nil {
+			if err := opts.Checkpoint(checkpoint); err != nil {
+				cancel(fmt.Errorf("save checkpoint: %w", err))
+			}
+		}
+	}
+
+	if cause := context.Cause(ctx); cause != nil {
+		return stats, cause
+	}
+	if readErr != nil {
+		return stats, fmt.Errorf("read orders: %w", readErr)
+	}
+	return stats, nil
+}
+
+// readBatches читает строки потока, пропуская первые skip строк, и отправляет их пачками.
+func readBatches(ctx context.Context, r io.Reader, skip int64, batchSize int, out chan<- importBatch) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxImportLineSize)
+
+	send := func(b importBatch) bool {
+		select {
+		case out <- b:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	var n int64
+	var batch importBatch
+	for scanner.Scan() {
+		n++
+		if n <= skip {
+			continue
+		}
+		batch.last = n
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		batch.lines = append(batch.lines, importLine{n: n, data: bytes.Clone(data)})
+		if len(batch.lines) >= batchSize {
+			if !send(batch) {
+				return nil
+			}
+			batch = importBatch{seq: batch.seq + 1}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(batch.lines) > 0 {
+		send(batch)
+	}
+	return nil
+}
+
+// importBatch разбирает и сохраняет строки пачки.
+func (p *Pipeline) importBatch(ctx context.Context, b importBatch, key string) batchResult {
+	res := batchResult{batch: b, statuses: make(map[Status]int64)}
+	orders := make([]*models.Order, 0, len(b.lines))
+	lines := make([]int64, 0, len(b.lines))
+	sources := make(map[*models.Order]repository.Source, len(b.lines))
+	for _, line := range b.lines {
+		ord, _, err := p.Decode(ctx, line.data)
+		if err != nil {
+			slog.WarnContext(ctx, "invalid import line", "line", line.n, logging.Err(err))
+			res.statuses[StatusInvalid]++
+			continue
+		}
+		orders = append(orders, ord)
+		lines = append(lines, line.n)
+		if key != "" {
+			sources[ord] = repository.Source{IdempotencyKey: key, Offset: line.n}
+		}
+	}
+	if len(orders) == 0 {
+		return res
+	}
+
+	for i, r := range p.Store(repository.WithSources(ctx, sources), orders) {
+		res.statuses[r.Status]++
+		if r.Status == StatusFailed {
+			slog.ErrorContext(ctx, "failed to store imported order", "line", lines[i], "order_uid", orders[i].OrderUID, logging.Err(r.Err))
+			if res.failedAt == 0 {
+				res.failedAt = lines[i]
+			}
+		}
+	}
+	return res
+}
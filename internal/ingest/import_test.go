@@ -0,0 +1,206 @@
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/config"
+	"github.com/RoGogDBD/wb/internal/models"
+	"github.com/RoGogDBD/wb/internal/repository"
+	"github.com/RoGogDBD/wb/internal/repository/mocks"
+	"github.com/RoGogDBD/wb/internal/validation"
+	"github.com/google/uuid"
+)
+
+func TestImport(t *testing.T) {
+	failing := testOrder()
+	invalid := testOrder()
+	invalid.Payment.GoodsTotal = 1
+
+	// строки 1-6: пустая строка и невалидные заказы не мешают контрольной точке
+	input := strings.Join([]string{
+		mustMarshal(t, testOrder()),
+		"",
+		"{",
+		mustMarshal(t, invalid),
+		mustMarshal(t, testOrder()),
+		mustMarshal(t, testOrder()),
+	}, "\n")
+	withFailure := input + "\n" + mustMarshal(t, failing) + "\n" + mustMarshal(t, testOrder())
+
+	tests := []struct {
+		name           string
+		input          string
+		skip           int64
+		wantLines      int64
+		wantStatuses   map[Status]int64
+		wantCheckpoint int64
+	}{
+		{
+			name:           "all lines",
+			input:          input,
+			wantLines:      5,
+			wantStatuses:   map[Status]int64{StatusStored: 3, StatusInvalid: 2},
+			wantCheckpoint: 6,
+		},
+		{
+			name:           "resume from checkpoint",
+			input:          input,
+			skip:           4,
+			wantLines:      2,
+			wantStatuses:   map[Status]int64{StatusStored: 2},
+			wantCheckpoint: 6,
+		},
+		{
+			name:           "failed line stops checkpoint",
+			input:          withFailure,
+			wantLines:      7,
+			wantStatuses:   map[Status]int64{StatusStored: 4, StatusInvalid: 2, StatusFailed: 1},
+			wantCheckpoint: 6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := repository.NewMemoryOrderStore()
+			failingStore := &mocks.OrderStoreMock{
+				InsertOrderFunc: func(ctx context.Context, o *models.Order) error {
+					if o.OrderUID == failing.OrderUID {
+						return errors.New("constraint violation")
+					}
+					return store.InsertOrder(ctx, o)
+				},
+			}
+			pipeline := NewPipeline(config.KafkaConfig{}, validation.MustNewOrderValidator(nil), failingStore, nil)
+
+			var mu sync.Mutex
+			var checkpoints []int64
+			stats, err := pipeline.Import(context.Background(), strings.NewReader(tt.input), ImportOptions{
+				Workers:   3,
+				BatchSize: 1,
+				SkipLines: tt.skip,
+				Checkpoint: func(lines int64) error {
+					mu.Lock()
+					defer mu.Unlock()
+					checkpoints = append(checkpoints, lines)
+					return nil
+				},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if stats.Lines != tt.wantLines || stats.Skipped != tt.skip {
+				t.Fatalf("expected %d lines and %d skipped, got %+v", tt.wantLines, tt.skip, stats)
+			}
+			if len(stats.Statuses) != len(tt.wantStatuses) {
+				t.Fatalf("expected statuses %v, got %v", tt.wantStatuses, stats.Statuses)
+			}
+			for status, n := range tt.wantStatuses {
+				if stats.Statuses[status] != n {
+					t.Fatalf("expected statuses %v, got %v", tt.wantStatuses, stats.Statuses)
+				}
+			}
+			if len(checkpoints) == 0 || checkpoints[len(checkpoints)-1] != tt.wantCheckpoint {
+				t.Fatalf("expected final checkpoint %d, got %v", tt.wantCheckpoint, checkpoints)
+			}
+			for i := 1; i < len(checkpoints); i++ {
+				if checkpoints[i] < checkpoints[i-1] {
+					t.Fatalf("checkpoint moved backwards: %v", checkpoints)
+				}
+			}
+		})
+	}
+}
+
+func TestImportIdempotencyKey(t *testing.T) {
+	store := repository.NewMemoryOrderStore()
+	pipeline := NewPipeline(config.KafkaConfig{}, validation.MustNewOrderValidator(nil), store, nil)
+	input := mustMarshal(t, testOrder()) + "\n" + mustMarshal(t, testOrder())
+	opts := ImportOptions{Workers: 2, BatchSize: 1, IdempotencyKey: "import-1"}
+
+	for _, want := range []Status{StatusStored, StatusDuplicate} {
+		stats, err := pipeline.Import(context.Background(), strings.NewReader(input), opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if stats.Statuses[want] != 2 {
+			t.Fatalf("expected 2 orders with status %s, got %v", want, stats.Statuses)
+		}
+	}
+}
+
+func TestImportCheckpointError(t *testing.T) {
+	pipeline := NewPipeline(config.KafkaConfig{}, validation.MustNewOrderValidator(nil), repository.NewMemoryOrderStore(), nil)
+	checkpointErr := errors.New("disk full")
+
+	_, err := pipeline.Import(context.Background(), strings.NewReader(mustMarshal(t, testOrder())), ImportOptions{
+		Checkpoint: func(int64) error { return checkpointErr },
+	})
+	if !errors.Is(err, checkpointErr) {
+		t.Fatalf("expected checkpoint error, got %v", err)
+	}
+}
+
+func mustMarshal(t *testing.T, o *models.Order) string {
+	t.Helper()
+	data, err := json.Marshal(o)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return string(data)
+}
+
+func testOrder() *models.Order {
+	id := uuid.New().String()
+	return &models.Order{
+		OrderUID:    id,
+		TrackNumber: "TRACK-" + id[:8],
+		Entry:       "WBIL",
+		Delivery: models.Delivery{
+			Name:    "Test",
+			Phone:   "+79001234567",
+			Zip:     "123456",
+			City:    "City",
+			Address: "Street 1",
+			Region:  "Region",
+			Email:   "test@example.com",
+		},
+		Payment: models.Payment{
+			Transaction:  id,
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       60,
+			PaymentDt:    time.Now().Unix(),
+			Bank:         "alpha",
+			DeliveryCost: 10,
+			GoodsTotal:   50,
+		},
+		Items: []models.Item{
+			{
+				ChrtID:      1,
+				TrackNumber: "TRACK-" + id[:8],
+				Price:       50,
+				Rid:         "rid",
+				Name:        "item",
+				Size:        "0",
+				TotalPrice:  50,
+				NmID:        1,
+				Brand:       "brand",
+				Status:      202,
+			},
+		},
+		Locale:          "en",
+		CustomerID:      "customer",
+		DeliveryService: "meest",
+		ShardKey:        "9",
+		SmID:            1,
+		DateCreated:     time.Now(),
+		OofShard:        "1",
+	}
+}
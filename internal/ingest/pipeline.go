@@ -0,0 +1,295 @@
+// Package ingest содержит общий конвейер приема заказов: разбор, валидацию,
+// сохранение с повторами и обновление кеша. Его используют Kafka-консьюмер и HTTP API,
+// поэтому оба пути приема обрабатывают заказы одинаково.
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/config"
+	"github.com/RoGogDBD/wb/internal/logging"
+	"github.com/RoGogDBD/wb/internal/models"
+	"github.com/RoGogDBD/wb/internal/repository"
+	"github.com/RoGogDBD/wb/internal/retry"
+	"github.com/RoGogDBD/wb/internal/telemetry"
+	"github.com/RoGogDBD/wb/internal/validation"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// meterName — имя инструментирования метрик и трассировки конвейера.
+const meterName = "github.com/RoGogDBD/wb/internal/ingest"
+
+type spanContextsKey struct{}
+
+// WithSpanContexts возвращает контекст с родительскими span для заказов пачки.
+// Store связывает с ними запись пачкой и делает их родителями повторных записей заказов;
+// без них родителем служит span из ctx.
+func WithSpanContexts(ctx context.Context, spans map[*models.Order]trace.SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextsKey{}, spans)
+}
+
+// orderContext возвращает ctx с родительским span заказа o, заданным через WithSpanContexts.
+func orderContext(ctx context.Context, o *models.Order) context.Context {
+	spans, _ := ctx.Value(spanContextsKey{}).(map[*models.Order]trace.SpanContext)
+	if sc, ok := spans[o]; ok && sc.IsValid() {
+		return trace.ContextWithSpanContext(ctx, sc)
+	}
+	return ctx
+}
+
+// Этапы, на которых заказ может быть отклонен.
+const (
+	StageUnmarshal  = "unmarshal"
+	StageValidation = "validation"
+	StageStore      = "db"
+)
+
+// Error — ошибка приема заказа с этапом, на котором она произошла.
+type Error struct {
+	Stage string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Status — итог обработки заказа.
+type Status string
+
+const (
+	// StatusStored — заказ сохранен и добавлен в кеш.
+	StatusStored Status = "stored"
+	// StatusSuperseded — в той же пачке сохранена более поздняя версия заказа.
+	StatusSuperseded Status = "superseded"
+	// StatusStale — в хранилище уже есть более новая версия заказа.
+	StatusStale Status = "stale"
+	// StatusDuplicate — сообщение или запрос с этим ключом уже обработан.
+	StatusDuplicate Status = "duplicate"
+	// StatusInvalid — заказ не удалось разобрать или он не прошел валидацию.
+	StatusInvalid Status = "invalid"
+	// StatusFailed — заказ не удалось сохранить.
+	StatusFailed Status = "failed"
+)
+
+// Result — итог сохранения одного заказа. Err задан для StatusStale, StatusDuplicate и StatusFailed.
+type Result struct {
+	Status Status
+	Err    error
+}
+
+// Pipeline — конвейер приема заказов.
+type Pipeline struct {
+	validate       *validation.OrderValidator
+	store          repository.OrderStore
+	cache          repository.CacheWriter
+	retryPolicy    retry.Policy
+	staleOrders    metric.Int64Counter
+	duplicates     metric.Int64Counter
+	warnings       metric.Int64Counter
+	stored         metric.Int64Counter
+	retries        metric.Int64Counter
+	insertDuration metric.Float64Histogram
+}
+
+// NewPipeline создает конвейер; cache может быть nil, если кеш не нужен. Повторы записи настраиваются параметрами kafka.dlq_max_retries
+// и kafka.dlq_backoff*: повторяются только ошибки недоступности хранилища.
+func NewPipeline(cfg config.KafkaConfig, validate *validation.OrderValidator, store repository.OrderStore, cache repository.CacheWriter) *Pipeline {
+	return &Pipeline{
+		validate: validate,
+		store:    store,
+		cache:    cache,
+		retryPolicy: retry.Policy{
+			MaxRetries:  cfg.DLQMaxRetries,
+			Backoff:     retry.NewBackoff(cfg.DLQBackoff, cfg.DLQBackoffCap, cfg.DLQBackoffJitter),
+			ShouldRetry: IsRetriable,
+		},
+		staleOrders:    telemetry.Int64Counter(meterName, "orders.stale", "Orders skipped because a newer version is already stored", "{order}"),
+		duplicates:     telemetry.Int64Counter(meterName, "messages.duplicate", "Messages skipped because they are already processed", "{message}"),
+		warnings:       telemetry.Int64Counter(meterName, "orders.validation_warnings", "Violations of validation rules in warn mode", "{violation}"),
+		stored:         telemetry.Int64Counter(meterName, "orders.stored", "Orders stored in the database", "{order}"),
+		retries:        telemetry.Int64Counter(meterName, "orders.insert.retries", "Retried order inserts", "{attempt}"),
+		insertDuration: telemetry.Float64Histogram(meterName, "orders.insert.duration", "Duration of order inserts", "s"),
+	}
+}
+
+// IsRetriable сообщает, стоит ли повторять запись: повторяются только ошибки недоступности хранилища.
+func IsRetriable(err error) bool {
+	return errors.Is(err, repository.ErrUnavailable)
+}
+
+// Decode разбирает и валидирует заказ. Ошибка имеет тип *Error с этапом StageUnmarshal
+// или StageValidation; ошибка валидации содержит *validation.Report.
+// Нарушения правил в режиме warn не мешают приему заказа: они возвращаются, пишутся в лог
+// и учитываются в метрике.
+func (p *Pipeline) Decode(ctx context.Context, data []byte) (*models.Order, []validation.Violation, error) {
+	tracer := otel.Tracer(meterName)
+
+	var ord models.Order
+	_, span := tracer.Start(ctx, "unmarshal")
+	err := json.Unmarshal(data, &ord)
+	endSpan(span, err)
+	if err != nil {
+		slog.WarnContext(ctx, "invalid message", logging.Err(err))
+		return nil, nil, &Error{Stage: StageUnmarshal, Err: err}
+	}
+
+	_, span = tracer.Start(ctx, "validation", trace.WithAttributes(attribute.String("order_uid", ord.OrderUID)))
+	warnings, err := p.validate.Validate(&ord)
+	endSpan(span, err)
+	if err != nil {
+		slog.WarnContext(ctx, "order validation failed", "order_uid", ord.OrderUID, logging.Err(err))
+		return nil, nil, &Error{Stage: StageValidation, Err: err}
+	}
+	for _, w := range warnings {
+		p.warnings.Add(ctx, 1, metric.WithAttributes(attribute.String("rule", w.Rule)))
+		slog.WarnContext(ctx, "order validation warning", "order_uid", ord.OrderUID, "violation", w.String())
+	}
+	return &ord, warnings, nil
+}
+
+// Store сохраняет заказы одной операцией и возвращает итоги по индексам заказов.
+// Ретраибельные ошибки повторяются по одному заказу; сохраненные заказы добавляются в кеш, если он задан.
+// Заказ, более новая версия которого уже сохранена этой же пачкой или ранее, и уже
+// обработанные сообщения не повторяются и учитываются в метриках.
+// Источники заказов передаются через repository.WithSources в ctx.
+func (p *Pipeline) Store(ctx context.Context, orders []*models.Order) []Result {
+	links := make([]trace.Link, 0, len(orders))
+	for _, o := range orders {
+		if sc := trace.SpanContextFromContext(orderContext(ctx, o)); sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+	batchCtx, span := otel.Tracer(meterName).Start(ctx, "InsertOrders",
+		trace.WithLinks(links...), trace.WithAttributes(attribute.Int("orders", len(orders))))
+	start := time.Now()
+	errs := p.store.InsertOrders(batchCtx, orders)
+	p.recordInsert(ctx, "batch", start)
+	var batchErr error
+	for _, err := range errs {
+		batchErr = errors.Join(batchErr, storeError(err))
+	}
+	endSpan(span, batchErr)
+	results := make([]Result, len(orders))
+	for i, o := range orders {
+		logCtx := logContext(ctx, o)
+		err := errs[i]
+		if err != nil && !supersededInBatch(orders, errs, i) &&
+			!errors.Is(err, repository.ErrStale) && !errors.Is(err, repository.ErrDuplicate) {
+			err = p.retryInsert(ctx, o, err)
+			errs[i] = err
+		}
+
+		switch {
+		case err == nil:
+			if p.cache != nil {
+				p.cache.Save(o)
+			}
+			p.stored.Add(ctx, 1)
+			slog.InfoContext(logCtx, "order stored")
+			results[i] = Result{Status: StatusStored}
+		case supersededInBatch(orders, errs, i):
+			slog.InfoContext(logCtx, "order superseded by a newer message in the same batch")
+			results[i] = Result{Status: StatusSuperseded}
+		case errors.Is(err, repository.ErrStale):
+			p.staleOrders.Add(ctx, 1)
+			slog.InfoContext(logCtx, "skipping stale order: a newer version is stored",
+				"revision", o.Revision().Format(time.RFC3339Nano))
+			results[i] = Result{Status: StatusStale, Err: err}
+		case errors.Is(err, repository.ErrDuplicate):
+			p.duplicates.Add(ctx, 1)
+			slog.InfoContext(logCtx, "skipping already processed order")
+			results[i] = Result{Status: StatusDuplicate, Err: err}
+		default:
+			results[i] = Result{Status: StatusFailed, Err: &Error{Stage: StageStore, Err: err}}
+		}
+	}
+	return results
+}
+
+// retryInsert повторяет запись заказа по политике повторов.
+// Неудачная запись пачкой считается первой попыткой.
+func (p *Pipeline) retryInsert(ctx context.Context, o *models.Order, batchErr error) error {
+	maxAttempts := p.retryPolicy.MaxRetries + 1
+	attempt := 0
+	return retry.Do(ctx, p.retryPolicy, func() error {
+		attempt++
+		if attempt == 1 {
+			return batchErr
+		}
+		attemptCtx, span := otel.Tracer(meterName).Start(orderContext(ctx, o), "InsertOrder", trace.WithAttributes(
+			attribute.String("order_uid", o.OrderUID),
+			attribute.Int("retry.attempt", attempt),
+		))
+		start := time.Now()
+		err := p.store.InsertOrder(attemptCtx, o)
+		p.recordInsert(ctx, "single", start)
+		endSpan(span, storeError(err))
+		return err
+	}, func(err error, attempt int, wait time.Duration) {
+		p.retries.Add(ctx, 1)
+		slog.WarnContext(logContext(ctx, o), "failed to save order to DB",
+			"attempt", attempt, "max_attempts", maxAttempts, "retry_in", wait, logging.Err(err))
+	})
+}
+
+// logContext возвращает контекст записей лога о заказе o: с его span, полем order_uid
+// и координатами источника из repository.WithSources (topic, partition и offset сообщения Kafka
+// или ключ идемпотентности и номер заказа).
+func logContext(ctx context.Context, o *models.Order) context.Context {
+	args := []any{"order_uid", o.OrderUID}
+	if src := repository.SourceFromContext(ctx, o); src != nil {
+		if src.Topic != "" {
+			args = append(args, "topic", src.Topic, "partition", src.Partition)
+		} else {
+			args = append(args, "idempotency_key", src.IdempotencyKey)
+		}
+		args = append(args, "offset", src.Offset)
+	}
+	return logging.With(orderContext(ctx, o), args...)
+}
+
+// recordInsert учитывает длительность записи с начала start; mode — batch или single.
+func (p *Pipeline) recordInsert(ctx context.Context, mode string, start time.Time) {
+	p.insertDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attribute.String("mode", mode)))
+}
+
+// storeError возвращает ошибку записи без ErrStale и ErrDuplicate: такие заказы
+// пропускаются штатно и не считаются ошибкой в трассировке.
+func storeError(err error) error {
+	if errors.Is(err, repository.ErrStale) || errors.Is(err, repository.ErrDuplicate) {
+		return nil
+	}
+	return err
+}
+
+// endSpan завершает span, отмечая ошибку err, если она есть.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// supersededInBatch сообщает, сохранен ли в пачке более поздний заказ с тем же order_uid.
+func supersededInBatch(orders []*models.Order, errs []error, i int) bool {
+	for j := i + 1; j < len(orders); j++ {
+		if orders[j].OrderUID == orders[i].OrderUID && errs[j] == nil {
+			return true
+		}
+	}
+	return false
+}
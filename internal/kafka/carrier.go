@@ -0,0 +1,44 @@
+package kafka
+
+import (
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// HeaderCarrier адаптирует заголовки сообщения Kafka к propagation.TextMapCarrier,
+// чтобы передавать контекст трассировки (traceparent, baggage) между продюсером и консьюмером:
+//
+//	otel.GetTextMapPropagator().Inject(ctx, (*kafka.HeaderCarrier)(&msg.Headers))
+type HeaderCarrier []kafka.Header
+
+var _ propagation.TextMapCarrier = (*HeaderCarrier)(nil)
+
+// Get возвращает значение первого заголовка с ключом key или пустую строку.
+func (c *HeaderCarrier) Get(key string) string {
+	for _, h := range *c {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// Set заменяет значение заголовка key или добавляет заголовок, если его нет.
+func (c *HeaderCarrier) Set(key, value string) {
+	for i, h := range *c {
+		if h.Key == key {
+			(*c)[i].Value = []byte(value)
+			return
+		}
+	}
+	*c = append(*c, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+// Keys возвращает ключи всех заголовков.
+func (c *HeaderCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c))
+	for _, h := range *c {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
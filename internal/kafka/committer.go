@@ -0,0 +1,114 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/logging"
+	"github.com/segmentio/kafka-go"
+)
+
+// committer накапливает обработанные сообщения и фиксирует их оффсеты пачками.
+type committer struct {
+	reader   messageReader
+	interval time.Duration
+
+	mu        sync.Mutex
+	pending   map[int]kafka.Message
+	committed map[int]int64
+}
+
+func newCommitter(reader messageReader, interval time.Duration) *committer {
+	return &committer{
+		reader:    reader,
+		interval:  interval,
+		pending:   make(map[int]kafka.Message),
+		committed: make(map[int]int64),
+	}
+}
+
+// markDone отмечает сообщение обработанным. Без интервала оффсет фиксируется сразу.
+// Оффсеты ниже уже зафиксированных пропускаются, поэтому порядок вызовов не важен.
+func (c *committer) markDone(ctx context.Context, m kafka.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.interval > 0 {
+		c.keepLatestLocked(m)
+		return nil
+	}
+	if last, ok := c.committed[m.Partition]; ok && last >= m.Offset {
+		return nil
+	}
+	if err := c.reader.CommitMessages(ctx, m); err != nil {
+		return err
+	}
+	c.committed[m.Partition] = m.Offset
+	return nil
+}
+
+// flush фиксирует все накопленные оффсеты.
+func (c *committer) flush(ctx context.Context) error {
+	c.mu.Lock()
+	msgs := make([]kafka.Message, 0, len(c.pending))
+	for _, m := range c.pending {
+		msgs = append(msgs, m)
+	}
+	c.pending = make(map[int]kafka.Message)
+	c.mu.Unlock()
+
+	if len(msgs) == 0 {
+		return nil
+	}
+	if err := c.reader.CommitMessages(ctx, msgs...); err != nil {
+		// Возвращаем оффсеты обратно, чтобы зафиксировать их при следующей попытке
+		c.mu.Lock()
+		for _, m := range msgs {
+			c.keepLatestLocked(m)
+		}
+		c.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// start запускает периодическую фиксацию оффсетов и возвращает функцию остановки.
+func (c *committer) start(ctx context.Context) (stop func()) {
+	if c.interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	ticker := time.NewTicker(c.interval)
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := c.flush(ctx); err != nil {
+					slog.ErrorContext(ctx, "kafka commit error", logging.Err(err))
+				}
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func (c *committer) keepLatestLocked(m kafka.Message) {
+	if prev, ok := c.pending[m.Partition]; ok && prev.Offset >= m.Offset {
+		return
+	}
+	c.pending[m.Partition] = m
+}
@@ -5,99 +5,422 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
-	"log"
-	"net"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
 	"strconv"
+	"sync"
 	"time"
 
+	"github.com/RoGogDBD/wb/internal/config"
+	"github.com/RoGogDBD/wb/internal/ingest"
+	"github.com/RoGogDBD/wb/internal/logging"
 	"github.com/RoGogDBD/wb/internal/models"
 	"github.com/RoGogDBD/wb/internal/repository"
-	"github.com/RoGogDBD/wb/internal/retry"
+	"github.com/RoGogDBD/wb/internal/telemetry"
 	"github.com/RoGogDBD/wb/internal/validation"
-	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const (
+	// meterName — имя инструментирования метрик консьюмера.
+	meterName = "github.com/RoGogDBD/wb/internal/kafka"
+	// commitFlushTimeout ограничивает финальную фиксацию оффсетов при остановке.
+	commitFlushTimeout = 5 * time.Second
+	// batchDrainTimeout ограничивает запись начатой пачки при остановке.
+	batchDrainTimeout = 5 * time.Second
+	// workerQueueSize — размер очереди сообщений одного воркера.
+	workerQueueSize = 16
+)
+
+// messageReader описывает чтение сообщений с ручной фиксацией оффсетов.
+type messageReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// messageWriter описывает запись сообщений в топик.
+type messageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+}
+
+// consumer обрабатывает заказы из Kafka с семантикой at-least-once.
+type consumer struct {
+	reader         messageReader
+	dlq            messageWriter
+	pipeline       *ingest.Pipeline
+	commitInterval time.Duration
+	workers        int
+	batchSize      int
+	batchTimeout   time.Duration
+	lag            *lagTracker
+	consumed       metric.Int64Counter
+	dlqSent        metric.Int64Counter
+	latency        metric.Float64Histogram
+}
+
 // RunConsumer запускает цикл Kafka-консьюмера и обрабатывает DLQ/повторы.
-func RunConsumer(ctx context.Context, brokers []string, topic string, groupID string, dlqTopic string, maxRetries int, backoffBase time.Duration, backoffCap time.Duration, backoffJitter bool, store repository.OrderStore, mem repository.CacheWriter) {
+// Оффсет сообщения фиксируется только после сохранения заказа или записи в DLQ.
+// Возвращает nil при отмене ctx и ошибку, если дальнейшая обработка невозможна.
+// При остановке воркеры дописывают начатые пачки с отдельным ограничением batchDrainTimeout
+// и подтверждают их сообщения; сообщения, полученные воркером после отмены, не обрабатываются
+// и будут доставлены повторно. Возврат происходит только после того, как воркеры дописали
+// свои пачки и оффсеты зафиксированы финальным flush, поэтому после него можно закрывать хранилище.
+// Заказы разбираются, валидируются и сохраняются общим конвейером приема pipeline.
+func RunConsumer(ctx context.Context, cfg config.KafkaConfig, pipeline *ingest.Pipeline) error {
 	r := kafka.NewReader(kafka.ReaderConfig{
-		Brokers: brokers,
-		Topic:   topic,
-		GroupID: groupID,
+		Brokers: cfg.Brokers,
+		Topic:   cfg.Topic,
+		GroupID: cfg.GroupID,
 	})
 	defer func() {
 		if err := r.Close(); err != nil {
-			log.Printf("kafka reader close error: %v", err)
+			slog.WarnContext(ctx, "kafka reader close error", logging.Err(err))
 		}
 	}()
 
 	dlqWriter := &kafka.Writer{
-		Addr:  kafka.TCP(brokers...),
-		Topic: dlqTopic,
+		Addr:  kafka.TCP(cfg.Brokers...),
+		Topic: cfg.DLQTopic,
 	}
 	defer func() {
 		if err := dlqWriter.Close(); err != nil {
-			log.Printf("dlq writer close error: %v", err)
+			slog.WarnContext(ctx, "dlq writer close error", logging.Err(err))
 		}
 	}()
 
-	validate := validation.MustNew()
-	backoff := retry.NewBackoff(backoffBase, backoffCap, backoffJitter)
-	retryPolicy := retry.Policy{
-		MaxRetries:  maxRetries,
-		Backoff:     backoff,
-		ShouldRetry: isRetriableDBError,
+	c := newConsumer(cfg, pipeline, r, dlqWriter)
+	c.lag = newLagTracker(brokerHighWaterMarks(cfg.Brokers))
+	return c.run(ctx)
+}
+
+func newConsumer(cfg config.KafkaConfig, pipeline *ingest.Pipeline, reader messageReader, dlq messageWriter) *consumer {
+	return &consumer{
+		reader:         reader,
+		dlq:            dlq,
+		pipeline:       pipeline,
+		commitInterval: cfg.CommitInterval,
+		workers:        max(cfg.Workers, 1),
+		batchSize:      max(cfg.BatchSize, 1),
+		batchTimeout:   max(cfg.BatchTimeout, 0),
+		lag:            newLagTracker(nil),
+		consumed:       telemetry.Int64Counter(meterName, "messages.consumed", "Messages fetched from the orders topic", "{message}"),
+		dlqSent:        telemetry.Int64Counter(meterName, "dlq.messages", "Messages sent to the DLQ", "{message}"),
+		latency: telemetry.Float64Histogram(meterName, "messages.latency",
+			"Time from message production to its handling: stored, skipped or sent to the DLQ", "s"),
 	}
+}
+
+// run читает сообщения и распределяет их по воркерам.
+// Сообщения с одним ключом (или из одной партиции при пустом ключе)
+// всегда попадают к одному воркеру, поэтому их порядок сохраняется.
+func (c *consumer) run(parent context.Context) (err error) {
+	ctx, cancel := context.WithCancelCause(parent)
+	defer cancel(nil)
+
+	commits := newCommitter(c.reader, c.commitInterval)
+	stopCommits := commits.start(ctx)
+	offsets := newOffsetTracker()
+
+	lagGauge, lagErr := c.lag.register()
+	if lagErr != nil {
+		slog.ErrorContext(ctx, "consumer lag gauge init error", logging.Err(lagErr))
+	} else {
+		defer func() {
+			if err := lagGauge.Unregister(); err != nil {
+				slog.ErrorContext(ctx, "consumer lag gauge unregister error", logging.Err(err))
+			}
+		}()
+	}
+	stopLag := c.lag.start(ctx)
+	defer stopLag()
+
+	queues := make([]chan kafka.Message, c.workers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan kafka.Message, workerQueueSize)
+		wg.Add(1)
+		go func(queue <-chan kafka.Message) {
+			defer wg.Done()
+			ack := func(ctx context.Context, m kafka.Message) error {
+				if !m.Time.IsZero() {
+					c.latency.Record(ctx, time.Since(m.Time).Seconds())
+				}
+				if next, ok := offsets.done(m); ok {
+					if err := commits.markDone(ctx, next); err != nil {
+						return fmt.Errorf("kafka commit: %w", err)
+					}
+				}
+				return nil
+			}
+			if err := c.work(ctx, queue, ack); err != nil {
+				cancel(err)
+			}
+		}(queues[i])
+	}
+
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		wg.Wait()
+		stopCommits()
+
+		err = stopReason(parent, ctx, err)
+
+		flushCtx, flushCancel := context.WithTimeout(context.Background(), commitFlushTimeout)
+		defer flushCancel()
+		if flushErr := commits.flush(flushCtx); flushErr != nil {
+			err = errors.Join(err, fmt.Errorf("kafka commit on shutdown: %w", flushErr))
+		}
+	}()
 
 	for {
-		m, err := r.ReadMessage(ctx)
+		m, err := c.reader.FetchMessage(ctx)
 		if err != nil {
-			log.Printf("kafka read error: %v", err)
-			return
+			return fmt.Errorf("kafka fetch: %w", err)
 		}
 
-		var ord models.Order
-		if err := json.Unmarshal(m.Value, &ord); err != nil {
-			log.Printf("invalid message: %v", err)
-			sendToDLQ(ctx, dlqWriter, m, "unmarshal", err)
-			continue
+		c.consumed.Add(ctx, 1)
+		c.lag.observe(m)
+		offsets.track(m)
+		select {
+		case queues[c.workerFor(m)] <- m:
+		case <-ctx.Done():
+			return ctx.Err()
 		}
+	}
+}
+
+// workerFor выбирает воркера по ключу сообщения или по партиции.
+func (c *consumer) workerFor(m kafka.Message) int {
+	h := fnv.New32a()
+	if len(m.Key) > 0 {
+		_, _ = h.Write(m.Key)
+	} else {
+		_, _ = h.Write([]byte(intToString(m.Partition)))
+	}
+	return int(h.Sum32() % uint32(c.workers))
+}
+
+// stopReason определяет итоговую ошибку консьюмера: nil при штатной остановке,
+// иначе первую ошибку воркера или ошибку чтения.
+func stopReason(parent context.Context, ctx context.Context, err error) error {
+	if parent.Err() != nil {
+		return nil
+	}
+	if cause := context.Cause(ctx); cause != nil && !errors.Is(cause, context.Canceled) {
+		return cause
+	}
+	return err
+}
 
-		if err := validate.Struct(ord); err != nil {
-			log.Printf("validation failed for order: %v", err)
-			sendToDLQ(ctx, dlqWriter, m, "validation", err)
-			continue
+// pendingOrder — провалидированный заказ, ожидающий записи в БД, и span обработки его сообщения;
+// ctx — контекст обработки сообщения из startSpan.
+type pendingOrder struct {
+	ctx   context.Context
+	msg   kafka.Message
+	order *models.Order
+	span  trace.Span
+}
+
+// work обрабатывает очередь воркера, накапливая заказы в пачки.
+// Пачка записывается, когда набрано batchSize заказов или истек batchTimeout.
+// ack вызывается для каждого сообщения после сохранения заказа или записи в DLQ.
+// Ошибка означает, что воркер остановлен и необработанные сообщения нельзя фиксировать.
+// Если ctx отменен, начатая пачка записывается и подтверждается в контексте без отмены,
+// ограниченном batchDrainTimeout.
+func (c *consumer) work(ctx context.Context, queue <-chan kafka.Message, ack func(context.Context, kafka.Message) error) error {
+	batch := make([]pendingOrder, 0, c.batchSize)
+	timer := time.NewTimer(c.batchTimeout)
+	timer.Stop()
+	defer timer.Stop()
+
+	flush := func() error {
+		timer.Stop()
+		if len(batch) == 0 {
+			return nil
+		}
+		storeCtx := ctx
+		if ctx.Err() != nil {
+			// Начатая пачка дописывается с собственным ограничением, в том числе запись
+			// несохраненных заказов в DLQ через контексты сообщений.
+			deadline := time.Now().Add(batchDrainTimeout)
+			var cancel context.CancelFunc
+			storeCtx, cancel = context.WithDeadline(context.WithoutCancel(ctx), deadline)
+			defer cancel()
+			for i := range batch {
+				batch[i].ctx, cancel = context.WithDeadline(context.WithoutCancel(batch[i].ctx), deadline)
+				defer cancel()
+			}
 		}
+		err := c.storeBatch(storeCtx, batch, ack)
+		batch = batch[:0]
+		return err
+	}
 
-		err = retry.Do(ctx, retryPolicy, func() error {
-			return store.InsertOrder(ctx, &ord)
-		}, func(err error, attempt int, wait time.Duration) {
-			log.Printf("failed to save order to DB (attempt %d/%d): %v", attempt, maxRetries+1, err)
-			if wait > 0 {
-				log.Printf("retrying in %s", wait)
+	for {
+		select {
+		case m, ok := <-queue:
+			if !ok {
+				return flush()
+			}
+			if ctx.Err() != nil {
+				continue
+			}
+			msgCtx, span := startSpan(ctx, m)
+			ord, err := c.decode(msgCtx, m)
+			if err != nil {
+				span.End()
+				return err
+			}
+			if ord == nil {
+				err := ack(ctx, m)
+				span.End()
+				if err != nil {
+					return err
+				}
+				continue
+			}
+
+			if len(batch) == 0 {
+				timer.Reset(c.batchTimeout)
+			}
+			batch = append(batch, pendingOrder{ctx: msgCtx, msg: m, order: ord, span: span})
+			if len(batch) >= c.batchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-timer.C:
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// decode разбирает и валидирует сообщение.
+// Невалидное сообщение отправляется в DLQ, и тогда возвращается nil-заказ.
+func (c *consumer) decode(ctx context.Context, m kafka.Message) (*models.Order, error) {
+	ord, _, err := c.pipeline.Decode(ctx, m.Value)
+	var ingestErr *ingest.Error
+	if errors.As(err, &ingestErr) {
+		return nil, c.sendToDLQ(ctx, m, ingestErr.Stage, ingestErr.Err)
+	}
+	return ord, err
+}
+
+// storeBatch сохраняет пачку заказов через конвейер и подтверждает сообщения.
+// Заказы, которые не удалось сохранить, уходят в DLQ; устаревшие, вытесненные в пачке
+// и уже обработанные сообщения подтверждаются без записи.
+func (c *consumer) storeBatch(ctx context.Context, batch []pendingOrder, ack func(context.Context, kafka.Message) error) error {
+	defer func() {
+		for _, p := range batch {
+			p.span.End()
+		}
+	}()
+
+	orders := make([]*models.Order, len(batch))
+	sources := make(map[*models.Order]repository.Source, len(batch))
+	spans := make(map[*models.Order]trace.SpanContext, len(batch))
+	for i, p := range batch {
+		orders[i] = p.order
+		sources[p.order] = repository.Source{Topic: p.msg.Topic, Partition: p.msg.Partition, Offset: p.msg.Offset}
+		spans[p.order] = p.span.SpanContext()
+	}
+	results := c.pipeline.Store(ingest.WithSpanContexts(repository.WithSources(ctx, sources), spans), orders)
+
+	for i, p := range batch {
+		if results[i].Status == ingest.StatusFailed {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err := c.sendToDLQ(p.ctx, p.msg, ingest.StageStore, errors.Unwrap(results[i].Err)); err != nil {
+				return err
 			}
-		})
-		if err != nil {
-			sendToDLQ(ctx, dlqWriter, m, "db", err)
-			continue
 		}
+		if err := ack(ctx, p.msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-		mem.Save(&ord)
+// startSpan начинает span обработки сообщения m, продолжая трассировку продюсера
+// из заголовков сообщения. Записи лога с возвращенным контекстом содержат topic, partition
+// и offset сообщения.
+func startSpan(ctx context.Context, m kafka.Message) (context.Context, trace.Span) {
+	ctx = logging.With(ctx, "topic", m.Topic, "partition", m.Partition, "offset", m.Offset)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, (*HeaderCarrier)(&m.Headers))
+	return otel.Tracer(meterName).Start(ctx, m.Topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.operation.type", "process"),
+			attribute.String("messaging.destination.name", m.Topic),
+			attribute.String("messaging.destination.partition.id", intToString(m.Partition)),
+			attribute.Int64("messaging.kafka.offset", m.Offset),
+			attribute.String("messaging.kafka.message.key", string(m.Key)),
+		))
+}
 
-		log.Printf("successfully processed order %s", ord.OrderUID)
+// sendToDLQ пишет сообщение в DLQ и учитывает его в метрике dlq.messages с атрибутом stage.
+// Span обработки сообщения из ctx отмечается ошибкой, причина пишется в лог.
+func (c *consumer) sendToDLQ(ctx context.Context, m kafka.Message, stage string, err error) error {
+	slog.WarnContext(ctx, "sending message to dlq", "stage", stage, logging.Err(err))
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, stage+": "+err.Error())
+	if err := sendToDLQ(ctx, c.dlq, m, stage, err); err != nil {
+		return err
 	}
+	c.dlqSent.Add(ctx, 1, metric.WithAttributes(attribute.String("stage", stage)))
+	return nil
 }
 
-func sendToDLQ(ctx context.Context, w *kafka.Writer, m kafka.Message, stage string, err error) {
+// sendToDLQ пишет сообщение в DLQ с заголовками об ошибке и исходных координатах.
+// Для ошибки валидации *validation.Report нарушения добавляются в заголовок dlq_violations.
+// Запись выполняется в span продюсера, контекст которого передается в заголовках сообщения DLQ.
+func sendToDLQ(ctx context.Context, w messageWriter, m kafka.Message, stage string, err error) (sendErr error) {
+	ctx, span := otel.Tracer(meterName).Start(ctx, "dlq publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "kafka"),
+			attribute.String("messaging.operation.type", "publish"),
+			attribute.String("dlq.stage", stage),
+		))
+	defer func() {
+		if sendErr != nil {
+			span.RecordError(sendErr)
+			span.SetStatus(codes.Error, sendErr.Error())
+		}
+		span.End()
+	}()
+
 	headers := append([]kafka.Header{}, m.Headers...)
+	var report *validation.Report
+	if errors.As(err, &report) {
+		violations, marshalErr := json.Marshal(report.Violations)
+		if marshalErr != nil {
+			return fmt.Errorf("encode violations: %w", marshalErr)
+		}
+		headers = append(headers, kafka.Header{Key: headerDLQViolations, Value: violations})
+	}
 	headers = append(headers,
-		kafka.Header{Key: "dlq_error", Value: []byte(err.Error())},
-		kafka.Header{Key: "dlq_stage", Value: []byte(stage)},
-		kafka.Header{Key: "dlq_ts", Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))},
-		kafka.Header{Key: "dlq_topic", Value: []byte(m.Topic)},
-		kafka.Header{Key: "dlq_partition", Value: []byte(intToString(m.Partition))},
-		kafka.Header{Key: "dlq_offset", Value: []byte(int64ToString(m.Offset))},
+		kafka.Header{Key: headerDLQError, Value: []byte(err.Error())},
+		kafka.Header{Key: headerDLQStage, Value: []byte(stage)},
+		kafka.Header{Key: headerDLQTimestamp, Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))},
+		kafka.Header{Key: headerDLQTopic, Value: []byte(m.Topic)},
+		kafka.Header{Key: headerDLQPartition, Value: []byte(intToString(m.Partition))},
+		kafka.Header{Key: headerDLQOffset, Value: []byte(int64ToString(m.Offset))},
 	)
+	otel.GetTextMapPropagator().Inject(ctx, (*HeaderCarrier)(&headers))
 
 	dlqMsg := kafka.Message{
 		Key:     m.Key,
@@ -105,22 +428,9 @@ func sendToDLQ(ctx context.Context, w *kafka.Writer, m kafka.Message, stage stri
 		Headers: headers,
 	}
 	if err := w.WriteMessages(ctx, dlqMsg); err != nil {
-		log.Printf("dlq write error: %v", err)
-	}
-}
-
-func isRetriableDBError(err error) bool {
-	var pgErr *pgconn.PgError
-	if errors.As(err, &pgErr) {
-		if len(pgErr.Code) >= 2 && pgErr.Code[:2] == "08" {
-			return true
-		}
-	}
-	var netErr net.Error
-	if errors.As(err, &netErr) {
-		return netErr.Timeout()
+		return fmt.Errorf("dlq write: %w", err)
 	}
-	return false
+	return nil
 }
 
 func intToString(v int) string {
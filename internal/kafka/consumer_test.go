@@ -0,0 +1,968 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/config"
+	"github.com/RoGogDBD/wb/internal/ingest"
+	"github.com/RoGogDBD/wb/internal/models"
+	"github.com/RoGogDBD/wb/internal/repository"
+	"github.com/RoGogDBD/wb/internal/repository/mocks"
+	"github.com/RoGogDBD/wb/internal/validation"
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/noop"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	tracenoop "go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestConsumerCommitsAfterHandling(t *testing.T) {
+	valid := mustMarshal(t, testOrder())
+	invalid := testOrder()
+	invalid.Delivery.Phone = "bad"
+
+	tests := []struct {
+		name           string
+		commitInterval time.Duration
+		values         [][]byte
+		insertErr      error
+		wantStored     int
+		wantDLQ        int
+	}{
+		{
+			name:       "stored orders, sync commits",
+			values:     [][]byte{valid, mustMarshal(t, testOrder())},
+			wantStored: 2,
+		},
+		{
+			name:           "stored orders, batched commits",
+			commitInterval: 10 * time.Millisecond,
+			values:         [][]byte{valid, mustMarshal(t, testOrder()), mustMarshal(t, testOrder())},
+			wantStored:     3,
+		},
+		{
+			name:    "unmarshal and validation errors go to dlq",
+			values:  [][]byte{[]byte("{"), mustMarshal(t, invalid)},
+			wantDLQ: 2,
+		},
+		{
+			name:           "db error goes to dlq",
+			commitInterval: time.Hour,
+			values:         [][]byte{valid},
+			insertErr:      errors.New("constraint violation"),
+			wantDLQ:        1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := newFakeReader(tt.values)
+			dlq := &fakeWriter{}
+			dlq.writeFunc = func(msgs []kafka.Message) error {
+				for _, m := range msgs {
+					offset := headerValue(m, "dlq_offset")
+					if reader.isCommitted(offset) {
+						t.Errorf("message %s committed before dlq write", offset)
+					}
+					reader.markHandled()
+				}
+				return nil
+			}
+			store := &mocks.OrderStoreMock{
+				InsertOrderFunc: func(_ context.Context, o *models.Order) error {
+					if reader.isCommitted(reader.offsetOf(o.OrderUID)) {
+						t.Errorf("order %s committed before insert", o.OrderUID)
+					}
+					return tt.insertErr
+				},
+			}
+			cache := &mocks.CacheMock{
+				SaveFunc: func(_ *models.Order) {
+					reader.markHandled()
+				},
+			}
+
+			c := newTestConsumer(testKafkaConfig(tt.commitInterval, 1), validation.MustNewOrderValidator(nil), reader, dlq, store, cache)
+			if err := c.run(reader.ctx); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if cache.SaveCalls != tt.wantStored {
+				t.Fatalf("expected %d cached orders, got %d", tt.wantStored, cache.SaveCalls)
+			}
+			if len(dlq.written) != tt.wantDLQ {
+				t.Fatalf("expected %d dlq messages, got %d", tt.wantDLQ, len(dlq.written))
+			}
+			for i := range tt.values {
+				if !reader.isCommitted(int64ToString(int64(i))) {
+					t.Fatalf("offset %d not committed after shutdown", i)
+				}
+			}
+		})
+	}
+}
+
+func TestConsumerDoesNotCommitOnDLQFailure(t *testing.T) {
+	reader := newFakeReader([][]byte{[]byte("{")})
+	dlq := &fakeWriter{
+		writeFunc: func(_ []kafka.Message) error {
+			return errors.New("broker unavailable")
+		},
+	}
+
+	c := newTestConsumer(testKafkaConfig(0, 1), validation.MustNewOrderValidator(nil), reader, dlq, &mocks.OrderStoreMock{}, &mocks.CacheMock{})
+	if err := c.run(reader.ctx); err == nil {
+		t.Fatalf("expected error when dlq write fails")
+	}
+	if reader.isCommitted("0") {
+		t.Fatalf("message must not be committed when dlq write fails")
+	}
+}
+
+func TestConsumerRecordsSourceInHistory(t *testing.T) {
+	order := testOrder()
+	first := mustMarshal(t, order)
+	order.TrackNumber = "UPDATED"
+	second := mustMarshal(t, order)
+
+	reader := newFakeReader([][]byte{first, second})
+	store := repository.NewMemoryOrderStore()
+	cache := &mocks.CacheMock{
+		SaveFunc: func(_ *models.Order) {
+			reader.markHandled()
+		},
+	}
+
+	c := newTestConsumer(testKafkaConfig(0, 1), validation.MustNewOrderValidator(nil), reader, &fakeWriter{}, store, cache)
+	if err := c.run(reader.ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	versions, err := store.ListOrderVersions(context.Background(), order.OrderUID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("expected 2 versions, got %d", len(versions))
+	}
+	for i, v := range versions {
+		want := repository.Source{Topic: "orders", Partition: 0, Offset: int64(i)}
+		if v.Source == nil || *v.Source != want {
+			t.Fatalf("version %d: expected source %+v, got %+v", v.Version, want, v.Source)
+		}
+	}
+	if versions[1].Order.TrackNumber != "UPDATED" {
+		t.Fatalf("unexpected latest version: %+v", versions[1].Order)
+	}
+}
+
+func TestConsumerSkipsStaleOrders(t *testing.T) {
+	newer := testOrder()
+	newer.UpdatedAt = newer.DateCreated.Add(time.Hour)
+	store := repository.NewMemoryOrderStore()
+	if err := store.InsertOrder(context.Background(), newer); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stale := *newer
+	stale.UpdatedAt = newer.DateCreated
+	stale.TrackNumber = "STALE"
+	fresh := testOrder()
+
+	reader := newFakeReader([][]byte{mustMarshal(t, &stale), mustMarshal(t, fresh)})
+	cache := &mocks.CacheMock{
+		SaveFunc: func(_ *models.Order) {
+			reader.markHandled()
+		},
+	}
+	// устаревший заказ не сохраняется в кеш, поэтому считается обработанным вручную
+	reader.markHandled()
+
+	dlq := &fakeWriter{}
+	c := newTestConsumer(testKafkaConfig(0, 1), validation.MustNewOrderValidator(nil), reader, dlq, store, cache)
+	if err := c.run(reader.ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cache.SaveCalls != 1 || len(dlq.written) != 0 {
+		t.Fatalf("expected only the fresh order cached and no dlq writes, got %d and %d", cache.SaveCalls, len(dlq.written))
+	}
+	if !reader.isCommitted("0") || !reader.isCommitted("1") {
+		t.Fatalf("stale and fresh messages must both be committed")
+	}
+	got, err := store.GetOrderByID(context.Background(), newer.OrderUID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.TrackNumber != newer.TrackNumber {
+		t.Fatalf("stale order overwrote the stored one: %s", got.TrackNumber)
+	}
+}
+
+func TestConsumerSkipsDuplicateMessages(t *testing.T) {
+	processed := testOrder()
+	store := repository.NewMemoryOrderStore()
+	// сообщение с оффсетом 0 уже обработано до перезапуска консьюмера
+	ctx := repository.WithSources(context.Background(), map[*models.Order]repository.Source{
+		processed: {Topic: "orders", Partition: 0, Offset: 0},
+	})
+	if err := store.InsertOrder(ctx, processed); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	replayed := *processed
+	replayed.TrackNumber = "REPLAYED"
+	fresh := testOrder()
+
+	reader := newFakeReader([][]byte{mustMarshal(t, &replayed), mustMarshal(t, fresh)})
+	cache := &mocks.CacheMock{
+		SaveFunc: func(_ *models.Order) {
+			reader.markHandled()
+		},
+	}
+	// повторное сообщение не сохраняется в кеш, поэтому считается обработанным вручную
+	reader.markHandled()
+
+	dlq := &fakeWriter{}
+	c := newTestConsumer(testKafkaConfig(0, 1), validation.MustNewOrderValidator(nil), reader, dlq, store, cache)
+	if err := c.run(reader.ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cache.SaveCalls != 1 || len(dlq.written) != 0 {
+		t.Fatalf("expected only the fresh order cached and no dlq writes, got %d and %d", cache.SaveCalls, len(dlq.written))
+	}
+	if !reader.isCommitted("0") || !reader.isCommitted("1") {
+		t.Fatalf("duplicate and fresh messages must both be committed")
+	}
+	versions, err := store.ListOrderVersions(context.Background(), processed.OrderUID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(versions) != 1 || versions[0].Order.TrackNumber == "REPLAYED" {
+		t.Fatalf("duplicate message was applied: %d versions", len(versions))
+	}
+}
+
+func TestConsumerFinancialRuleModes(t *testing.T) {
+	mismatched := testOrder()
+	mismatched.Payment.Amount++
+	reader := newFakeReader([][]byte{mustMarshal(t, mismatched)})
+	store := repository.NewMemoryOrderStore()
+	cache := &mocks.CacheMock{
+		SaveFunc: func(_ *models.Order) {
+			reader.markHandled()
+		},
+	}
+
+	dlq := &fakeWriter{}
+	validate := validation.MustNewOrderValidator(validation.Rules{validation.RuleAmount: validation.ModeWarn})
+	c := newTestConsumer(testKafkaConfig(0, 1), validate, reader, dlq, store, cache)
+	if err := c.run(reader.ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(dlq.written) != 0 {
+		t.Fatalf("order violating a warn rule must not go to dlq")
+	}
+	if _, err := store.GetOrderByID(context.Background(), mismatched.OrderUID); err != nil {
+		t.Fatalf("order violating a warn rule must be stored: %v", err)
+	}
+
+	reader = newFakeReader([][]byte{mustMarshal(t, mismatched)})
+	dlq = &fakeWriter{
+		writeFunc: func(_ []kafka.Message) error {
+			reader.markHandled()
+			return nil
+		},
+	}
+	c = newTestConsumer(testKafkaConfig(0, 1), validation.MustNewOrderValidator(nil), reader, dlq, store, cache)
+	if err := c.run(reader.ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(dlq.written) != 1 || headerValue(dlq.written[0], "dlq_stage") != "validation" {
+		t.Fatalf("order violating a strict rule must go to dlq with validation stage")
+	}
+	var violations []validation.Violation
+	if err := json.Unmarshal([]byte(headerValue(dlq.written[0], "dlq_violations")), &violations); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(violations) != 1 || violations[0].Field != "payment.amount" || violations[0].Rule != validation.RuleAmount {
+		t.Fatalf("unexpected violations: %+v", violations)
+	}
+}
+
+func TestConsumerParallelKeepsPerKeyOrder(t *testing.T) {
+	const keysCount, versions, partitions = 8, 5, 3
+
+	var values [][]byte
+	var keys []string
+	for v := 0; v < versions; v++ {
+		for k := 0; k < keysCount; k++ {
+			o := testOrderWithID(uuid.NewSHA1(uuid.NameSpaceOID, []byte{byte(k)}).String())
+			o.TrackNumber = "seq-" + intToString(len(values))
+			values = append(values, mustMarshal(t, o))
+			keys = append(keys, o.OrderUID)
+		}
+	}
+
+	reader := newFakeReaderWithKeys(values, keys, partitions)
+
+	var mu sync.Mutex
+	handled := make(map[int64]bool)
+	lastSeq := make(map[string]int)
+	inFlight, maxInFlight := 0, 0
+
+	reader.onCommit = func(m kafka.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, prev := range reader.messages {
+			if prev.Partition == m.Partition && prev.Offset <= m.Offset && !handled[prev.Offset] {
+				t.Errorf("offset %d committed before offset %d was handled", m.Offset, prev.Offset)
+			}
+		}
+	}
+
+	store := &mocks.OrderStoreMock{
+		InsertOrderFunc: func(_ context.Context, o *models.Order) error {
+			seq, _ := strconv.Atoi(strings.TrimPrefix(o.TrackNumber, "seq-"))
+
+			mu.Lock()
+			if prev, ok := lastSeq[o.OrderUID]; ok && prev > seq {
+				t.Errorf("order %s reordered: %d after %d", o.OrderUID, seq, prev)
+			}
+			lastSeq[o.OrderUID] = seq
+			inFlight++
+			maxInFlight = max(maxInFlight, inFlight)
+			mu.Unlock()
+
+			// Более ранние сообщения обрабатываются дольше, чтобы завершение шло не по порядку
+			time.Sleep(time.Duration(len(values)-seq) * 100 * time.Microsecond)
+
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+			return nil
+		},
+	}
+	cache := &mocks.CacheMock{
+		SaveFunc: func(o *models.Order) {
+			seq, _ := strconv.Atoi(strings.TrimPrefix(o.TrackNumber, "seq-"))
+			mu.Lock()
+			handled[int64(seq)] = true
+			mu.Unlock()
+			reader.markHandled()
+		},
+	}
+
+	c := newTestConsumer(testKafkaConfig(0, 4), validation.MustNewOrderValidator(nil), reader, &fakeWriter{}, store, cache)
+	if err := c.run(reader.ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if maxInFlight < 2 {
+		t.Fatalf("expected parallel processing, max in flight %d", maxInFlight)
+	}
+	for i := range values {
+		if !reader.isCommitted(intToString(i)) {
+			t.Fatalf("offset %d not committed after shutdown", i)
+		}
+	}
+}
+
+func TestConsumerBatchIsolatesFailedOrders(t *testing.T) {
+	bad := testOrder()
+	values := [][]byte{
+		mustMarshal(t, testOrder()),
+		mustMarshal(t, bad),
+		mustMarshal(t, testOrder()),
+	}
+	reader := newFakeReader(values)
+
+	var mu sync.Mutex
+	var batchSizes []int
+	store := &mocks.OrderStoreMock{
+		InsertOrdersFunc: func(_ context.Context, orders []*models.Order) []error {
+			mu.Lock()
+			batchSizes = append(batchSizes, len(orders))
+			mu.Unlock()
+			errs := make([]error, len(orders))
+			for i, o := range orders {
+				if o.OrderUID == bad.OrderUID {
+					errs[i] = errors.New("check constraint violated")
+				}
+			}
+			return errs
+		},
+	}
+	dlq := &fakeWriter{
+		writeFunc: func(msgs []kafka.Message) error {
+			for range msgs {
+				reader.markHandled()
+			}
+			return nil
+		},
+	}
+	cache := &mocks.CacheMock{
+		SaveFunc: func(o *models.Order) {
+			if o.OrderUID == bad.OrderUID {
+				t.Errorf("failed order %s must not be cached", o.OrderUID)
+			}
+			reader.markHandled()
+		},
+	}
+
+	cfg := testKafkaConfig(0, 1)
+	cfg.BatchSize = len(values)
+	cfg.BatchTimeout = time.Hour
+	c := newTestConsumer(cfg, validation.MustNewOrderValidator(nil), reader, dlq, store, cache)
+	if err := c.run(reader.ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(batchSizes) != 1 || batchSizes[0] != len(values) {
+		t.Fatalf("expected one batch of %d orders, got %v", len(values), batchSizes)
+	}
+	if len(dlq.written) != 1 || orderUIDOf(dlq.written[0].Value) != bad.OrderUID {
+		t.Fatalf("expected only the failed order in dlq, got %d messages", len(dlq.written))
+	}
+	if store.InsertOrderCalls != 0 {
+		t.Fatalf("non-retriable error must not be retried, got %d single inserts", store.InsertOrderCalls)
+	}
+	for i := range values {
+		if !reader.isCommitted(intToString(i)) {
+			t.Fatalf("offset %d not committed after shutdown", i)
+		}
+	}
+}
+
+// newTestConsumer создает консьюмер с конвейером приема поверх store и cache.
+func TestConsumerStoresStartedBatchOnShutdown(t *testing.T) {
+	first, second := testOrder(), testOrder()
+	reader := newFakeReader([][]byte{mustMarshal(t, first), mustMarshal(t, second)})
+	store := repository.NewMemoryOrderStore()
+
+	cfg := testKafkaConfig(0, 1)
+	cfg.BatchSize = 10
+	cfg.BatchTimeout = time.Hour
+	c := newTestConsumer(cfg, validation.MustNewOrderValidator(nil), reader, &fakeWriter{}, store, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- c.run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		reader.mu.Lock()
+		fetched := reader.next
+		reader.mu.Unlock()
+		if fetched == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("consumer did not fetch the messages")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	// пачка не заполнена и ее таймер не истечет, поэтому она записывается только при остановке
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("consumer did not stop")
+	}
+
+	for _, o := range []*models.Order{first, second} {
+		if _, err := store.GetOrderByID(context.Background(), o.OrderUID); err != nil {
+			t.Fatalf("order %s from the started batch was not stored: %v", o.OrderUID, err)
+		}
+	}
+	if !reader.isCommitted("0") || !reader.isCommitted("1") {
+		t.Fatalf("messages of the started batch must be committed")
+	}
+}
+
+func newTestConsumer(cfg config.KafkaConfig, validate *validation.OrderValidator, reader messageReader, dlq messageWriter, store repository.OrderStore, cache repository.CacheWriter) *consumer {
+	return newConsumer(cfg, ingest.NewPipeline(cfg, validate, store, cache), reader, dlq)
+}
+
+// fakeReader отдает заданные сообщения и отменяет контекст,
+// когда все они прочитаны и обработаны.
+type fakeReader struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu        sync.Mutex
+	messages  []kafka.Message
+	next      int
+	handled   int
+	drained   chan struct{}
+	committed map[string]bool
+	onCommit  func(m kafka.Message)
+}
+
+func newFakeReader(values [][]byte) *fakeReader {
+	return newFakeReaderWithKeys(values, nil, 1)
+}
+
+// newFakeReaderWithKeys распределяет сообщения по партициям по кругу.
+func newFakeReaderWithKeys(values [][]byte, keys []string, partitions int) *fakeReader {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &fakeReader{
+		ctx:       ctx,
+		cancel:    cancel,
+		drained:   make(chan struct{}),
+		committed: make(map[string]bool),
+	}
+	for i, v := range values {
+		key := orderUIDOf(v)
+		if keys != nil {
+			key = keys[i]
+		}
+		r.messages = append(r.messages, kafka.Message{
+			Topic:     "orders",
+			Partition: i % partitions,
+			Offset:    int64(i),
+			Key:       []byte(key),
+			Value:     v,
+		})
+	}
+	if len(values) == 0 {
+		close(r.drained)
+	}
+	return r
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.mu.Lock()
+	if r.next < len(r.messages) {
+		m := r.messages[r.next]
+		r.next++
+		r.mu.Unlock()
+		return m, nil
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-r.drained:
+		r.cancel()
+	case <-ctx.Done():
+	}
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	for _, m := range msgs {
+		if r.onCommit != nil {
+			r.onCommit(m)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range msgs {
+		// Фиксация оффсета подтверждает и все предыдущие сообщения партиции
+		for _, prev := range r.messages {
+			if prev.Partition == m.Partition && prev.Offset <= m.Offset {
+				r.committed[int64ToString(prev.Offset)] = true
+			}
+		}
+	}
+	return nil
+}
+
+// markHandled отмечает одно сообщение обработанным.
+func (r *fakeReader) markHandled() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handled++
+	if r.handled == len(r.messages) {
+		close(r.drained)
+	}
+}
+
+func (r *fakeReader) isCommitted(offset string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.committed[offset]
+}
+
+func (r *fakeReader) offsetOf(orderUID string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range r.messages {
+		if string(m.Key) == orderUID {
+			return int64ToString(m.Offset)
+		}
+	}
+	return ""
+}
+
+type fakeWriter struct {
+	mu        sync.Mutex
+	writeFunc func(msgs []kafka.Message) error
+	written   []kafka.Message
+}
+
+func (w *fakeWriter) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.writeFunc != nil {
+		if err := w.writeFunc(msgs); err != nil {
+			return err
+		}
+	}
+	w.written = append(w.written, msgs...)
+	return nil
+}
+
+func headerValue(m kafka.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+func orderUIDOf(value []byte) string {
+	var o models.Order
+	if err := json.Unmarshal(value, &o); err != nil {
+		return ""
+	}
+	return o.OrderUID
+}
+
+func mustMarshal(t *testing.T, o *models.Order) []byte {
+	t.Helper()
+	data, err := json.Marshal(o)
+	if err != nil {
+		t.Fatalf("marshal order: %v", err)
+	}
+	return data
+}
+
+func testKafkaConfig(commitInterval time.Duration, workers int) config.KafkaConfig {
+	return config.KafkaConfig{
+		Topic:          "orders",
+		DLQTopic:       "orders.dlq",
+		CommitInterval: commitInterval,
+		Workers:        workers,
+	}
+}
+
+func testOrder() *models.Order {
+	return testOrderWithID(uuid.New().String())
+}
+
+func testOrderWithID(id string) *models.Order {
+	return &models.Order{
+		OrderUID:    id,
+		TrackNumber: "TRACK-" + id[:8],
+		Entry:       "WBIL",
+		Delivery: models.Delivery{
+			Name:    "Test",
+			Phone:   "+79001234567",
+			Zip:     "123456",
+			City:    "City",
+			Address: "Street 1",
+			Region:  "Region",
+			Email:   "test@example.com",
+		},
+		Payment: models.Payment{
+			Transaction:  id,
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       60,
+			PaymentDt:    time.Now().Unix(),
+			Bank:         "alpha",
+			DeliveryCost: 10,
+			GoodsTotal:   50,
+			CustomFee:    0,
+		},
+		Items: []models.Item{
+			{
+				ChrtID:      1,
+				TrackNumber: "TRACK-" + id[:8],
+				Price:       50,
+				Rid:         "rid",
+				Name:        "item",
+				Sale:        0,
+				Size:        "0",
+				TotalPrice:  50,
+				NmID:        1,
+				Brand:       "brand",
+				Status:      202,
+			},
+		},
+		Locale:          "en",
+		CustomerID:      "customer",
+		DeliveryService: "meest",
+		ShardKey:        "9",
+		SmID:            1,
+		DateCreated:     time.Now(),
+		OofShard:        "1",
+	}
+}
+
+func TestConsumerMetrics(t *testing.T) {
+	metrics := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(metrics)))
+	t.Cleanup(func() { otel.SetMeterProvider(noop.NewMeterProvider()) })
+
+	reader := newFakeReader([][]byte{[]byte("{"), mustMarshal(t, testOrder())})
+	for i := range reader.messages {
+		reader.messages[i].HighWaterMark = 5
+		reader.messages[i].Time = time.Now().Add(-time.Second)
+	}
+	dlq := &fakeWriter{}
+	dlq.writeFunc = func(msgs []kafka.Message) error {
+		reader.markHandled()
+		return nil
+	}
+	var lag map[string]float64
+	cache := &mocks.CacheMock{
+		SaveFunc: func(_ *models.Order) {
+			// отставание наблюдается, пока консьюмер работает
+			lag = collectMetrics(t, metrics)
+			reader.markHandled()
+		},
+	}
+
+	c := newTestConsumer(testKafkaConfig(0, 1), validation.MustNewOrderValidator(nil), reader, dlq, repository.NewMemoryOrderStore(), cache)
+	if err := c.run(reader.ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := lag["kafka.consumer.lag{partition=0,topic=orders}"]; got != 3 {
+		t.Errorf("expected lag 3, got %v (%v)", got, lag)
+	}
+	got := collectMetrics(t, metrics)
+	want := map[string]float64{
+		"messages.consumed":                  2,
+		"dlq.messages{stage=unmarshal}":      1,
+		"orders.stored":                      1,
+		"orders.insert.duration{mode=batch}": 1,
+		"messages.latency":                   2,
+	}
+	for name, v := range want {
+		if got[name] != v {
+			t.Errorf("%s: expected %v, got %v", name, v, got[name])
+		}
+	}
+}
+
+// collectMetrics собирает значения метрик по имени и атрибутам в виде name{k=v,...};
+// для гистограмм возвращается число измерений.
+func collectMetrics(t *testing.T, reader sdkmetric.Reader) map[string]float64 {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("collect metrics: %v", err)
+	}
+	values := make(map[string]float64)
+	key := func(name string, attrs attribute.Set) string {
+		if attrs.Len() == 0 {
+			return name
+		}
+		return name + "{" + attrs.Encoded(attribute.DefaultEncoder()) + "}"
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, dp := range data.DataPoints {
+					values[key(m.Name, dp.Attributes)] += float64(dp.Value)
+				}
+			case metricdata.Gauge[int64]:
+				for _, dp := range data.DataPoints {
+					values[key(m.Name, dp.Attributes)] = float64(dp.Value)
+				}
+			case metricdata.Histogram[float64]:
+				for _, dp := range data.DataPoints {
+					values[key(m.Name, dp.Attributes)] += float64(dp.Count)
+				}
+			}
+		}
+	}
+	return values
+}
+
+func TestLagTrackerQueriesHighWaterMarks(t *testing.T) {
+	metrics := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(metrics)))
+	t.Cleanup(func() { otel.SetMeterProvider(noop.NewMeterProvider()) })
+
+	var mark int64
+	var queryErr error
+	var queries int
+	tracker := newLagTracker(func(_ context.Context, topic string, partitions []int) (map[int]int64, error) {
+		queries++
+		if topic != "orders" || len(partitions) != 1 || partitions[0] != 0 {
+			t.Errorf("unexpected query %s %v", topic, partitions)
+		}
+		return map[int]int64{0: mark}, queryErr
+	})
+	reg, err := tracker.register()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = reg.Unregister() })
+
+	tracker.observe(kafka.Message{Topic: "orders", Partition: 0, Offset: 4, HighWaterMark: 6})
+	tests := []struct {
+		name     string
+		mark     int64
+		queryErr error
+		want     float64
+	}{
+		{name: "high watermark from message", mark: 0, want: 1},
+		// консьюмер больше не получает сообщений, а продюсеры продолжают писать
+		{name: "stalled consumer", mark: 20, want: 15},
+		{name: "query error keeps last known", mark: 0, queryErr: errors.New("broker down"), want: 15},
+	}
+	for _, tt := range tests {
+		mark, queryErr = tt.mark, tt.queryErr
+		if err := tracker.refresh(context.Background()); (err != nil) != (tt.queryErr != nil) {
+			t.Errorf("%s: unexpected refresh error: %v", tt.name, err)
+		}
+		lag := collectMetrics(t, metrics)
+		if got := lag["kafka.consumer.lag{partition=0,topic=orders}"]; got != tt.want {
+			t.Errorf("%s: expected lag %v, got %v", tt.name, tt.want, got)
+		}
+	}
+	if queries != len(tests) {
+		t.Errorf("collection must not query brokers: expected %d queries, got %d", len(tests), queries)
+	}
+}
+
+func TestLagTrackerDropsReassignedPartitions(t *testing.T) {
+	metrics := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(metrics)))
+	t.Cleanup(func() { otel.SetMeterProvider(noop.NewMeterProvider()) })
+
+	tracker := newLagTracker(nil)
+	reg, err := tracker.register()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = reg.Unregister() })
+
+	tracker.observe(kafka.Message{Topic: "orders", Partition: 0, Offset: 4, HighWaterMark: 10})
+	tracker.observe(kafka.Message{Topic: "orders", Partition: 1, Offset: 4, HighWaterMark: 10})
+	tracker.prune()
+	if lag := collectMetrics(t, metrics); len(lag) != 2 {
+		t.Fatalf("expected lag of both partitions, got %v", lag)
+	}
+
+	// партиция 0 отдана другому участнику группы, из партиции 1 сообщения продолжают приходить
+	tracker.partitions[topicPartition{topic: "orders", partition: 0}].fetched = time.Now().Add(-2 * tracker.ttl)
+	tracker.prune()
+	lag := collectMetrics(t, metrics)
+	if _, ok := lag["kafka.consumer.lag{partition=0,topic=orders}"]; ok || len(lag) != 1 {
+		t.Fatalf("expected only partition 1 to be reported, got %v", lag)
+	}
+}
+
+func TestConsumerPropagatesTraceContext(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(tracenoop.NewTracerProvider())
+		otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	})
+
+	producerCtx, producer := otel.Tracer("test").Start(context.Background(), "orders publish")
+	producer.End()
+	traceID := producer.SpanContext().TraceID()
+
+	retried := testOrder()
+	reader := newFakeReader([][]byte{[]byte("{"), mustMarshal(t, retried)})
+	for i := range reader.messages {
+		otel.GetTextMapPropagator().Inject(producerCtx, (*HeaderCarrier)(&reader.messages[i].Headers))
+	}
+	dlq := &fakeWriter{}
+	dlq.writeFunc = func(msgs []kafka.Message) error {
+		reader.markHandled()
+		return nil
+	}
+	attempts := 0
+	store := &mocks.OrderStoreMock{
+		InsertOrderFunc: func(_ context.Context, _ *models.Order) error {
+			attempts++
+			if attempts == 1 {
+				return repository.ErrUnavailable
+			}
+			return nil
+		},
+	}
+	cache := &mocks.CacheMock{SaveFunc: func(_ *models.Order) { reader.markHandled() }}
+
+	cfg := testKafkaConfig(0, 1)
+	cfg.DLQMaxRetries = 1
+	c := newTestConsumer(cfg, validation.MustNewOrderValidator(nil), reader, dlq, store, cache)
+	if err := c.run(reader.ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	byName := make(map[string][]sdktrace.ReadOnlySpan)
+	for _, s := range spans.Ended() {
+		byName[s.Name()] = append(byName[s.Name()], s)
+	}
+	process := byName["orders process"]
+	if len(process) != 2 {
+		t.Fatalf("expected 2 consumer spans, got %d", len(process))
+	}
+	for _, s := range process {
+		if s.SpanKind() != trace.SpanKindConsumer || s.Parent().SpanID() != producer.SpanContext().SpanID() {
+			t.Fatalf("consumer span must continue the producer trace, got parent %v", s.Parent())
+		}
+	}
+	for _, name := range []string{"unmarshal", "validation", "InsertOrder", "dlq publish"} {
+		if len(byName[name]) == 0 {
+			t.Fatalf("expected %q span, got %v", name, byName)
+		}
+		for _, s := range byName[name] {
+			if s.SpanContext().TraceID() != traceID {
+				t.Fatalf("%q span is not in the producer trace", name)
+			}
+		}
+	}
+	// запись пачкой охватывает несколько трассировок и связана со span сообщений ссылками
+	if batch := byName["InsertOrders"]; len(batch) != 1 || len(batch[0].Links()) != 1 ||
+		batch[0].Links()[0].SpanContext.SpanID() != process[1].SpanContext().SpanID() {
+		t.Fatalf("batch insert span must link to the message span, got %v", batch)
+	}
+	if retry := byName["InsertOrder"][0]; retry.Parent().SpanID() != process[1].SpanContext().SpanID() {
+		t.Fatalf("retry attempt span must be a child of the message span")
+	}
+
+	if len(dlq.written) != 1 {
+		t.Fatalf("expected 1 dlq message, got %d", len(dlq.written))
+	}
+	dlqCtx := otel.GetTextMapPropagator().Extract(context.Background(), (*HeaderCarrier)(&dlq.written[0].Headers))
+	dlqSpan := trace.SpanContextFromContext(dlqCtx)
+	if dlqSpan.TraceID() != traceID || dlqSpan.SpanID() != byName["dlq publish"][0].SpanContext().SpanID() {
+		t.Fatalf("dlq headers must carry the dlq publish span, got %v", dlqSpan)
+	}
+}
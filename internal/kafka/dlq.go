@@ -0,0 +1,505 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/config"
+	"github.com/RoGogDBD/wb/internal/ingest"
+	"github.com/RoGogDBD/wb/internal/logging"
+	"github.com/RoGogDBD/wb/internal/models"
+	"github.com/RoGogDBD/wb/internal/repository"
+	"github.com/RoGogDBD/wb/internal/validation"
+	"github.com/segmentio/kafka-go"
+)
+
+// Заголовки, которые консьюмер добавляет к сообщениям в DLQ.
+const (
+	headerDLQError     = "dlq_error"
+	headerDLQStage     = "dlq_stage"
+	headerDLQTimestamp = "dlq_ts"
+	headerDLQTopic     = "dlq_topic"
+	headerDLQPartition = "dlq_partition"
+	headerDLQOffset    = "dlq_offset"
+	// headerDLQViolations — JSON-список нарушений валидации (validation.Violation).
+	headerDLQViolations = "dlq_violations"
+	// headerReplayAttempts считает переотправки сообщения из DLQ в основной топик.
+	headerReplayAttempts = "dlq_replay_attempts"
+)
+
+const (
+	// dlqMetadataTimeout ограничивает запросы списка партиций и их оффсетов.
+	dlqMetadataTimeout = 10 * time.Second
+	// dlqIdleTimeout — сколько ждать следующего сообщения партиции, прежде чем считать ее дочитанной.
+	dlqIdleTimeout = 2 * time.Second
+)
+
+// ReplayTarget определяет, куда переотправляются сообщения из DLQ.
+type ReplayTarget string
+
+const (
+	// ReplayToTopic отправляет сообщения обратно в основной топик.
+	ReplayToTopic ReplayTarget = "topic"
+	// ReplayToStore сохраняет заказы напрямую в OrderStore.
+	ReplayToStore ReplayTarget = "store"
+)
+
+// Статусы результата переотправки.
+const (
+	ReplayStatusReplayed = "replayed"
+	ReplayStatusSkipped  = "skipped"
+	ReplayStatusFailed   = "failed"
+)
+
+// DLQMessage описывает сообщение из DLQ с разобранными заголовками.
+type DLQMessage struct {
+	ID              string    `json:"id"`
+	Partition       int       `json:"partition"`
+	Offset          int64     `json:"offset"`
+	Key             string    `json:"key"`
+	Stage           string    `json:"stage"`
+	Error           string    `json:"error"`
+	FailedAt        time.Time `json:"failed_at"`
+	SourceTopic     string    `json:"source_topic"`
+	SourcePartition int       `json:"source_partition"`
+	SourceOffset    int64     `json:"source_offset"`
+	ReplayAttempts  int       `json:"replay_attempts"`
+	// Violations — нарушения валидации из заголовка dlq_violations.
+	Violations []validation.Violation `json:"violations,omitempty"`
+	Payload    json.RawMessage        `json:"payload,omitempty" swaggertype:"object"`
+	RawPayload string                 `json:"raw_payload,omitempty"`
+
+	msg kafka.Message
+}
+
+// DLQFilter задает условия отбора сообщений из DLQ. Пустые поля не ограничивают выборку.
+type DLQFilter struct {
+	Stage         string
+	ErrorContains string
+	// Rule — правило валидации, которое нарушает заказ.
+	Rule  string
+	From  time.Time
+	To    time.Time
+	Limit int
+}
+
+// Match сообщает, подходит ли сообщение под фильтр.
+func (f DLQFilter) Match(m DLQMessage) bool {
+	if f.Stage != "" && m.Stage != f.Stage {
+		return false
+	}
+	if f.ErrorContains != "" && !strings.Contains(strings.ToLower(m.Error), strings.ToLower(f.ErrorContains)) {
+		return false
+	}
+	if f.Rule != "" && !slices.ContainsFunc(m.Violations, func(v validation.Violation) bool { return v.Rule == f.Rule }) {
+		return false
+	}
+	if !f.From.IsZero() && m.FailedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && m.FailedAt.After(f.To) {
+		return false
+	}
+	return true
+}
+
+// ReplayRequest описывает запрос на переотправку сообщений из DLQ.
+// Без All переотправляются только сообщения с идентификаторами из IDs.
+type ReplayRequest struct {
+	IDs    []string     `json:"ids"`
+	All    bool         `json:"all"`
+	Target ReplayTarget `json:"target"`
+	Force  bool         `json:"force"`
+	Filter DLQFilter    `json:"-"`
+}
+
+// ReplayResult описывает результат переотправки одного сообщения.
+type ReplayResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Violations — нарушения валидации, если заказ не прошел проверку при переотправке в хранилище.
+	Violations []validation.Violation `json:"violations,omitempty"`
+}
+
+// ScanError сообщает, что чтение DLQ-топика прервано. Сообщения до LastID включительно
+// прочитаны, и List и Replay возвращают результаты по ним вместе с ScanError.
+type ScanError struct {
+	// LastID — идентификатор последнего прочитанного сообщения; пустой, если не прочитано ни одного.
+	LastID string
+	Err    error
+}
+
+func (e *ScanError) Error() string {
+	if e.LastID == "" {
+		return fmt.Sprintf("dlq scan failed: %v", e.Err)
+	}
+	return fmt.Sprintf("dlq scan stopped after %s: %v", e.LastID, e.Err)
+}
+
+func (e *ScanError) Unwrap() error {
+	return e.Err
+}
+
+// DLQ читает сообщения из DLQ-топика и переотправляет их.
+type DLQ struct {
+	// read передает сообщения топика в visit по одному, пока visit не вернет false.
+	read       func(ctx context.Context, visit func(kafka.Message) bool) error
+	writer     messageWriter
+	closer     func() error
+	pipeline   *ingest.Pipeline
+	maxReplays int
+}
+
+// NewDLQ создает DLQ для топика cfg.DLQTopic с переотправкой в cfg.Topic.
+// Заказы переотправляются в хранилище конвейером приема pipeline так же, как при чтении
+// из основного топика; если pipeline nil, переотправка в хранилище недоступна.
+func NewDLQ(cfg config.KafkaConfig, pipeline *ingest.Pipeline) *DLQ {
+	w := &kafka.Writer{
+		Addr:     kafka.TCP(cfg.Brokers...),
+		Topic:    cfg.Topic,
+		Balancer: &kafka.Hash{},
+	}
+	brokers := cfg.Brokers
+	topic := cfg.DLQTopic
+	return &DLQ{
+		read: func(ctx context.Context, visit func(kafka.Message) bool) error {
+			return readTopic(ctx, brokers, topic, visit)
+		},
+		writer:     w,
+		closer:     w.Close,
+		pipeline:   pipeline,
+		maxReplays: cfg.DLQMaxReplays,
+	}
+}
+
+// Close освобождает writer основного топика.
+func (d *DLQ) Close() error {
+	if d.closer == nil {
+		return nil
+	}
+	return d.closer()
+}
+
+// List возвращает сообщения DLQ, подходящие под фильтр, в порядке партиций и оффсетов.
+// Чтение топика прекращается, как только набрано filter.Limit сообщений.
+// Если чтение прервано, возвращаются найденные до этого сообщения и *ScanError.
+func (d *DLQ) List(ctx context.Context, filter DLQFilter) ([]DLQMessage, error) {
+	var msgs []DLQMessage
+	err := d.scan(ctx, filter, func(m DLQMessage) bool {
+		msgs = append(msgs, m)
+		return filter.Limit <= 0 || len(msgs) < filter.Limit
+	})
+	return msgs, err
+}
+
+// scan передает в visit подходящие под фильтр сообщения, пока visit не вернет false.
+// Ошибка чтения возвращается как *ScanError.
+func (d *DLQ) scan(ctx context.Context, filter DLQFilter, visit func(DLQMessage) bool) error {
+	var lastID string
+	err := d.read(ctx, func(m kafka.Message) bool {
+		dm := parseDLQMessage(m)
+		lastID = dm.ID
+		if !filter.Match(dm) {
+			return true
+		}
+		return visit(dm)
+	})
+	if err != nil {
+		return &ScanError{LastID: lastID, Err: err}
+	}
+	return nil
+}
+
+// Replay переотправляет выбранные сообщения в основной топик или в хранилище.
+// Сообщения, исчерпавшие лимит переотправок, пропускаются без Force.
+// Если чтение топика прервано, переотправляются найденные до этого сообщения,
+// а вместе с результатами возвращается *ScanError.
+func (d *DLQ) Replay(ctx context.Context, req ReplayRequest) ([]ReplayResult, error) {
+	if req.Target == "" {
+		req.Target = ReplayToTopic
+	}
+	if req.Target != ReplayToTopic && req.Target != ReplayToStore {
+		return nil, fmt.Errorf("unknown replay target %q", req.Target)
+	}
+	if req.Target == ReplayToStore && d.pipeline == nil {
+		return nil, errors.New("replay to store requires a database")
+	}
+	if !req.All && len(req.IDs) == 0 {
+		return nil, errors.New("no messages selected for replay")
+	}
+
+	selected := make(map[string]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		selected[id] = true
+	}
+
+	// без All чтение топика прекращается, как только найдены все выбранные сообщения
+	filter := req.Filter
+	filter.Limit = 0
+	var msgs []DLQMessage
+	scanErr := d.scan(ctx, filter, func(m DLQMessage) bool {
+		if !req.All && !selected[m.ID] {
+			return true
+		}
+		delete(selected, m.ID)
+		msgs = append(msgs, m)
+		return req.All || len(selected) > 0
+	})
+	if scanErr != nil && ctx.Err() != nil {
+		return nil, scanErr
+	}
+
+	var results []ReplayResult
+	for _, m := range msgs {
+
+		if d.maxReplays > 0 && m.ReplayAttempts >= d.maxReplays && !req.Force {
+			results = append(results, ReplayResult{
+				ID:     m.ID,
+				Status: ReplayStatusSkipped,
+				Error:  fmt.Sprintf("replay limit reached (%d attempts)", m.ReplayAttempts),
+			})
+			continue
+		}
+
+		var replayErr error
+		switch req.Target {
+		case ReplayToTopic:
+			replayErr = d.writer.WriteMessages(ctx, replayMessage(m))
+		case ReplayToStore:
+			replayErr = d.replayToStore(ctx, m)
+		}
+		if errors.Is(replayErr, repository.ErrStale) || errors.Is(replayErr, repository.ErrDuplicate) {
+			slog.InfoContext(ctx, "dlq replay skipped", "dlq_id", m.ID, logging.Err(replayErr))
+			results = append(results, ReplayResult{ID: m.ID, Status: ReplayStatusSkipped, Error: replayErr.Error()})
+			continue
+		}
+		if replayErr != nil {
+			if ctx.Err() != nil {
+				return results, ctx.Err()
+			}
+			slog.WarnContext(ctx, "dlq replay failed", "dlq_id", m.ID, logging.Err(replayErr))
+			result := ReplayResult{ID: m.ID, Status: ReplayStatusFailed, Error: replayErr.Error()}
+			var report *validation.Report
+			if errors.As(replayErr, &report) {
+				result.Violations = report.Violations
+			}
+			results = append(results, result)
+			continue
+		}
+		results = append(results, ReplayResult{ID: m.ID, Status: ReplayStatusReplayed})
+	}
+
+	notFound := "message not found"
+	if scanErr != nil {
+		notFound = "dlq scan stopped before the message was found"
+	}
+	for _, id := range req.IDs {
+		if selected[id] {
+			results = append(results, ReplayResult{ID: id, Status: ReplayStatusFailed, Error: notFound})
+		}
+	}
+	return results, scanErr
+}
+
+// replayToStore разбирает, проверяет и сохраняет заказ конвейером приема в обход Kafka.
+func (d *DLQ) replayToStore(ctx context.Context, m DLQMessage) error {
+	ctx = logging.With(ctx, "dlq_id", m.ID)
+	ord, _, err := d.pipeline.Decode(ctx, m.msg.Value)
+	if err != nil {
+		return err
+	}
+	// в историю заказа и журнал обработанных сообщений записываются координаты
+	// исходного сообщения, а не сообщения DLQ
+	ctx = repository.WithSources(ctx, map[*models.Order]repository.Source{
+		ord: {Topic: m.SourceTopic, Partition: m.SourcePartition, Offset: m.SourceOffset},
+	})
+	return d.pipeline.Store(ctx, []*models.Order{ord})[0].Err
+}
+
+// parseDLQMessage разбирает заголовки и полезную нагрузку сообщения DLQ.
+func parseDLQMessage(m kafka.Message) DLQMessage {
+	dm := DLQMessage{
+		ID:        DLQMessageID(m.Partition, m.Offset),
+		Partition: m.Partition,
+		Offset:    m.Offset,
+		Key:       string(m.Key),
+		FailedAt:  m.Time,
+		msg:       m,
+	}
+	for _, h := range m.Headers {
+		value := string(h.Value)
+		switch h.Key {
+		case headerDLQError:
+			dm.Error = value
+		case headerDLQStage:
+			dm.Stage = value
+		case headerDLQTimestamp:
+			if ts, err := time.Parse(time.RFC3339Nano, value); err == nil {
+				dm.FailedAt = ts
+			}
+		case headerDLQTopic:
+			dm.SourceTopic = value
+		case headerDLQPartition:
+			dm.SourcePartition, _ = strconv.Atoi(value)
+		case headerDLQOffset:
+			dm.SourceOffset, _ = strconv.ParseInt(value, 10, 64)
+		case headerReplayAttempts:
+			dm.ReplayAttempts, _ = strconv.Atoi(value)
+		case headerDLQViolations:
+			if err := json.Unmarshal(h.Value, &dm.Violations); err != nil {
+				slog.Warn("invalid dlq message header", "dlq_id", dm.ID, "header", headerDLQViolations, logging.Err(err))
+			}
+		}
+	}
+
+	if json.Valid(m.Value) {
+		dm.Payload = json.RawMessage(m.Value)
+	} else {
+		dm.RawPayload = string(m.Value)
+	}
+	return dm
+}
+
+// replayMessage готовит сообщение для основного топика: убирает служебные
+// заголовки DLQ и увеличивает счетчик переотправок.
+func replayMessage(m DLQMessage) kafka.Message {
+	headers := make([]kafka.Header, 0, len(m.msg.Headers)+1)
+	for _, h := range m.msg.Headers {
+		if strings.HasPrefix(h.Key, "dlq_") {
+			continue
+		}
+		headers = append(headers, h)
+	}
+	headers = append(headers, kafka.Header{
+		Key:   headerReplayAttempts,
+		Value: []byte(intToString(m.ReplayAttempts + 1)),
+	})
+
+	return kafka.Message{
+		Key:     m.msg.Key,
+		Value:   m.msg.Value,
+		Headers: headers,
+	}
+}
+
+// DLQMessageID возвращает идентификатор сообщения DLQ в формате partition:offset.
+func DLQMessageID(partition int, offset int64) string {
+	return intToString(partition) + ":" + int64ToString(offset)
+}
+
+// readTopic передает в visit сообщения топика от начала до текущего конца каждой партиции,
+// пока visit не вернет false. Общего ограничения на время чтения нет: каждая партиция
+// дочитывается до high-water mark или до паузы dlqIdleTimeout, а прервать чтение можно через ctx.
+func readTopic(ctx context.Context, brokers []string, topic string, visit func(kafka.Message) bool) error {
+	dialCtx, cancel := context.WithTimeout(ctx, dlqMetadataTimeout)
+	defer cancel()
+	conn, err := dialAny(dialCtx, brokers)
+	if err != nil {
+		return err
+	}
+	_ = conn.SetDeadline(time.Now().Add(dlqMetadataTimeout))
+	partitions, err := conn.ReadPartitions(topic)
+	if closeErr := conn.Close(); closeErr != nil {
+		slog.WarnContext(ctx, "kafka conn close error", logging.Err(closeErr))
+	}
+	if err != nil {
+		return fmt.Errorf("read partitions of %q: %w", topic, err)
+	}
+
+	for _, p := range partitions {
+		more, err := readPartition(ctx, brokers, topic, p.ID, visit)
+		if err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+	}
+	return nil
+}
+
+// readPartition передает в visit сообщения партиции до high-water mark на момент начала чтения.
+// Возвращает false, если visit остановил чтение. Оффсеты до high-water mark могут не прийти
+// (уплотненный топик, маркеры транзакций), поэтому партиция считается дочитанной,
+// если новых сообщений нет дольше dlqIdleTimeout.
+func readPartition(ctx context.Context, brokers []string, topic string, partition int, visit func(kafka.Message) bool) (bool, error) {
+	dialCtx, cancel := context.WithTimeout(ctx, dlqMetadataTimeout)
+	defer cancel()
+	var leader *kafka.Conn
+	var err error
+	for _, broker := range brokers {
+		leader, err = kafka.DialLeader(dialCtx, "tcp", broker, topic, partition)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return false, fmt.Errorf("dial leader of %s/%d: %w", topic, partition, err)
+	}
+	_ = leader.SetDeadline(time.Now().Add(dlqMetadataTimeout))
+	first, last, err := leader.ReadOffsets()
+	if closeErr := leader.Close(); closeErr != nil {
+		slog.WarnContext(ctx, "kafka conn close error", logging.Err(closeErr))
+	}
+	if err != nil {
+		return false, fmt.Errorf("read offsets of %s/%d: %w", topic, partition, err)
+	}
+	if last <= first {
+		return true, nil
+	}
+
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   brokers,
+		Topic:     topic,
+		Partition: partition,
+	})
+	defer func() {
+		if err := r.Close(); err != nil {
+			slog.WarnContext(ctx, "kafka reader close error", logging.Err(err))
+		}
+	}()
+	if err := r.SetOffset(first); err != nil {
+		return false, fmt.Errorf("seek %s/%d: %w", topic, partition, err)
+	}
+
+	for {
+		readCtx, cancel := context.WithTimeout(ctx, dlqIdleTimeout)
+		m, err := r.ReadMessage(readCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+				return true, nil
+			}
+			return false, fmt.Errorf("read %s/%d: %w", topic, partition, err)
+		}
+		if !visit(m) {
+			return false, nil
+		}
+		if m.Offset+1 >= last {
+			return true, nil
+		}
+	}
+}
+
+func dialAny(ctx context.Context, brokers []string) (*kafka.Conn, error) {
+	var lastErr error
+	for _, broker := range brokers {
+		conn, err := kafka.DialContext(ctx, "tcp", broker)
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no brokers configured")
+	}
+	return nil, fmt.Errorf("dial kafka: %w", lastErr)
+}
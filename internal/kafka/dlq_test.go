@@ -0,0 +1,271 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/config"
+	"github.com/RoGogDBD/wb/internal/ingest"
+	"github.com/RoGogDBD/wb/internal/models"
+	"github.com/RoGogDBD/wb/internal/repository"
+	"github.com/RoGogDBD/wb/internal/repository/mocks"
+	"github.com/RoGogDBD/wb/internal/validation"
+	"github.com/segmentio/kafka-go"
+)
+
+func TestDLQList(t *testing.T) {
+	base := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	raw := []kafka.Message{
+		dlqTestMessage(0, []byte("{"), "unmarshal", "unexpected end of JSON input", base, 0),
+		dlqTestMessage(1, mustMarshal(t, testOrder()), "db", "connection timeout", base.Add(time.Hour), 0),
+		dlqTestMessage(2, mustMarshal(t, testOrder()), "db", "check constraint", base.Add(2*time.Hour), 1),
+		dlqTestMessage(3, mustMarshal(t, testOrder()), "validation", "validation failed", base.Add(3*time.Hour), 0),
+	}
+	raw[3].Headers = append(raw[3].Headers, kafka.Header{
+		Key:   headerDLQViolations,
+		Value: []byte(`[{"field":"payment.amount","rule":"amount","param":"60","value":61}]`),
+	})
+
+	tests := []struct {
+		name    string
+		filter  DLQFilter
+		wantIDs []string
+	}{
+		{name: "all", filter: DLQFilter{}, wantIDs: []string{"0:0", "0:1", "0:2", "0:3"}},
+		{name: "by stage", filter: DLQFilter{Stage: "db"}, wantIDs: []string{"0:1", "0:2"}},
+		{name: "by error substring", filter: DLQFilter{ErrorContains: "TIMEOUT"}, wantIDs: []string{"0:1"}},
+		{name: "by time range", filter: DLQFilter{From: base.Add(30 * time.Minute), To: base.Add(90 * time.Minute)}, wantIDs: []string{"0:1"}},
+		{name: "by rule", filter: DLQFilter{Rule: "amount"}, wantIDs: []string{"0:3"}},
+		{name: "limit", filter: DLQFilter{Limit: 1}, wantIDs: []string{"0:0"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := testDLQ(raw, &fakeWriter{}, nil)
+			msgs, err := d.List(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(msgs) != len(tt.wantIDs) {
+				t.Fatalf("expected %d messages, got %d", len(tt.wantIDs), len(msgs))
+			}
+			for i, m := range msgs {
+				if m.ID != tt.wantIDs[i] {
+					t.Fatalf("expected id %s, got %s", tt.wantIDs[i], m.ID)
+				}
+			}
+		})
+	}
+
+	d := testDLQ(raw, &fakeWriter{}, nil)
+	msgs, err := d.List(context.Background(), DLQFilter{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if msgs[0].RawPayload != "{" || msgs[0].Payload != nil {
+		t.Fatalf("invalid JSON must be returned as raw payload")
+	}
+	if msgs[1].Payload == nil || msgs[1].SourceOffset != 1 || msgs[2].ReplayAttempts != 1 {
+		t.Fatalf("unexpected decoded message: %+v", msgs[1])
+	}
+}
+
+func TestDLQStopsReadingEarly(t *testing.T) {
+	var raw []kafka.Message
+	for i := range 10 {
+		raw = append(raw, dlqTestMessage(int64(i), mustMarshal(t, testOrder()), "db", "timeout", time.Now(), 0))
+	}
+	d := testDLQ(raw, &fakeWriter{}, nil)
+	read := d.read
+	var visited int
+	d.read = func(ctx context.Context, visit func(kafka.Message) bool) error {
+		return read(ctx, func(m kafka.Message) bool {
+			visited++
+			return visit(m)
+		})
+	}
+
+	if _, err := d.List(context.Background(), DLQFilter{Limit: 2}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if visited != 2 {
+		t.Fatalf("expected List to stop after 2 messages, read %d", visited)
+	}
+
+	visited = 0
+	if _, err := d.Replay(context.Background(), ReplayRequest{IDs: []string{"0:1", "0:3"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if visited != 4 {
+		t.Fatalf("expected Replay to stop after the last selected message, read %d", visited)
+	}
+}
+
+func TestDLQReplayToTopic(t *testing.T) {
+	raw := []kafka.Message{
+		dlqTestMessage(0, mustMarshal(t, testOrder()), "db", "timeout", time.Now(), 0),
+		dlqTestMessage(1, mustMarshal(t, testOrder()), "db", "timeout", time.Now(), 3),
+	}
+	w := &fakeWriter{}
+	d := testDLQ(raw, w, nil)
+
+	results, err := d.Replay(context.Background(), ReplayRequest{All: true, Target: ReplayToTopic})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 2 || results[0].Status != ReplayStatusReplayed || results[1].Status != ReplayStatusSkipped {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if len(w.written) != 1 {
+		t.Fatalf("expected 1 replayed message, got %d", len(w.written))
+	}
+	replayed := w.written[0]
+	if headerValue(replayed, headerReplayAttempts) != "1" {
+		t.Fatalf("expected replay attempts header 1, got %q", headerValue(replayed, headerReplayAttempts))
+	}
+	if headerValue(replayed, headerDLQStage) != "" || headerValue(replayed, "trace") != "keep" {
+		t.Fatalf("dlq headers must be removed and other headers kept: %+v", replayed.Headers)
+	}
+
+	results, err = d.Replay(context.Background(), ReplayRequest{IDs: []string{"0:1", "0:9"}, Force: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if results[0].Status != ReplayStatusReplayed || results[1].Status != ReplayStatusFailed {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if headerValue(w.written[1], headerReplayAttempts) != "4" {
+		t.Fatalf("expected replay attempts header 4, got %q", headerValue(w.written[1], headerReplayAttempts))
+	}
+}
+
+func TestDLQReplayToStore(t *testing.T) {
+	invalid := testOrder()
+	invalid.Items = nil
+	raw := []kafka.Message{
+		dlqTestMessage(0, mustMarshal(t, testOrder()), "db", "timeout", time.Now(), 0),
+		dlqTestMessage(1, mustMarshal(t, invalid), "validation", "items required", time.Now(), 0),
+		dlqTestMessage(2, mustMarshal(t, testOrder()), "db", "timeout", time.Now(), 0),
+	}
+	var stored []string
+	store := &mocks.OrderStoreMock{
+		InsertOrderFunc: func(_ context.Context, o *models.Order) error {
+			if len(stored) == 1 {
+				return errors.New("still failing")
+			}
+			stored = append(stored, o.OrderUID)
+			return nil
+		},
+	}
+	w := &fakeWriter{}
+	d := testDLQ(raw, w, store)
+
+	results, err := d.Replay(context.Background(), ReplayRequest{All: true, Target: ReplayToStore})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantStatuses := []string{ReplayStatusReplayed, ReplayStatusFailed, ReplayStatusFailed}
+	for i, want := range wantStatuses {
+		if results[i].Status != want {
+			t.Fatalf("result %d: expected %s, got %+v", i, want, results[i])
+		}
+	}
+	if len(stored) != 1 || len(w.written) != 0 {
+		t.Fatalf("expected 1 stored order and no topic writes, got %d and %d", len(stored), len(w.written))
+	}
+	if v := results[1].Violations; len(v) == 0 || v[0].Field != "items" || v[0].Rule != "required" {
+		t.Fatalf("expected items violation in replay result, got %+v", results[1].Violations)
+	}
+}
+
+func TestDLQReplayToStoreSkipsProcessedMessages(t *testing.T) {
+	raw := []kafka.Message{dlqTestMessage(0, mustMarshal(t, testOrder()), "db", "timeout", time.Now(), 0)}
+	d := testDLQ(raw, &fakeWriter{}, repository.NewMemoryOrderStore())
+
+	for _, want := range []string{ReplayStatusReplayed, ReplayStatusSkipped} {
+		results, err := d.Replay(context.Background(), ReplayRequest{IDs: []string{"0:0"}, Target: ReplayToStore})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(results) != 1 || results[0].Status != want {
+			t.Fatalf("expected %s, got %+v", want, results)
+		}
+	}
+}
+
+func TestDLQReturnsPartialResults(t *testing.T) {
+	var raw []kafka.Message
+	for i := range 3 {
+		raw = append(raw, dlqTestMessage(int64(i), mustMarshal(t, testOrder()), "db", "timeout", time.Now(), 0))
+	}
+	readErr := errors.New("broker gone")
+	d := testDLQ(raw, &fakeWriter{}, nil)
+	d.read = func(_ context.Context, visit func(kafka.Message) bool) error {
+		for _, m := range raw[:2] {
+			if !visit(m) {
+				return nil
+			}
+		}
+		return readErr
+	}
+
+	msgs, err := d.List(context.Background(), DLQFilter{})
+	var scanErr *ScanError
+	if !errors.As(err, &scanErr) || scanErr.LastID != "0:1" || !errors.Is(err, readErr) {
+		t.Fatalf("expected scan error after 0:1, got %v", err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages read before the error, got %d", len(msgs))
+	}
+
+	results, err := d.Replay(context.Background(), ReplayRequest{IDs: []string{"0:0", "0:2"}})
+	if !errors.As(err, &scanErr) {
+		t.Fatalf("expected scan error, got %v", err)
+	}
+	if len(results) != 2 || results[0].Status != ReplayStatusReplayed || results[1].Status != ReplayStatusFailed {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+}
+
+func testDLQ(raw []kafka.Message, w messageWriter, store repository.OrderStore) *DLQ {
+	d := &DLQ{
+		read: func(_ context.Context, visit func(kafka.Message) bool) error {
+			for _, m := range raw {
+				if !visit(m) {
+					return nil
+				}
+			}
+			return nil
+		},
+		writer:     w,
+		maxReplays: 3,
+	}
+	if store != nil {
+		d.pipeline = ingest.NewPipeline(config.KafkaConfig{}, validation.MustNewOrderValidator(nil), store, nil)
+	}
+	return d
+}
+
+func dlqTestMessage(offset int64, value []byte, stage, errText string, failedAt time.Time, attempts int) kafka.Message {
+	headers := []kafka.Header{
+		{Key: "trace", Value: []byte("keep")},
+		{Key: headerDLQError, Value: []byte(errText)},
+		{Key: headerDLQStage, Value: []byte(stage)},
+		{Key: headerDLQTimestamp, Value: []byte(failedAt.UTC().Format(time.RFC3339Nano))},
+		{Key: headerDLQTopic, Value: []byte("orders")},
+		{Key: headerDLQPartition, Value: []byte("0")},
+		{Key: headerDLQOffset, Value: []byte(int64ToString(offset))},
+	}
+	if attempts > 0 {
+		headers = append(headers, kafka.Header{Key: headerReplayAttempts, Value: []byte(intToString(attempts))})
+	}
+	return kafka.Message{
+		Topic:   "orders.dlq",
+		Offset:  offset,
+		Key:     []byte("key"),
+		Value:   value,
+		Headers: headers,
+	}
+}
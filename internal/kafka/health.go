@@ -0,0 +1,28 @@
+package kafka
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/RoGogDBD/wb/internal/logging"
+)
+
+// Ping проверяет, что хотя бы один из брокеров brokers доступен и отвечает на запрос метаданных.
+func Ping(ctx context.Context, brokers []string) error {
+	conn, err := dialAny(ctx, brokers)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			slog.WarnContext(ctx, "kafka conn close error", logging.Err(err))
+		}
+	}()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+	_, err = conn.Brokers()
+	return err
+}
@@ -0,0 +1,222 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/logging"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	// lagRefreshInterval — период запроса high watermark у брокеров.
+	lagRefreshInterval = 15 * time.Second
+	// lagQueryTimeout ограничивает один запрос high watermark.
+	lagQueryTimeout = 2 * time.Second
+	// lagPartitionTTL — через сколько партиция, из которой больше не приходят сообщения,
+	// перестает учитываться, если консьюмер за это время читал другие партиции.
+	lagPartitionTTL = 5 * time.Minute
+)
+
+// highWaterMarks возвращает high watermark партиций топика.
+type highWaterMarks func(ctx context.Context, topic string, partitions []int) (map[int]int64, error)
+
+// lagTracker считает отставание консьюмера по партициям: high watermark партиции
+// минус следующий оффсет, который консьюмер прочитает.
+// Reader.Stats() в режиме consumer group возвращает одно значение отставания без номера
+// партиции, поэтому high watermark периодически запрашивается у брокеров (см. start).
+// Так отставание растет и тогда, когда консьюмер перестал получать сообщения.
+// Сбор метрики только читает сохраненные значения и не ходит в сеть.
+// Если запрос не удался, используется последний известный high watermark.
+//
+// kafka-go не сообщает о перераспределении партиций группы, поэтому партиция, из которой
+// сообщения не приходят дольше ttl, пока консьюмер читает другие, считается отданной
+// другому участнику группы и удаляется.
+type lagTracker struct {
+	query    highWaterMarks
+	interval time.Duration
+	ttl      time.Duration
+
+	mu         sync.Mutex
+	partitions map[topicPartition]*partitionLag
+	// lastFetch — время последнего прочитанного сообщения из любой партиции.
+	lastFetch time.Time
+}
+
+type topicPartition struct {
+	topic     string
+	partition int
+}
+
+type partitionLag struct {
+	next          int64
+	highWaterMark int64
+	// fetched — время последнего прочитанного из партиции сообщения.
+	fetched time.Time
+}
+
+// newLagTracker создает lagTracker. Если query nil, high watermark берется только из сообщений.
+func newLagTracker(query highWaterMarks) *lagTracker {
+	return &lagTracker{
+		query:      query,
+		interval:   lagRefreshInterval,
+		ttl:        lagPartitionTTL,
+		partitions: make(map[topicPartition]*partitionLag),
+	}
+}
+
+// observe запоминает следующий оффсет партиции сообщения m.
+func (t *lagTracker) observe(m kafka.Message) {
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tp := topicPartition{topic: m.Topic, partition: m.Partition}
+	p, ok := t.partitions[tp]
+	if !ok {
+		p = &partitionLag{}
+		t.partitions[tp] = p
+	}
+	p.next = m.Offset + 1
+	p.highWaterMark = max(p.highWaterMark, m.HighWaterMark)
+	p.fetched = now
+	t.lastFetch = now
+}
+
+// start периодически удаляет отданные партиции и обновляет high watermark остальных
+// до отмены ctx. Возвращает функцию остановки.
+func (t *lagTracker) start(ctx context.Context) (stop func()) {
+	if t.interval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	ticker := time.NewTicker(t.interval)
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				t.prune()
+				if err := t.refresh(ctx); err != nil {
+					slog.WarnContext(ctx, "consumer lag query error", logging.Err(err))
+				}
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// prune удаляет партиции, из которых сообщения не приходят дольше ttl,
+// хотя консьюмер за это время читал другие партиции.
+func (t *lagTracker) prune() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for tp, p := range t.partitions {
+		if t.lastFetch.Sub(p.fetched) > t.ttl {
+			delete(t.partitions, tp)
+		}
+	}
+}
+
+// refresh запрашивает high watermark всех прочитанных партиций.
+func (t *lagTracker) refresh(ctx context.Context) error {
+	if t.query == nil {
+		return nil
+	}
+	t.mu.Lock()
+	byTopic := make(map[string][]int)
+	for tp := range t.partitions {
+		byTopic[tp.topic] = append(byTopic[tp.topic], tp.partition)
+	}
+	t.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, lagQueryTimeout)
+	defer cancel()
+	var errs error
+	for topic, partitions := range byTopic {
+		// при частичной ошибке marks содержит ответы остальных партиций
+		marks, err := t.query(ctx, topic, partitions)
+		if err != nil {
+			errs = errors.Join(errs, fmt.Errorf("query high watermarks of %q: %w", topic, err))
+		}
+		t.mu.Lock()
+		for partition, mark := range marks {
+			if p, ok := t.partitions[topicPartition{topic: topic, partition: partition}]; ok {
+				p.highWaterMark = max(p.highWaterMark, mark)
+			}
+		}
+		t.mu.Unlock()
+	}
+	return errs
+}
+
+// register регистрирует gauge kafka.consumer.lag с атрибутами topic и partition.
+// Callback отдает значения, сохраненные observe и refresh.
+// Регистрацию нужно отменить, когда консьюмер остановлен.
+func (t *lagTracker) register() (metric.Registration, error) {
+	meter := otel.Meter(meterName)
+	gauge, err := meter.Int64ObservableGauge("kafka.consumer.lag",
+		metric.WithDescription("Messages in the partition not yet fetched by the consumer"),
+		metric.WithUnit("{message}"))
+	if err != nil {
+		return nil, err
+	}
+	return meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		for tp, p := range t.partitions {
+			if p.highWaterMark == 0 {
+				continue
+			}
+			o.ObserveInt64(gauge, max(p.highWaterMark-p.next, 0), metric.WithAttributes(
+				attribute.String("topic", tp.topic),
+				attribute.Int("partition", tp.partition),
+			))
+		}
+		return nil
+	}, gauge)
+}
+
+// brokerHighWaterMarks запрашивает high watermark партиций у брокеров.
+func brokerHighWaterMarks(brokers []string) highWaterMarks {
+	client := &kafka.Client{Addr: kafka.TCP(brokers...)}
+	return func(ctx context.Context, topic string, partitions []int) (map[int]int64, error) {
+		reqs := make([]kafka.OffsetRequest, len(partitions))
+		for i, p := range partitions {
+			reqs[i] = kafka.LastOffsetOf(p)
+		}
+		resp, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{
+			Topics: map[string][]kafka.OffsetRequest{topic: reqs},
+		})
+		if err != nil {
+			return nil, err
+		}
+		marks := make(map[int]int64, len(partitions))
+		var errs error
+		for _, p := range resp.Topics[topic] {
+			if p.Error != nil {
+				errs = errors.Join(errs, fmt.Errorf("partition %d: %w", p.Partition, p.Error))
+				continue
+			}
+			marks[p.Partition] = p.LastOffset
+		}
+		return marks, errs
+	}
+}
@@ -0,0 +1,60 @@
+package kafka
+
+import (
+	"sync"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// offsetTracker отслеживает сообщения в обработке и определяет,
+// до какого оффсета партиции можно фиксировать без пропуска незавершенных сообщений.
+type offsetTracker struct {
+	mu         sync.Mutex
+	partitions map[int]*partitionOffsets
+}
+
+// partitionOffsets хранит сообщения партиции в порядке чтения и отметки о завершении.
+type partitionOffsets struct {
+	inflight []kafka.Message
+	done     map[int64]bool
+}
+
+func newOffsetTracker() *offsetTracker {
+	return &offsetTracker{partitions: make(map[int]*partitionOffsets)}
+}
+
+// track регистрирует прочитанное сообщение. Вызывается в порядке чтения.
+func (t *offsetTracker) track(m kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[m.Partition]
+	if !ok {
+		p = &partitionOffsets{done: make(map[int64]bool)}
+		t.partitions[m.Partition] = p
+	}
+	p.inflight = append(p.inflight, m)
+}
+
+// done отмечает сообщение обработанным и возвращает последнее сообщение
+// непрерывного обработанного префикса партиции, если он сдвинулся.
+func (t *offsetTracker) done(m kafka.Message) (kafka.Message, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p, ok := t.partitions[m.Partition]
+	if !ok {
+		return kafka.Message{}, false
+	}
+	p.done[m.Offset] = true
+
+	var last kafka.Message
+	advanced := false
+	for len(p.inflight) > 0 && p.done[p.inflight[0].Offset] {
+		last = p.inflight[0]
+		delete(p.done, last.Offset)
+		p.inflight = p.inflight[1:]
+		advanced = true
+	}
+	return last, advanced
+}
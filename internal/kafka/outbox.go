@@ -0,0 +1,110 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/config"
+	"github.com/RoGogDBD/wb/internal/logging"
+	"github.com/RoGogDBD/wb/internal/repository"
+	"github.com/RoGogDBD/wb/internal/telemetry"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Заголовки сообщений с событиями заказов.
+const (
+	headerEventType = "event_type"
+	headerEventID   = "event_id"
+)
+
+// outboxRelay публикует события из outbox в Kafka с семантикой at-least-once:
+// событие удаляется из outbox только после подтверждения записи брокером.
+type outboxRelay struct {
+	outbox    repository.Outbox
+	writer    messageWriter
+	batchSize int
+	interval  time.Duration
+	published metric.Int64Counter
+}
+
+// RunOutboxRelay публикует события изменения заказов в топик cfg.OutboxTopic.
+// Ключ сообщения — order_uid, поэтому события одного заказа попадают в одну партицию.
+// Возвращает nil при отмене ctx и ошибку, если outbox или брокер недоступны.
+func RunOutboxRelay(ctx context.Context, cfg config.KafkaConfig, outbox repository.Outbox) error {
+	w := &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Topic:        cfg.OutboxTopic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+	}
+	defer func() {
+		if err := w.Close(); err != nil {
+			slog.WarnContext(ctx, "outbox writer close error", logging.Err(err))
+		}
+	}()
+
+	return newOutboxRelay(cfg, outbox, w).run(ctx)
+}
+
+func newOutboxRelay(cfg config.KafkaConfig, outbox repository.Outbox, writer messageWriter) *outboxRelay {
+	return &outboxRelay{
+		outbox:    outbox,
+		writer:    writer,
+		batchSize: max(cfg.OutboxBatchSize, 1),
+		interval:  cfg.OutboxPollInterval,
+		published: telemetry.Int64Counter(meterName, "outbox.published", "Order events published from the outbox", "{event}"),
+	}
+}
+
+// run публикует события пачками; когда outbox опустошен, ждет interval перед следующей проверкой.
+func (r *outboxRelay) run(ctx context.Context) error {
+	ticker := time.NewTicker(max(r.interval, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		n, err := r.outbox.PublishOutbox(ctx, r.batchSize, r.publish)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("publish outbox: %w", err)
+		}
+		if n == r.batchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// publish записывает события в Kafka одной операцией.
+func (r *outboxRelay) publish(ctx context.Context, events []repository.OutboxEvent) error {
+	msgs := make([]kafka.Message, len(events))
+	for i, e := range events {
+		value, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("encode event %d: %w", e.ID, err)
+		}
+		msgs[i] = kafka.Message{
+			Key:   []byte(e.OrderUID),
+			Value: value,
+			Headers: []kafka.Header{
+				{Key: headerEventType, Value: []byte(e.Type)},
+				{Key: headerEventID, Value: []byte(strconv.FormatInt(e.ID, 10))},
+			},
+		}
+	}
+	if err := r.writer.WriteMessages(ctx, msgs...); err != nil {
+		return err
+	}
+	r.published.Add(ctx, int64(len(events)))
+	slog.InfoContext(ctx, "published order events", "events", len(events))
+	return nil
+}
@@ -0,0 +1,66 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/config"
+	"github.com/RoGogDBD/wb/internal/repository"
+	"github.com/segmentio/kafka-go"
+)
+
+func TestOutboxRelayPublishesEvents(t *testing.T) {
+	store := repository.NewMemoryOrderStore()
+	order := testOrder()
+	if err := store.InsertOrder(context.Background(), order); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	updated := *order
+	updated.UpdatedAt = order.DateCreated.Add(time.Hour)
+	if err := store.InsertOrder(context.Background(), &updated); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	failures := 1
+	writer := &fakeWriter{
+		writeFunc: func(msgs []kafka.Message) error {
+			if failures > 0 {
+				failures--
+				return errors.New("broker down")
+			}
+			if len(msgs) == 1 && headerValue(msgs[0], headerEventType) == repository.EventOrderUpdated {
+				cancel()
+			}
+			return nil
+		},
+	}
+	relay := newOutboxRelay(config.KafkaConfig{OutboxBatchSize: 1, OutboxPollInterval: time.Millisecond}, store, writer)
+
+	// ошибка брокера прерывает relay, событие остается в outbox
+	if err := relay.run(ctx); err == nil {
+		t.Fatalf("expected publish error")
+	}
+	if err := relay.run(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(writer.written) != 2 {
+		t.Fatalf("expected 2 published events, got %d", len(writer.written))
+	}
+	for i, wantType := range []string{repository.EventOrderCreated, repository.EventOrderUpdated} {
+		msg := writer.written[i]
+		var event repository.OutboxEvent
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(msg.Key) != order.OrderUID || headerValue(msg, headerEventType) != wantType ||
+			event.Type != wantType || event.Version != i+1 {
+			t.Fatalf("event %d: unexpected message %s (key %s)", i, msg.Value, msg.Key)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// AccessLog — HTTP-мидлвар журнала запросов: по записи на запрос с методом, путем,
+// статусом, размером ответа и длительностью. Запросы со статусом 5xx пишутся с уровнем error,
+// 4xx — warn, остальные — info.
+// Идентификатор запроса из middleware.RequestID добавляется в контекст запроса полем
+// request_id, поэтому попадает и во все записи обработчиков, сделанные с этим контекстом.
+// Чтобы записи содержали trace_id, мидлвар подключается после otelhttp.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if id := middleware.GetReqID(ctx); id != "" {
+			ctx = With(ctx, "request_id", id)
+			r = r.WithContext(ctx)
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+		defer func() {
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			level := slog.LevelInfo
+			switch {
+			case status >= http.StatusInternalServerError:
+				level = slog.LevelError
+			case status >= http.StatusBadRequest:
+				level = slog.LevelWarn
+			}
+			slog.Default().LogAttrs(ctx, level, "http request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", status),
+				slog.Int("bytes", ww.BytesWritten()),
+				slog.Duration("duration", time.Since(start)),
+				slog.String("remote_addr", r.RemoteAddr),
+			)
+		}()
+		next.ServeHTTP(ww, r)
+	})
+}
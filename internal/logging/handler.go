@@ -0,0 +1,36 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// contextHandler дополняет записи полями из контекста: trace_id и span_id активного span
+// и полями, добавленными через With.
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle добавляет в запись поля контекста и передает ее обернутому обработчику.
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	r.AddAttrs(attrsFromContext(ctx)...)
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs возвращает обработчик с дополнительными полями.
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup возвращает обработчик, помещающий поля в группу name.
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,81 @@
+// Package logging настраивает структурированное логирование на log/slog.
+// Записи, сделанные с контекстом (slog.InfoContext и т. п.), дополняются trace_id и span_id
+// активного span и полями, добавленными в контекст через With.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Форматы вывода логов.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// New создает логгер, пишущий в w в формате format (text или json)
+// записи уровня level (debug, info, warn, error) и выше.
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("unknown log level %q", level)
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case FormatText:
+		h = slog.NewTextHandler(w, opts)
+	case FormatJSON:
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+	return slog.New(&contextHandler{Handler: h}), nil
+}
+
+// Setup создает логгер, пишущий в stderr, и делает его логгером по умолчанию.
+// Вывод стандартного пакета log (например, из сторонних библиотек) тоже попадает в него.
+func Setup(format, level string) error {
+	logger, err := New(os.Stderr, format, level)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(logger)
+	return nil
+}
+
+type attrsKey struct{}
+
+// With возвращает контекст, записи лога с которым дополняются полями args
+// (пары ключ-значение или slog.Attr, как в slog.Logger.With).
+func With(ctx context.Context, args ...any) context.Context {
+	if len(args) == 0 {
+		return ctx
+	}
+	r := slog.Record{}
+	r.Add(args...)
+	parent := attrsFromContext(ctx)
+	attrs := make([]slog.Attr, 0, len(parent)+r.NumAttrs())
+	attrs = append(attrs, parent...)
+	r.Attrs(func(a slog.Attr) bool {
+		attrs = append(attrs, a)
+		return true
+	})
+	return context.WithValue(ctx, attrsKey{}, attrs)
+}
+
+func attrsFromContext(ctx context.Context) []slog.Attr {
+	attrs, _ := ctx.Value(attrsKey{}).([]slog.Attr)
+	return attrs
+}
+
+// Err возвращает поле error для записи лога.
+func Err(err error) slog.Attr {
+	return slog.Any("error", err)
+}
@@ -0,0 +1,131 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name      string
+		format    string
+		level     string
+		wantErr   bool
+		wantDebug bool
+	}{
+		{name: "json info", format: FormatJSON, level: "info"},
+		{name: "text debug", format: FormatText, level: "debug", wantDebug: true},
+		{name: "case insensitive", format: "JSON", level: "WARN"},
+		{name: "unknown format", format: "xml", level: "info", wantErr: true},
+		{name: "unknown level", format: FormatJSON, level: "verbose", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger, err := New(&buf, tt.format, tt.level)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			logger.Debug("debug entry")
+			if got := strings.Contains(buf.String(), "debug entry"); got != tt.wantDebug {
+				t.Fatalf("expected debug entry written %v, got output %q", tt.wantDebug, buf.String())
+			}
+		})
+	}
+}
+
+func TestContextFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, FormatJSON, "info")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{1},
+		SpanID:     trace.SpanID{2},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+	ctx = With(ctx, "partition", 3)
+	ctx = With(ctx, slog.Int64("offset", 42))
+	logger.With("component", "consumer").InfoContext(ctx, "order stored", "order_uid", "o1")
+
+	entry := decodeEntry(t, buf.Bytes())
+	want := map[string]any{
+		"msg":       "order stored",
+		"component": "consumer",
+		"order_uid": "o1",
+		"partition": float64(3),
+		"offset":    float64(42),
+		"trace_id":  sc.TraceID().String(),
+		"span_id":   sc.SpanID().String(),
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Fatalf("expected %s=%v, got entry %v", k, v, entry)
+		}
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, FormatJSON, "info")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	prev := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	var handlerEntry []byte
+	handler := middleware.RequestID(AccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		slog.InfoContext(r.Context(), "handling")
+		handlerEntry = bytes.Clone(buf.Bytes())
+		buf.Reset()
+		http.Error(w, "missing", http.StatusNotFound)
+	})))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/order/1", nil))
+
+	inner := decodeEntry(t, handlerEntry)
+	access := decodeEntry(t, buf.Bytes())
+	if inner["request_id"] == nil || inner["request_id"] != access["request_id"] {
+		t.Fatalf("expected the same request_id in handler and access entries, got %v and %v", inner, access)
+	}
+	want := map[string]any{
+		"msg":    "http request",
+		"level":  "WARN",
+		"method": http.MethodGet,
+		"path":   "/order/1",
+		"status": float64(http.StatusNotFound),
+	}
+	for k, v := range want {
+		if access[k] != v {
+			t.Fatalf("expected %s=%v, got entry %v", k, v, access)
+		}
+	}
+}
+
+func decodeEntry(t *testing.T, data []byte) map[string]any {
+	t.Helper()
+	var entry map[string]any
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatalf("decode log entry %q: %v", data, err)
+	}
+	return entry
+}
@@ -18,4 +18,15 @@ type Order struct {
 	SmID              int       `json:"sm_id" validate:"gte=0"`
 	DateCreated       time.Time `json:"date_created" validate:"required"`
 	OofShard          string    `json:"oof_shard" validate:"required"`
+	// UpdatedAt — время изменения заказа у источника. Более старые версии не перезаписывают
+	// более новые; если поле не задано, используется DateCreated.
+	UpdatedAt time.Time `json:"updated_at,omitzero"`
+}
+
+// Revision возвращает время версии заказа: UpdatedAt или, если оно не задано, DateCreated.
+func (o *Order) Revision() time.Time {
+	if o.UpdatedAt.IsZero() {
+		return o.DateCreated
+	}
+	return o.UpdatedAt
 }
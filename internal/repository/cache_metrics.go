@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+
+	"github.com/RoGogDBD/wb/internal/logging"
+	"github.com/RoGogDBD/wb/internal/telemetry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// cacheMeterName — имя инструментирования метрик кеша.
+const cacheMeterName = "github.com/RoGogDBD/wb/internal/repository"
+
+// cacheMetrics — инструменты метрик кеша заказов.
+type cacheMetrics struct {
+	hits          metric.Int64Counter
+	misses        metric.Int64Counter
+	expirations   metric.Int64Counter
+	evictions     metric.Int64Counter
+	purgeDuration metric.Float64Histogram
+	// gauges — регистрация наблюдения за размером кеша; отменяется в MemStorage.Close.
+	gauges metric.Registration
+}
+
+// newCacheMetrics создает инструменты метрик кеша и регистрирует наблюдение
+// за текущим размером кеша s и его лимитом.
+func newCacheMetrics(s *MemStorage) cacheMetrics {
+	m := cacheMetrics{
+		hits:          telemetry.Int64Counter(cacheMeterName, "cache.hits", "Orders found in the cache", "{request}"),
+		misses:        telemetry.Int64Counter(cacheMeterName, "cache.misses", "Orders not found in the cache or expired", "{request}"),
+		expirations:   telemetry.Int64Counter(cacheMeterName, "cache.expirations", "Cache entries removed after TTL", "{order}"),
+		evictions:     telemetry.Int64Counter(cacheMeterName, "cache.evictions", "Cache entries evicted by LRU at max_items", "{order}"),
+		purgeDuration: telemetry.Float64Histogram(cacheMeterName, "cache.purge.duration", "Duration of expired entries purge", "s"),
+	}
+
+	meter := otel.Meter(cacheMeterName)
+	size, sizeErr := meter.Int64ObservableGauge("cache.size",
+		metric.WithDescription("Current number of cached orders"), metric.WithUnit("{order}"))
+	maxItems, maxErr := meter.Int64ObservableGauge("cache.max_items",
+		metric.WithDescription("Maximum number of cached orders"), metric.WithUnit("{order}"))
+	if err := errors.Join(sizeErr, maxErr); err != nil {
+		slog.Error("cache gauges init error", logging.Err(err))
+		return m
+	}
+	reg, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(size, int64(s.Len()))
+		o.ObserveInt64(maxItems, int64(s.maxItems))
+		return nil
+	}, size, maxItems)
+	if err != nil {
+		slog.Error("cache gauges callback error", logging.Err(err))
+		return m
+	}
+	m.gauges = reg
+	return m
+}
+
+// unregister отменяет наблюдение за размером кеша.
+func (m *cacheMetrics) unregister() error {
+	if m.gauges == nil {
+		return nil
+	}
+	err := m.gauges.Unregister()
+	m.gauges = nil
+	return err
+}
@@ -0,0 +1,487 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testDatabaseDSNEnv — переменная окружения с DSN базы для проверки PostgresStorage.
+// Схема должна быть создана миграциями; таблицы заказов, истории, журнала сообщений и outbox
+// очищаются перед каждым тестом.
+const testDatabaseDSNEnv = "TEST_DATABASE_DSN"
+
+func TestMemoryOrderStoreConformance(t *testing.T) {
+	runOrderStoreSuite(t, func(t *testing.T) OrderStore {
+		return NewMemoryOrderStore()
+	})
+}
+
+func TestPostgresStorageConformance(t *testing.T) {
+	dsn := os.Getenv(testDatabaseDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testDatabaseDSNEnv)
+	}
+	pool, err := pgxpool.New(context.Background(), dsn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	runOrderStoreSuite(t, func(t *testing.T) OrderStore {
+		if _, err := pool.Exec(context.Background(), "TRUNCATE orders, order_versions, processed_messages, outbox CASCADE"); err != nil {
+			t.Fatalf("truncate: %v", err)
+		}
+		return NewPostgresStorage(pool)
+	})
+}
+
+// runOrderStoreSuite проверяет общие для всех реализаций OrderStore свойства.
+// newStore должен возвращать пустое хранилище.
+func runOrderStoreSuite(t *testing.T, newStore func(t *testing.T) OrderStore) {
+	ctx := context.Background()
+	base := time.Date(2025, 2, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("insert and get", func(t *testing.T) {
+		store := newStore(t)
+		o := testOrder()
+		o.OrderUID = strings.ToUpper(o.OrderUID)
+		o.DateCreated = time.Date(2025, 2, 1, 15, 0, 0, 123456789, time.FixedZone("MSK", 3*60*60))
+
+		if err := store.InsertOrder(ctx, o); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+		got, err := store.GetOrderByID(ctx, o.OrderUID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+
+		want := *o
+		want.OrderUID = strings.ToLower(o.OrderUID)
+		want.DateCreated = time.Date(2025, 2, 1, 12, 0, 0, 123456000, time.UTC)
+		want.UpdatedAt = want.DateCreated
+		if !reflect.DeepEqual(*got, want) {
+			t.Fatalf("stored order differs:\n got: %+v\nwant: %+v", *got, want)
+		}
+	})
+
+	t.Run("upsert replaces order and items", func(t *testing.T) {
+		store := newStore(t)
+		o := testOrder()
+		o.Items = append(o.Items, o.Items[0])
+		if err := store.InsertOrder(ctx, o); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+
+		updated := testOrder()
+		updated.OrderUID = o.OrderUID
+		updated.TrackNumber = "UPDATED"
+		updated.Items[0].Name = "replacement"
+		if err := store.InsertOrder(ctx, updated); err != nil {
+			t.Fatalf("upsert: %v", err)
+		}
+
+		got, err := store.GetOrderByID(ctx, o.OrderUID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if got.TrackNumber != "UPDATED" || len(got.Items) != 1 || got.Items[0].Name != "replacement" {
+			t.Fatalf("order was not replaced: %+v", got)
+		}
+	})
+
+	t.Run("stale version is rejected", func(t *testing.T) {
+		store := newStore(t)
+		o := testOrder()
+		o.DateCreated = base
+		o.UpdatedAt = base.Add(2 * time.Hour)
+		if err := store.InsertOrder(ctx, o); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+
+		older := *o
+		older.UpdatedAt = base.Add(time.Hour)
+		older.TrackNumber = "OLDER"
+		if err := store.InsertOrder(ctx, &older); !errors.Is(err, ErrStale) {
+			t.Fatalf("expected ErrStale, got %v", err)
+		}
+		errs := store.InsertOrders(ctx, []*models.Order{&older})
+		if !errors.Is(errs[0], ErrStale) {
+			t.Fatalf("expected ErrStale from batch insert, got %v", errs[0])
+		}
+
+		got, err := store.GetOrderByID(ctx, o.OrderUID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if got.TrackNumber != o.TrackNumber || !got.UpdatedAt.Equal(o.UpdatedAt) {
+			t.Fatalf("stale version was applied: %+v", got)
+		}
+		versions, err := store.(OrderHistory).ListOrderVersions(ctx, o.OrderUID)
+		if err != nil || len(versions) != 1 {
+			t.Fatalf("stale version must not be recorded: %d versions, %v", len(versions), err)
+		}
+
+		same := *o
+		same.TrackNumber = "SAME-REVISION"
+		if err := store.InsertOrder(ctx, &same); err != nil {
+			t.Fatalf("same revision must be applied: %v", err)
+		}
+	})
+
+	t.Run("missing order", func(t *testing.T) {
+		store := newStore(t)
+		if _, err := store.GetOrderByID(ctx, uuid.New().String()); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("batch insert reports errors per order", func(t *testing.T) {
+		store := newStore(t)
+		valid := testOrder()
+		invalid := testOrder()
+		invalid.OrderUID = "not-a-uuid"
+
+		errs := store.InsertOrders(ctx, []*models.Order{valid, invalid})
+		if len(errs) != 2 || errs[0] != nil || errs[1] == nil {
+			t.Fatalf("unexpected errors: %v", errs)
+		}
+		if _, err := store.GetOrderByID(ctx, valid.OrderUID); err != nil {
+			t.Fatalf("valid order must be stored: %v", err)
+		}
+	})
+
+	t.Run("batch insert keeps fresh orders next to stale and duplicate ones", func(t *testing.T) {
+		store := newStore(t)
+		stored := testOrder()
+		stored.UpdatedAt = base.Add(2 * time.Hour)
+		replayedSrc := Source{Topic: "orders", Partition: 0, Offset: 3}
+		if err := store.InsertOrder(WithSources(ctx, map[*models.Order]Source{stored: replayedSrc}), stored); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+
+		stale := *stored
+		stale.UpdatedAt = base.Add(time.Hour)
+		replayed := testOrder()
+		first, last := testOrder(), testOrder()
+		batchCtx := WithSources(ctx, map[*models.Order]Source{
+			first:    {Topic: "orders", Partition: 0, Offset: 4},
+			&stale:   {Topic: "orders", Partition: 0, Offset: 5},
+			replayed: replayedSrc,
+			last:     {Topic: "orders", Partition: 0, Offset: 6},
+		})
+
+		errs := store.InsertOrders(batchCtx, []*models.Order{first, &stale, replayed, last})
+		if errs[0] != nil || !errors.Is(errs[1], ErrStale) || !errors.Is(errs[2], ErrDuplicate) || errs[3] != nil {
+			t.Fatalf("unexpected errors: %v", errs)
+		}
+		for _, o := range []*models.Order{first, last} {
+			if _, err := store.GetOrderByID(ctx, o.OrderUID); err != nil {
+				t.Fatalf("fresh order must be stored: %v", err)
+			}
+		}
+		if _, err := store.GetOrderByID(ctx, replayed.OrderUID); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("duplicate message must not be applied, got %v", err)
+		}
+	})
+
+	t.Run("history keeps every version", func(t *testing.T) {
+		store := newStore(t)
+		history, ok := store.(OrderHistory)
+		if !ok {
+			t.Fatalf("%T does not implement OrderHistory", store)
+		}
+
+		o := testOrder()
+		src := Source{Topic: "orders", Partition: 2, Offset: 41}
+		if err := store.InsertOrder(WithSources(ctx, map[*models.Order]Source{o: src}), o); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+		updated := *o
+		updated.Payment.Amount = 250
+		if err := store.InsertOrder(ctx, &updated); err != nil {
+			t.Fatalf("upsert: %v", err)
+		}
+
+		versions, err := history.ListOrderVersions(ctx, o.OrderUID)
+		if err != nil {
+			t.Fatalf("list versions: %v", err)
+		}
+		if len(versions) != 2 || versions[0].Version != 1 || versions[1].Version != 2 {
+			t.Fatalf("unexpected versions: %+v", versions)
+		}
+		if versions[0].Source == nil || *versions[0].Source != src || versions[1].Source != nil {
+			t.Fatalf("unexpected sources: %+v, %+v", versions[0].Source, versions[1].Source)
+		}
+		if versions[0].Checksum == "" || versions[0].Checksum == versions[1].Checksum {
+			t.Fatalf("checksums must be set and differ: %q, %q", versions[0].Checksum, versions[1].Checksum)
+		}
+		if versions[0].Order.Payment.Amount != o.Payment.Amount {
+			t.Fatalf("first version must keep the original payload: %+v", versions[0].Order.Payment)
+		}
+
+		v, err := history.GetOrderVersion(ctx, o.OrderUID, 2)
+		if err != nil {
+			t.Fatalf("get version: %v", err)
+		}
+		if v.Order.Payment.Amount != 250 || v.Checksum != versions[1].Checksum {
+			t.Fatalf("unexpected version: %+v", v)
+		}
+		if _, err := history.GetOrderVersion(ctx, o.OrderUID, 3); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound for missing version, got %v", err)
+		}
+		if _, err := history.ListOrderVersions(ctx, uuid.New().String()); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound for unknown order, got %v", err)
+		}
+	})
+
+	t.Run("duplicate message is skipped", func(t *testing.T) {
+		store := newStore(t)
+		ledger, ok := store.(MessageLedger)
+		if !ok {
+			t.Fatalf("%T does not implement MessageLedger", store)
+		}
+
+		o := testOrder()
+		src := Source{Topic: "orders", Partition: 1, Offset: 7}
+		if err := store.InsertOrder(WithSources(ctx, map[*models.Order]Source{o: src}), o); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+
+		replayed := *o
+		replayed.TrackNumber = "REPLAYED"
+		replayCtx := WithSources(ctx, map[*models.Order]Source{&replayed: src})
+		if err := store.InsertOrder(replayCtx, &replayed); !errors.Is(err, ErrDuplicate) {
+			t.Fatalf("expected ErrDuplicate, got %v", err)
+		}
+		errs := store.InsertOrders(replayCtx, []*models.Order{&replayed})
+		if !errors.Is(errs[0], ErrDuplicate) {
+			t.Fatalf("expected ErrDuplicate from batch insert, got %v", errs[0])
+		}
+
+		got, err := store.GetOrderByID(ctx, o.OrderUID)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if got.TrackNumber != o.TrackNumber {
+			t.Fatalf("duplicate message was applied: %+v", got)
+		}
+		versions, err := store.(OrderHistory).ListOrderVersions(ctx, o.OrderUID)
+		if err != nil || len(versions) != 1 {
+			t.Fatalf("duplicate must not be recorded: %d versions, %v", len(versions), err)
+		}
+
+		next := Source{Topic: "orders", Partition: 1, Offset: 8}
+		if err := store.InsertOrder(WithSources(ctx, map[*models.Order]Source{&replayed: next}), &replayed); err != nil {
+			t.Fatalf("message with another offset must be applied: %v", err)
+		}
+
+		pruned, err := ledger.PruneProcessedMessages(ctx, time.Now().Add(time.Hour))
+		if err != nil || pruned != 2 {
+			t.Fatalf("expected 2 pruned entries, got %d, %v", pruned, err)
+		}
+		if err := store.InsertOrder(replayCtx, &replayed); err != nil {
+			t.Fatalf("pruned message must be applied again: %v", err)
+		}
+	})
+
+	t.Run("idempotency key deduplicates requests", func(t *testing.T) {
+		store := newStore(t)
+		o := testOrder()
+		src := Source{IdempotencyKey: "request-1"}
+		if err := store.InsertOrder(WithSources(ctx, map[*models.Order]Source{o: src}), o); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+		if err := store.InsertOrder(WithSources(ctx, map[*models.Order]Source{o: src}), o); !errors.Is(err, ErrDuplicate) {
+			t.Fatalf("expected ErrDuplicate, got %v", err)
+		}
+
+		versions, err := store.(OrderHistory).ListOrderVersions(ctx, o.OrderUID)
+		if err != nil || len(versions) != 1 {
+			t.Fatalf("expected 1 version, got %d, %v", len(versions), err)
+		}
+		if versions[0].Source == nil || *versions[0].Source != src {
+			t.Fatalf("expected source %+v, got %+v", src, versions[0].Source)
+		}
+
+		other := Source{IdempotencyKey: "request-1", Offset: 1}
+		if err := store.InsertOrder(WithSources(ctx, map[*models.Order]Source{o: other}), o); err != nil {
+			t.Fatalf("another order of the request must be applied: %v", err)
+		}
+	})
+
+	t.Run("outbox publishes accepted versions", func(t *testing.T) {
+		store := newStore(t)
+		outbox, ok := store.(Outbox)
+		if !ok {
+			t.Fatalf("%T does not implement Outbox", store)
+		}
+
+		o := testOrder()
+		o.DateCreated = base
+		if err := store.InsertOrder(ctx, o); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+		updated := *o
+		updated.UpdatedAt = base.Add(time.Hour)
+		if err := store.InsertOrder(ctx, &updated); err != nil {
+			t.Fatalf("upsert: %v", err)
+		}
+		if err := store.InsertOrder(ctx, o); !errors.Is(err, ErrStale) {
+			t.Fatalf("expected ErrStale, got %v", err)
+		}
+
+		publishErr := errors.New("broker down")
+		_, err := outbox.PublishOutbox(ctx, 10, func(context.Context, []OutboxEvent) error {
+			return publishErr
+		})
+		if !errors.Is(err, publishErr) {
+			t.Fatalf("expected publish error, got %v", err)
+		}
+
+		var published []OutboxEvent
+		for range 2 {
+			n, err := outbox.PublishOutbox(ctx, 1, func(_ context.Context, events []OutboxEvent) error {
+				published = append(published, events...)
+				return nil
+			})
+			if err != nil || n != 1 {
+				t.Fatalf("publish: %d, %v", n, err)
+			}
+		}
+		if len(published) != 2 ||
+			published[0].Type != EventOrderCreated || published[0].Version != 1 ||
+			published[1].Type != EventOrderUpdated || published[1].Version != 2 {
+			t.Fatalf("unexpected events: %+v", published)
+		}
+		var payload models.Order
+		if err := json.Unmarshal(published[1].Order, &payload); err != nil || !payload.UpdatedAt.Equal(updated.UpdatedAt) {
+			t.Fatalf("unexpected event payload: %+v, %v", payload, err)
+		}
+
+		n, err := outbox.PublishOutbox(ctx, 10, func(context.Context, []OutboxEvent) error {
+			t.Fatalf("published events must not be delivered again")
+			return nil
+		})
+		if err != nil || n != 0 {
+			t.Fatalf("expected empty outbox, got %d, %v", n, err)
+		}
+	})
+
+	t.Run("iterate returns newest orders oldest first", func(t *testing.T) {
+		store := newStore(t)
+		ids := insertTimeline(t, store, base, 4)
+
+		var got []string
+		err := store.IterateOrders(ctx, 3, func(o *models.Order) error {
+			got = append(got, o.OrderUID)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("iterate: %v", err)
+		}
+		if !reflect.DeepEqual(got, ids[1:]) {
+			t.Fatalf("expected %v, got %v", ids[1:], got)
+		}
+	})
+
+	t.Run("list paginates newest first", func(t *testing.T) {
+		store := newStore(t)
+		ids := insertTimeline(t, store, base, 5)
+
+		var got []string
+		filter := OrderFilter{Limit: 2}
+		for pages := 0; ; pages++ {
+			if pages > 3 {
+				t.Fatalf("pagination did not terminate")
+			}
+			page, err := store.ListOrders(ctx, filter)
+			if err != nil {
+				t.Fatalf("list: %v", err)
+			}
+			for _, o := range page.Orders {
+				got = append(got, o.OrderUID)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			filter.Cursor = page.NextCursor
+		}
+
+		want := []string{ids[4], ids[3], ids[2], ids[1], ids[0]}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("list filters", func(t *testing.T) {
+		store := newStore(t)
+		ids := insertTimeline(t, store, base, 4)
+
+		tests := []struct {
+			name   string
+			filter OrderFilter
+			want   []string
+		}{
+			{name: "customer", filter: OrderFilter{CustomerID: "customer-1"}, want: []string{ids[3], ids[1]}},
+			{name: "currency", filter: OrderFilter{Currency: "EUR"}, want: []string{ids[2]}},
+			{name: "track number", filter: OrderFilter{TrackNumber: "TRACK-0"}, want: []string{ids[0]}},
+			{
+				name:   "date range",
+				filter: OrderFilter{CreatedFrom: base.Add(time.Hour), CreatedTo: base.Add(3 * time.Hour)},
+				want:   []string{ids[2], ids[1]},
+			},
+			{name: "no match", filter: OrderFilter{Locale: "fr"}, want: nil},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				page, err := store.ListOrders(ctx, tt.filter)
+				if err != nil {
+					t.Fatalf("list: %v", err)
+				}
+				var got []string
+				for _, o := range page.Orders {
+					got = append(got, o.OrderUID)
+				}
+				if !reflect.DeepEqual(got, tt.want) || page.NextCursor != "" {
+					t.Fatalf("expected %v, got %v (next %q)", tt.want, got, page.NextCursor)
+				}
+			})
+		}
+
+		if _, err := store.ListOrders(ctx, OrderFilter{Cursor: "broken"}); !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("expected ErrInvalidCursor, got %v", err)
+		}
+	})
+}
+
+// insertTimeline сохраняет count заказов с date_created через час, начиная с base,
+// и возвращает их order_uid от старых к новым. Заказы с нечетным индексом принадлежат
+// customer-1, третий заказ оплачен в EUR.
+func insertTimeline(t *testing.T, store OrderStore, base time.Time, count int) []string {
+	t.Helper()
+	ids := make([]string, count)
+	for i := range ids {
+		o := testOrder()
+		o.DateCreated = base.Add(time.Duration(i) * time.Hour)
+		o.TrackNumber = "TRACK-" + string(rune('0'+i))
+		o.CustomerID = "customer-" + string(rune('0'+i%2))
+		if i == 2 {
+			o.Payment.Currency = "EUR"
+		}
+		if err := store.InsertOrder(context.Background(), o); err != nil {
+			t.Fatalf("insert: %v", err)
+		}
+		ids[i] = o.OrderUID
+	}
+	return ids
+}
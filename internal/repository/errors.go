@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Доменные ошибки хранилищ. Реализации OrderStore и Cache оборачивают ими свои ошибки,
+// чтобы вызывающий код не зависел от драйвера: errors.Is(err, ErrNotFound).
+var (
+	// ErrNotFound — запрошенный заказ отсутствует.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict — данные нарушают ограничения хранилища.
+	ErrConflict = errors.New("conflict")
+	// ErrUnavailable — хранилище временно недоступно, операцию можно повторить.
+	ErrUnavailable = errors.New("storage unavailable")
+	// ErrStale — в хранилище уже есть более новая версия заказа, запись не применена.
+	ErrStale = errors.New("stale order version")
+	// ErrDuplicate — сообщение уже обработано, запись не применена.
+	ErrDuplicate = errors.New("duplicate message")
+)
+
+// domainErrors — доменные ошибки, которые classifyPgError пропускает без изменений.
+var domainErrors = []error{ErrNotFound, ErrConflict, ErrUnavailable, ErrStale, ErrDuplicate}
+
+// Error связывает исходную ошибку хранилища с доменной ошибкой Kind.
+// Текст ошибки не меняется, а errors.Is находит и Kind, и исходную ошибку.
+type Error struct {
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap возвращает доменную и исходную ошибки.
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// wrapError оборачивает err доменной ошибкой kind.
+func wrapError(kind, err error) error {
+	return &Error{Kind: kind, Err: err}
+}
+
+// classifyPgError сопоставляет ошибку pgx с доменной ошибкой.
+// Ошибки без соответствия возвращаются без изменений.
+func classifyPgError(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, kind := range domainErrors {
+		if errors.Is(err, kind) {
+			return err
+		}
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return wrapError(ErrNotFound, err)
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		// 23 — нарушение ограничений целостности
+		case strings.HasPrefix(pgErr.Code, "23"):
+			return wrapError(ErrConflict, err)
+		// 08 — ошибки соединения, 53 — нехватка ресурсов, 57P — остановка сервера
+		case strings.HasPrefix(pgErr.Code, "08"),
+			strings.HasPrefix(pgErr.Code, "53"),
+			strings.HasPrefix(pgErr.Code, "57P"):
+			return wrapError(ErrUnavailable, err)
+		}
+		return err
+	}
+
+	var connErr *pgconn.ConnectError
+	if errors.As(err, &connErr) {
+		return wrapError(ErrUnavailable, err)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return wrapError(ErrUnavailable, err)
+	}
+	return err
+}
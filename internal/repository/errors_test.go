@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestClassifyPgError(t *testing.T) {
+	other := errors.New("boom")
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "no rows", err: fmt.Errorf("get order: %w", pgx.ErrNoRows), want: ErrNotFound},
+		{name: "unique violation", err: &pgconn.PgError{Code: "23505"}, want: ErrConflict},
+		{name: "check violation", err: &pgconn.PgError{Code: "23514"}, want: ErrConflict},
+		{name: "connection failure", err: &pgconn.PgError{Code: "08006"}, want: ErrUnavailable},
+		{name: "admin shutdown", err: &pgconn.PgError{Code: "57P01"}, want: ErrUnavailable},
+		{name: "syntax error", err: &pgconn.PgError{Code: "42601"}, want: nil},
+		{name: "unknown", err: other, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := classifyPgError(tt.err)
+			if !errors.Is(got, tt.err) {
+				t.Fatalf("original error must be preserved: %v", got)
+			}
+			if got.Error() != tt.err.Error() {
+				t.Fatalf("error text changed: %q", got.Error())
+			}
+			for _, kind := range domainErrors {
+				if errors.Is(got, kind) != (kind == tt.want) {
+					t.Fatalf("errors.Is(%v, %v) = %v", got, kind, !(kind == tt.want))
+				}
+			}
+		})
+	}
+}
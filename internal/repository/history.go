@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/models"
+)
+
+// Source — источник заказа: координаты сообщения Kafka или ключ идемпотентности
+// HTTP-запроса. Для HTTP-запроса Offset — номер заказа в теле запроса.
+type Source struct {
+	Topic          string `json:"topic,omitempty"`
+	Partition      int    `json:"partition"`
+	Offset         int64  `json:"offset"`
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// IsZero сообщает, что источник не задан (заказ получен не из Kafka и без ключа идемпотентности).
+func (s Source) IsZero() bool {
+	return s.Topic == "" && s.IdempotencyKey == ""
+}
+
+// OrderVersion — принятая версия заказа.
+type OrderVersion struct {
+	OrderUID  string       `json:"order_uid"`
+	Version   int          `json:"version"`
+	Checksum  string       `json:"checksum"`
+	Source    *Source      `json:"source,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+	Order     models.Order `json:"order"`
+}
+
+// OrderHistory описывает чтение истории версий заказов.
+// Версии записываются хранилищем при каждом успешном InsertOrder.
+type OrderHistory interface {
+	// ListOrderVersions возвращает версии заказа по возрастанию номера.
+	ListOrderVersions(ctx context.Context, orderUID string) ([]OrderVersion, error)
+	// GetOrderVersion возвращает одну версию заказа.
+	GetOrderVersion(ctx context.Context, orderUID string, version int) (*OrderVersion, error)
+}
+
+type sourcesKey struct{}
+
+// WithSources добавляет в контекст источники заказов, передаваемых в InsertOrder/InsertOrders.
+// Источник заказа ищется по указателю, поэтому в хранилище нужно передавать те же значения.
+func WithSources(ctx context.Context, sources map[*models.Order]Source) context.Context {
+	return context.WithValue(ctx, sourcesKey{}, sources)
+}
+
+// SourceFromContext возвращает источник заказа o, заданный через WithSources, или nil.
+func SourceFromContext(ctx context.Context, o *models.Order) *Source {
+	sources, _ := ctx.Value(sourcesKey{}).(map[*models.Order]Source)
+	src, ok := sources[o]
+	if !ok || src.IsZero() {
+		return nil
+	}
+	return &src
+}
+
+// encodeVersion сериализует заказ для истории и считает контрольную сумму SHA-256 полученного JSON.
+func encodeVersion(o *models.Order) ([]byte, string, error) {
+	payload, err := json.Marshal(o)
+	if err != nil {
+		return nil, "", fmt.Errorf("encode order version: %w", err)
+	}
+	sum := sha256.Sum256(payload)
+	return payload, hex.EncodeToString(sum[:]), nil
+}
@@ -9,6 +9,7 @@ import (
 )
 
 // CacheReader описывает чтение заказов из кеша.
+// Отсутствие заказа возвращается как ErrNotFound.
 type CacheReader interface {
 	GetByID(orderUID string) (*models.Order, error)
 }
@@ -26,8 +27,15 @@ type Cache interface {
 }
 
 // OrderStore описывает операции хранилища для заказов.
+// Реализации оборачивают ошибки в ErrNotFound, ErrConflict, ErrUnavailable, ErrStale и ErrDuplicate.
+// Заказ с Revision старше сохраненного не применяется: InsertOrder возвращает ErrStale.
 type OrderStore interface {
 	InsertOrder(ctx context.Context, o *models.Order) error
+	// InsertOrders сохраняет пачку заказов и возвращает ошибки по индексам заказов.
+	InsertOrders(ctx context.Context, orders []*models.Order) []error
 	GetOrderByID(ctx context.Context, orderUID string) (*models.Order, error)
-	GetAllOrders(ctx context.Context) ([]models.Order, error)
+	// IterateOrders передает в fn последние limit заказов по date_created от старых к новым.
+	IterateOrders(ctx context.Context, limit int, fn func(*models.Order) error) error
+	// ListOrders возвращает страницу заказов по фильтру от новых к старым.
+	ListOrders(ctx context.Context, filter OrderFilter) (*OrderPage, error)
 }
@@ -0,0 +1,25 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// MessageLedger описывает журнал обработанных сообщений.
+// Хранилище записывает ключ сообщения в той же транзакции, что и заказ, и для уже
+// обработанного сообщения возвращает из InsertOrder ErrDuplicate, не выполняя запись заказа.
+// Ключ строится по источнику, переданному через WithSources; заказы без источника не журналируются.
+// Для HTTP-запросов ключ строится по заголовку Idempotency-Key и номеру заказа в запросе.
+type MessageLedger interface {
+	// PruneProcessedMessages удаляет записи журнала, созданные раньше before, и возвращает их число.
+	PruneProcessedMessages(ctx context.Context, before time.Time) (int64, error)
+}
+
+// messageKey возвращает ключ сообщения в журнале обработанных сообщений.
+func (s Source) messageKey() string {
+	if s.IdempotencyKey != "" {
+		return fmt.Sprintf("http:%s/%d", s.IdempotencyKey, s.Offset)
+	}
+	return fmt.Sprintf("kafka:%s/%d/%d", s.Topic, s.Partition, s.Offset)
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/models"
+)
+
+// ErrInvalidCursor возвращается, если курсор страницы не удалось разобрать.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const (
+	// DefaultListLimit — размер страницы по умолчанию.
+	DefaultListLimit = 50
+	// MaxListLimit — максимальный размер страницы.
+	MaxListLimit = 500
+)
+
+// OrderFilter задает условия выборки списка заказов. Пустые поля не ограничивают выборку.
+// Интервал CreatedFrom/CreatedTo полуоткрытый: [CreatedFrom, CreatedTo).
+type OrderFilter struct {
+	CustomerID      string
+	TrackNumber     string
+	DeliveryService string
+	Entry           string
+	Locale          string
+	Currency        string
+	CreatedFrom     time.Time
+	CreatedTo       time.Time
+	Cursor          string
+	Limit           int
+}
+
+// OrderPage — страница списка заказов, упорядоченных от новых к старым.
+type OrderPage struct {
+	Orders     []models.Order `json:"orders"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// PageLimit возвращает размер страницы с учетом значения по умолчанию и максимума.
+func (f OrderFilter) PageLimit() int {
+	if f.Limit <= 0 {
+		return DefaultListLimit
+	}
+	return min(f.Limit, MaxListLimit)
+}
+
+// PageCursor — позиция в списке заказов по ключу (date_created, order_uid).
+type PageCursor struct {
+	DateCreated time.Time
+	OrderUID    string
+}
+
+// EncodeCursor кодирует позицию последнего заказа страницы в непрозрачную строку.
+func EncodeCursor(o *models.Order) string {
+	raw := o.DateCreated.UTC().Format(time.RFC3339Nano) + "|" + o.OrderUID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor разбирает курсор, полученный из EncodeCursor.
+func DecodeCursor(cursor string) (PageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return PageCursor{}, ErrInvalidCursor
+	}
+	ts, uid, ok := strings.Cut(string(raw), "|")
+	if !ok || uid == "" {
+		return PageCursor{}, ErrInvalidCursor
+	}
+	created, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return PageCursor{}, ErrInvalidCursor
+	}
+	return PageCursor{DateCreated: created, OrderUID: uid}, nil
+}
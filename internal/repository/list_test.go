@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	order := testOrder()
+	order.DateCreated = time.Date(2025, 3, 1, 10, 30, 0, 123456000, time.FixedZone("MSK", 3*60*60))
+
+	got, err := DecodeCursor(EncodeCursor(order))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !got.DateCreated.Equal(order.DateCreated) || got.OrderUID != order.OrderUID {
+		t.Fatalf("unexpected cursor: %+v", got)
+	}
+
+	for _, bad := range []string{"!!", "bm8tc2VwYXJhdG9y", "bm90LWEtZGF0ZXx1aWQ"} {
+		if _, err := DecodeCursor(bad); !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("cursor %q: expected ErrInvalidCursor, got %v", bad, err)
+		}
+	}
+}
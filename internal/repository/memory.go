@@ -0,0 +1,347 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/models"
+	"github.com/google/uuid"
+)
+
+// MemoryOrderStore хранит заказы в памяти процесса.
+// Повторяет семантику PostgresStorage: вставка заменяет заказ целиком вместе с товарами,
+// order_uid приводится к каноническому виду UUID, date_created и updated_at — к UTC с точностью
+// до микросекунд, версия старше сохраненной отклоняется с ErrStale, каждая принятая вставка
+// добавляет версию в историю заказа и событие в outbox, а повторное сообщение с тем же источником отклоняется
+// с ErrDuplicate.
+// Подходит для тестов и локального запуска без PostgreSQL; данные не переживают перезапуск.
+type MemoryOrderStore struct {
+	mu       sync.RWMutex
+	orders   map[string]*models.Order
+	versions map[string][]memoryVersion
+	// processed — журнал обработанных сообщений: ключ сообщения и время обработки.
+	processed map[string]time.Time
+	// outbox — неопубликованные события в порядке добавления.
+	outbox      []OutboxEvent
+	lastEventID int64
+	// publishMu не дает одновременным PublishOutbox забрать одни и те же события.
+	publishMu sync.Mutex
+}
+
+// memoryVersion — версия заказа; заказ хранится сериализованным, как в order_versions.
+type memoryVersion struct {
+	meta    OrderVersion
+	payload []byte
+}
+
+// NewMemoryOrderStore создает пустой MemoryOrderStore.
+func NewMemoryOrderStore() *MemoryOrderStore {
+	return &MemoryOrderStore{
+		orders:    make(map[string]*models.Order),
+		versions:  make(map[string][]memoryVersion),
+		processed: make(map[string]time.Time),
+	}
+}
+
+// InsertOrder выполняет вставку или замену заказа.
+func (s *MemoryOrderStore) InsertOrder(ctx context.Context, o *models.Order) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	id, err := uuid.Parse(o.OrderUID)
+	if err != nil {
+		return fmt.Errorf("invalid order_uid %q: %w", o.OrderUID, err)
+	}
+
+	payload, checksum, err := encodeVersion(o)
+	if err != nil {
+		return err
+	}
+
+	stored := cloneOrder(o)
+	stored.OrderUID = id.String()
+	stored.DateCreated = storedTime(o.DateCreated)
+	stored.UpdatedAt = storedTime(o.Revision())
+
+	src := SourceFromContext(ctx, o)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if src != nil {
+		if _, ok := s.processed[src.messageKey()]; ok {
+			return fmt.Errorf("order %s: %w", o.OrderUID, ErrDuplicate)
+		}
+	}
+	if current, ok := s.orders[stored.OrderUID]; ok && current.UpdatedAt.After(stored.UpdatedAt) {
+		return fmt.Errorf("order %s: %w", o.OrderUID, ErrStale)
+	}
+	now := time.Now().UTC()
+	if src != nil {
+		s.processed[src.messageKey()] = now
+	}
+	s.orders[stored.OrderUID] = stored
+	version := len(s.versions[stored.OrderUID]) + 1
+	s.versions[stored.OrderUID] = append(s.versions[stored.OrderUID], memoryVersion{
+		meta: OrderVersion{
+			OrderUID:  stored.OrderUID,
+			Version:   version,
+			Checksum:  checksum,
+			Source:    src,
+			CreatedAt: now,
+		},
+		payload: payload,
+	})
+	s.lastEventID++
+	s.outbox = append(s.outbox, OutboxEvent{
+		ID:        s.lastEventID,
+		Type:      eventType(version),
+		OrderUID:  stored.OrderUID,
+		Version:   version,
+		CreatedAt: now,
+		Order:     payload,
+	})
+	return nil
+}
+
+// InsertOrders сохраняет заказы по одному и возвращает ошибки по индексам заказов.
+func (s *MemoryOrderStore) InsertOrders(ctx context.Context, orders []*models.Order) []error {
+	errs := make([]error, len(orders))
+	for i, o := range orders {
+		errs[i] = s.InsertOrder(ctx, o)
+	}
+	return errs
+}
+
+// PruneProcessedMessages удаляет записи журнала обработанных сообщений старше before.
+func (s *MemoryOrderStore) PruneProcessedMessages(ctx context.Context, before time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var pruned int64
+	for key, processedAt := range s.processed {
+		if processedAt.Before(before) {
+			delete(s.processed, key)
+			pruned++
+		}
+	}
+	return pruned, nil
+}
+
+// PublishOutbox передает в publish до limit первых событий outbox и удаляет их после успешной публикации.
+func (s *MemoryOrderStore) PublishOutbox(ctx context.Context, limit int, publish func(ctx context.Context, events []OutboxEvent) error) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	s.publishMu.Lock()
+	defer s.publishMu.Unlock()
+
+	s.mu.RLock()
+	events := slices.Clone(s.outbox[:min(max(limit, 1), len(s.outbox))])
+	s.mu.RUnlock()
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	if err := publish(ctx, events); err != nil {
+		return 0, err
+	}
+
+	// новые события добавляются в конец, поэтому опубликованные остаются в начале очереди
+	s.mu.Lock()
+	s.outbox = slices.Delete(s.outbox, 0, len(events))
+	s.mu.Unlock()
+	return len(events), nil
+}
+
+// GetOrderByID возвращает копию заказа по ID.
+func (s *MemoryOrderStore) GetOrderByID(ctx context.Context, orderUID string) (*models.Order, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	o, ok := s.orders[canonicalUID(orderUID)]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("get order %s: %w", orderUID, ErrNotFound)
+	}
+	return cloneOrder(o), nil
+}
+
+// ListOrderVersions возвращает историю версий заказа по возрастанию номера.
+func (s *MemoryOrderStore) ListOrderVersions(ctx context.Context, orderUID string) ([]OrderVersion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	stored := s.versions[canonicalUID(orderUID)]
+	s.mu.RUnlock()
+	if len(stored) == 0 {
+		return nil, fmt.Errorf("list order versions %s: %w", orderUID, ErrNotFound)
+	}
+
+	versions := make([]OrderVersion, len(stored))
+	for i, v := range stored {
+		decoded, err := v.decode()
+		if err != nil {
+			return nil, err
+		}
+		versions[i] = *decoded
+	}
+	return versions, nil
+}
+
+// GetOrderVersion возвращает версию заказа по номеру.
+func (s *MemoryOrderStore) GetOrderVersion(ctx context.Context, orderUID string, version int) (*OrderVersion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	stored := s.versions[canonicalUID(orderUID)]
+	s.mu.RUnlock()
+	if version < 1 || version > len(stored) {
+		return nil, fmt.Errorf("get order version %s/%d: %w", orderUID, version, ErrNotFound)
+	}
+	return stored[version-1].decode()
+}
+
+// decode возвращает копию версии с разобранным заказом.
+func (v memoryVersion) decode() (*OrderVersion, error) {
+	decoded := v.meta
+	if v.meta.Source != nil {
+		src := *v.meta.Source
+		decoded.Source = &src
+	}
+	if err := json.Unmarshal(v.payload, &decoded.Order); err != nil {
+		return nil, fmt.Errorf("decode order version: %w", err)
+	}
+	return &decoded, nil
+}
+
+// IterateOrders передает в fn последние limit заказов по date_created
+// в порядке от старых к новым (limit <= 0 — все заказы).
+func (s *MemoryOrderStore) IterateOrders(ctx context.Context, limit int, fn func(*models.Order) error) error {
+	orders := s.sorted()
+	if limit > 0 && len(orders) > limit {
+		orders = orders[:limit]
+	}
+	for i := len(orders) - 1; i >= 0; i-- {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(orders[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListOrders возвращает страницу заказов от новых к старым по ключу (date_created, order_uid).
+func (s *MemoryOrderStore) ListOrders(ctx context.Context, filter OrderFilter) (*OrderPage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var cursor *PageCursor
+	if filter.Cursor != "" {
+		c, err := DecodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		cursor = &c
+	}
+
+	limit := filter.PageLimit()
+	page := &OrderPage{Orders: make([]models.Order, 0, limit)}
+	for _, o := range s.sorted() {
+		if cursor != nil && !keyLess(o, cursor.DateCreated, cursor.OrderUID) {
+			continue
+		}
+		if !filter.match(o) {
+			continue
+		}
+		if len(page.Orders) == limit {
+			page.NextCursor = EncodeCursor(&page.Orders[limit-1])
+			break
+		}
+		page.Orders = append(page.Orders, *o)
+	}
+	return page, nil
+}
+
+// sorted возвращает копии всех заказов от новых к старым.
+func (s *MemoryOrderStore) sorted() []*models.Order {
+	s.mu.RLock()
+	orders := make([]*models.Order, 0, len(s.orders))
+	for _, o := range s.orders {
+		orders = append(orders, cloneOrder(o))
+	}
+	s.mu.RUnlock()
+
+	slices.SortFunc(orders, func(a, b *models.Order) int {
+		if c := b.DateCreated.Compare(a.DateCreated); c != 0 {
+			return c
+		}
+		return strings.Compare(b.OrderUID, a.OrderUID)
+	})
+	return orders
+}
+
+// keyLess сообщает, меньше ли ключ (date_created, order_uid) заказа o, чем (created, uid).
+func keyLess(o *models.Order, created time.Time, uid string) bool {
+	if c := o.DateCreated.Compare(created); c != 0 {
+		return c < 0
+	}
+	return o.OrderUID < uid
+}
+
+// match проверяет заказ на соответствие фильтру без учета курсора и лимита.
+func (f OrderFilter) match(o *models.Order) bool {
+	for _, cond := range []struct{ want, got string }{
+		{f.CustomerID, o.CustomerID},
+		{f.TrackNumber, o.TrackNumber},
+		{f.DeliveryService, o.DeliveryService},
+		{f.Entry, o.Entry},
+		{f.Locale, o.Locale},
+		{f.Currency, o.Payment.Currency},
+	} {
+		if cond.want != "" && cond.want != cond.got {
+			return false
+		}
+	}
+	if !f.CreatedFrom.IsZero() && o.DateCreated.Before(f.CreatedFrom) {
+		return false
+	}
+	if !f.CreatedTo.IsZero() && !o.DateCreated.Before(f.CreatedTo) {
+		return false
+	}
+	return true
+}
+
+// canonicalUID приводит order_uid к каноническому виду UUID, как его возвращает PostgreSQL.
+func canonicalUID(orderUID string) string {
+	if id, err := uuid.Parse(orderUID); err == nil {
+		return id.String()
+	}
+	return orderUID
+}
+
+// storedTime приводит время к виду, в котором его возвращает колонка TIMESTAMP.
+func storedTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+// cloneOrder возвращает копию заказа, не разделяющую срез товаров с оригиналом.
+func cloneOrder(o *models.Order) *models.Order {
+	c := *o
+	c.Items = slices.Clone(o.Items)
+	if c.Items == nil {
+		c.Items = []models.Item{}
+	}
+	return &c
+}
@@ -4,6 +4,7 @@ package mocks
 import (
 	"context"
 	"errors"
+	"sync"
 	"time"
 
 	"github.com/RoGogDBD/wb/internal/models"
@@ -17,11 +18,15 @@ type CacheMock struct {
 	SaveCalls         int
 	GetByIDCalls      int
 	StartJanitorCalls int
+
+	mu sync.Mutex
 }
 
 // Save фиксирует вызов Save.
 func (m *CacheMock) Save(order *models.Order) {
+	m.mu.Lock()
 	m.SaveCalls++
+	m.mu.Unlock()
 	if m.SaveFunc != nil {
 		m.SaveFunc(order)
 	}
@@ -29,7 +34,9 @@ func (m *CacheMock) Save(order *models.Order) {
 
 // GetByID фиксирует вызов GetByID.
 func (m *CacheMock) GetByID(orderUID string) (*models.Order, error) {
+	m.mu.Lock()
 	m.GetByIDCalls++
+	m.mu.Unlock()
 	if m.GetByIDFunc == nil {
 		return nil, errors.New("GetByIDFunc not set")
 	}
@@ -38,7 +45,9 @@ func (m *CacheMock) GetByID(orderUID string) (*models.Order, error) {
 
 // StartJanitor фиксирует вызов StartJanitor.
 func (m *CacheMock) StartJanitor(ctx context.Context, interval time.Duration) {
+	m.mu.Lock()
 	m.StartJanitorCalls++
+	m.mu.Unlock()
 	if m.StartJanitorFunc != nil {
 		m.StartJanitorFunc(ctx, interval)
 	}
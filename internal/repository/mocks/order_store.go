@@ -3,43 +3,111 @@ package mocks
 import (
 	"context"
 	"errors"
+	"sync"
 
 	"github.com/RoGogDBD/wb/internal/models"
+	"github.com/RoGogDBD/wb/internal/repository"
 )
 
-// OrderStoreMock — мок-реализация repository.OrderStore.
+// OrderStoreMock — мок-реализация repository.OrderStore и repository.OrderHistory.
 type OrderStoreMock struct {
-	InsertOrderFunc   func(ctx context.Context, o *models.Order) error
-	GetOrderByIDFunc  func(ctx context.Context, orderUID string) (*models.Order, error)
-	GetAllOrdersFunc  func(ctx context.Context) ([]models.Order, error)
-	InsertOrderCalls  int
-	GetOrderByIDCalls int
-	GetAllOrdersCalls int
+	InsertOrderFunc    func(ctx context.Context, o *models.Order) error
+	InsertOrdersFunc   func(ctx context.Context, orders []*models.Order) []error
+	GetOrderByIDFunc   func(ctx context.Context, orderUID string) (*models.Order, error)
+	IterateOrdersFunc  func(ctx context.Context, limit int, fn func(*models.Order) error) error
+	ListOrdersFunc     func(ctx context.Context, filter repository.OrderFilter) (*repository.OrderPage, error)
+	InsertOrderCalls   int
+	InsertOrdersCalls  int
+	GetOrderByIDCalls  int
+	IterateOrdersCalls int
+	ListOrdersCalls    int
+
+	ListOrderVersionsFunc  func(ctx context.Context, orderUID string) ([]repository.OrderVersion, error)
+	GetOrderVersionFunc    func(ctx context.Context, orderUID string, version int) (*repository.OrderVersion, error)
+	ListOrderVersionsCalls int
+	GetOrderVersionCalls   int
+
+	mu sync.Mutex
 }
 
 // InsertOrder фиксирует вызов InsertOrder.
 func (m *OrderStoreMock) InsertOrder(ctx context.Context, o *models.Order) error {
+	m.mu.Lock()
 	m.InsertOrderCalls++
+	m.mu.Unlock()
 	if m.InsertOrderFunc == nil {
 		return errors.New("InsertOrderFunc not set")
 	}
 	return m.InsertOrderFunc(ctx, o)
 }
 
+// InsertOrders фиксирует вызов InsertOrders.
+// Без InsertOrdersFunc заказы сохраняются по одному через InsertOrder.
+func (m *OrderStoreMock) InsertOrders(ctx context.Context, orders []*models.Order) []error {
+	m.mu.Lock()
+	m.InsertOrdersCalls++
+	m.mu.Unlock()
+	if m.InsertOrdersFunc != nil {
+		return m.InsertOrdersFunc(ctx, orders)
+	}
+	errs := make([]error, len(orders))
+	for i, o := range orders {
+		errs[i] = m.InsertOrder(ctx, o)
+	}
+	return errs
+}
+
 // GetOrderByID фиксирует вызов GetOrderByID.
 func (m *OrderStoreMock) GetOrderByID(ctx context.Context, orderUID string) (*models.Order, error) {
+	m.mu.Lock()
 	m.GetOrderByIDCalls++
+	m.mu.Unlock()
 	if m.GetOrderByIDFunc == nil {
 		return nil, errors.New("GetOrderByIDFunc not set")
 	}
 	return m.GetOrderByIDFunc(ctx, orderUID)
 }
 
-// GetAllOrders фиксирует вызов GetAllOrders.
-func (m *OrderStoreMock) GetAllOrders(ctx context.Context) ([]models.Order, error) {
-	m.GetAllOrdersCalls++
-	if m.GetAllOrdersFunc == nil {
-		return nil, errors.New("GetAllOrdersFunc not set")
+// IterateOrders фиксирует вызов IterateOrders.
+func (m *OrderStoreMock) IterateOrders(ctx context.Context, limit int, fn func(*models.Order) error) error {
+	m.mu.Lock()
+	m.IterateOrdersCalls++
+	m.mu.Unlock()
+	if m.IterateOrdersFunc == nil {
+		return errors.New("IterateOrdersFunc not set")
+	}
+	return m.IterateOrdersFunc(ctx, limit, fn)
+}
+
+// ListOrders фиксирует вызов ListOrders.
+func (m *OrderStoreMock) ListOrders(ctx context.Context, filter repository.OrderFilter) (*repository.OrderPage, error) {
+	m.mu.Lock()
+	m.ListOrdersCalls++
+	m.mu.Unlock()
+	if m.ListOrdersFunc == nil {
+		return nil, errors.New("ListOrdersFunc not set")
+	}
+	return m.ListOrdersFunc(ctx, filter)
+}
+
+// ListOrderVersions фиксирует вызов ListOrderVersions.
+func (m *OrderStoreMock) ListOrderVersions(ctx context.Context, orderUID string) ([]repository.OrderVersion, error) {
+	m.mu.Lock()
+	m.ListOrderVersionsCalls++
+	m.mu.Unlock()
+	if m.ListOrderVersionsFunc == nil {
+		return nil, errors.New("ListOrderVersionsFunc not set")
+	}
+	return m.ListOrderVersionsFunc(ctx, orderUID)
+}
+
+// GetOrderVersion фиксирует вызов GetOrderVersion.
+func (m *OrderStoreMock) GetOrderVersion(ctx context.Context, orderUID string, version int) (*repository.OrderVersion, error) {
+	m.mu.Lock()
+	m.GetOrderVersionCalls++
+	m.mu.Unlock()
+	if m.GetOrderVersionFunc == nil {
+		return nil, errors.New("GetOrderVersionFunc not set")
 	}
-	return m.GetAllOrdersFunc(ctx)
+	return m.GetOrderVersionFunc(ctx, orderUID, version)
 }
@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Типы событий изменения заказа.
+const (
+	// EventOrderCreated — сохранена первая версия заказа.
+	EventOrderCreated = "order.created"
+	// EventOrderUpdated — сохранена следующая версия заказа.
+	EventOrderUpdated = "order.updated"
+)
+
+// OutboxEvent — событие изменения заказа, ожидающее публикации.
+// Order содержит заказ в том же виде, в каком он записан в историю версий.
+type OutboxEvent struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	OrderUID  string          `json:"order_uid"`
+	Version   int             `json:"version"`
+	CreatedAt time.Time       `json:"created_at"`
+	Order     json.RawMessage `json:"order"`
+}
+
+// Outbox описывает очередь событий изменения заказов (transactional outbox).
+// Хранилище добавляет событие в той же транзакции, что и принятую версию заказа.
+type Outbox interface {
+	// PublishOutbox забирает до limit неопубликованных событий в порядке добавления и передает их в publish.
+	// Если publish завершился без ошибки, события удаляются из очереди; иначе остаются и будут
+	// переданы повторно (at-least-once). Одновременные вызовы, в том числе из разных процессов,
+	// получают разные события. Возвращает число опубликованных событий.
+	PublishOutbox(ctx context.Context, limit int, publish func(ctx context.Context, events []OutboxEvent) error) (int, error)
+}
+
+// eventType возвращает тип события для версии заказа.
+func eventType(version int) string {
+	if version == 1 {
+		return EventOrderCreated
+	}
+	return EventOrderUpdated
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName — имя инструментирования трассировки запросов к PostgreSQL.
+const tracerName = "github.com/RoGogDBD/wb/internal/repository"
+
+// QueryTracer создает span OpenTelemetry на каждый запрос pgx и на каждый pgx.Batch.
+// Span называется по имени запроса, которое PostgresStorage передает через контекст
+// (например, "get order"); для запросов без имени (begin, commit) используется SQL-команда.
+// Параметры запросов в span не записываются.
+type QueryTracer struct{}
+
+var (
+	_ pgx.QueryTracer = QueryTracer{}
+	_ pgx.BatchTracer = QueryTracer{}
+)
+
+type statementKey struct{}
+
+type batchStatementsKey struct{}
+
+// withStatement добавляет в контекст имя запроса для span.
+func withStatement(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, statementKey{}, name)
+}
+
+// withBatchStatements добавляет в контекст имена запросов pgx.Batch в порядке постановки.
+func withBatchStatements(ctx context.Context, stmts []statement) context.Context {
+	names := make([]string, len(stmts))
+	for i, st := range stmts {
+		names[i] = st.name
+	}
+	return context.WithValue(ctx, batchStatementsKey{}, names)
+}
+
+// batchState — запросы pgx.Batch, для которых еще не пришел результат.
+type batchState struct {
+	names []string
+	next  int
+}
+
+type batchStateKey struct{}
+
+// TraceQueryStart начинает span запроса.
+func (QueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	operation := sqlOperation(data.SQL)
+	name, _ := ctx.Value(statementKey{}).(string)
+	if name == "" {
+		name = operation
+	}
+	ctx, _ = otel.Tracer(tracerName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", "postgresql"),
+			attribute.String("db.operation.name", operation),
+		),
+	)
+	return ctx
+}
+
+// TraceQueryEnd завершает span запроса.
+func (QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	if data.Err == nil {
+		span.SetAttributes(attribute.Int64("db.response.rows_affected", data.CommandTag.RowsAffected()))
+	}
+	endQuerySpan(span, data.Err)
+}
+
+// TraceBatchStart начинает span пачки; запросы пачки записываются в него событиями
+// с именами из withBatchStatements.
+func (QueryTracer) TraceBatchStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	names, _ := ctx.Value(batchStatementsKey{}).([]string)
+	name, _ := ctx.Value(statementKey{}).(string)
+	if name == "" {
+		name = "BATCH"
+	}
+	ctx, _ = otel.Tracer(tracerName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system.name", "postgresql"),
+			attribute.String("db.operation.name", "BATCH"),
+			attribute.Int("db.operation.batch.size", data.Batch.Len()),
+		),
+	)
+	return context.WithValue(ctx, batchStateKey{}, &batchState{names: names})
+}
+
+// TraceBatchQuery записывает событие о выполненном запросе пачки.
+func (QueryTracer) TraceBatchQuery(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchQueryData) {
+	name := sqlOperation(data.SQL)
+	if state, ok := ctx.Value(batchStateKey{}).(*batchState); ok {
+		if state.next < len(state.names) && state.names[state.next] != "" {
+			name = state.names[state.next]
+		}
+		state.next++
+	}
+	attrs := []attribute.KeyValue{attribute.Int64("db.response.rows_affected", data.CommandTag.RowsAffected())}
+	if data.Err != nil {
+		attrs = []attribute.KeyValue{attribute.String("error.message", data.Err.Error())}
+	}
+	trace.SpanFromContext(ctx).AddEvent(name, trace.WithAttributes(attrs...))
+}
+
+// TraceBatchEnd завершает span пачки.
+func (QueryTracer) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchEndData) {
+	endQuerySpan(trace.SpanFromContext(ctx), data.Err)
+}
+
+func endQuerySpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// sqlOperation возвращает первое слово SQL-запроса в верхнем регистре (SELECT, INSERT, BEGIN).
+func sqlOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "QUERY"
+	}
+	return strings.ToUpper(fields[0])
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+func TestQueryTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	tracer := QueryTracer{}
+	const secret = "customer-secret"
+
+	ctx := tracer.TraceQueryStart(withStatement(context.Background(), "get order"), nil, pgx.TraceQueryStartData{
+		SQL:  "SELECT o.order_uid FROM orders o WHERE o.order_uid = $1",
+		Args: []any{secret},
+	})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1")})
+
+	ctx = tracer.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "begin"})
+	tracer.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{Err: errors.New("conn closed")})
+
+	stmts := []statement{{name: "upsert order"}, {name: "insert items"}}
+	batch := &pgx.Batch{}
+	batch.Queue("INSERT INTO orders VALUES ($1)", secret)
+	batch.Queue("INSERT INTO items VALUES ($1)", secret)
+	ctx = tracer.TraceBatchStart(withBatchStatements(withStatement(context.Background(), "insert orders batch"), stmts), nil,
+		pgx.TraceBatchStartData{Batch: batch})
+	tracer.TraceBatchQuery(ctx, nil, pgx.TraceBatchQueryData{SQL: "INSERT INTO orders VALUES ($1)", Args: []any{secret}})
+	tracer.TraceBatchQuery(ctx, nil, pgx.TraceBatchQueryData{SQL: "INSERT INTO items VALUES ($1)", Args: []any{secret}})
+	tracer.TraceBatchEnd(ctx, nil, pgx.TraceBatchEndData{})
+
+	spans := recorder.Ended()
+	if len(spans) != 3 {
+		t.Fatalf("expected 3 spans, got %d", len(spans))
+	}
+
+	tests := []struct {
+		name       string
+		operation  string
+		wantStatus codes.Code
+		wantEvents []string
+	}{
+		{name: "get order", operation: "SELECT", wantStatus: codes.Unset},
+		{name: "BEGIN", operation: "BEGIN", wantStatus: codes.Error},
+		{name: "insert orders batch", operation: "BATCH", wantStatus: codes.Unset, wantEvents: []string{"upsert order", "insert items"}},
+	}
+	for i, tt := range tests {
+		span := spans[i]
+		if span.Name() != tt.name {
+			t.Fatalf("span %d: expected name %q, got %q", i, tt.name, span.Name())
+		}
+		if span.Status().Code != tt.wantStatus {
+			t.Fatalf("span %q: expected status %v, got %v", tt.name, tt.wantStatus, span.Status().Code)
+		}
+		var operation string
+		for _, attr := range span.Attributes() {
+			if attr.Key == "db.operation.name" {
+				operation = attr.Value.AsString()
+			}
+			if attr.Value.Emit() == secret {
+				t.Fatalf("span %q records query parameter in %s", tt.name, attr.Key)
+			}
+		}
+		if operation != tt.operation {
+			t.Fatalf("span %q: expected operation %q, got %q", tt.name, tt.operation, operation)
+		}
+		var events []string
+		for _, ev := range span.Events() {
+			if ev.Name == "exception" {
+				continue
+			}
+			events = append(events, ev.Name)
+		}
+		if len(events) != len(tt.wantEvents) {
+			t.Fatalf("span %q: expected events %v, got %v", tt.name, tt.wantEvents, events)
+		}
+		for j := range events {
+			if events[j] != tt.wantEvents[j] {
+				t.Fatalf("span %q: expected events %v, got %v", tt.name, tt.wantEvents, events)
+			}
+		}
+	}
+}
@@ -2,11 +2,15 @@ package repository
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"slices"
+	"time"
 
 	sq "github.com/Masterminds/squirrel"
+	"github.com/RoGogDBD/wb/internal/logging"
 	"github.com/RoGogDBD/wb/internal/models"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
@@ -23,22 +27,203 @@ func NewPostgresStorage(pool *pgxpool.Pool) *PostgresStorage {
 	return &PostgresStorage{pool: pool}
 }
 
+// statement описывает подготовленный SQL-запрос и его назначение для сообщений об ошибках.
+// Если задан guard и запрос не изменил ни одной строки, запись прерывается с этой ошибкой.
+type statement struct {
+	name  string
+	sql   string
+	args  []any
+	guard error
+}
+
 // InsertOrder выполняет вставку или обновление заказа и связанных данных.
-func (r *PostgresStorage) InsertOrder(ctx context.Context, o *models.Order) error {
-	builder := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+func (r *PostgresStorage) InsertOrder(ctx context.Context, o *models.Order) (err error) {
+	defer func() { err = classifyPgError(err) }()
+
+	stmts, err := orderStatements(o, SourceFromContext(ctx, o))
+	if err != nil {
+		return err
+	}
+
 	tx, err := r.pool.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("begin tx: %w", err)
 	}
-	defer func() {
-		if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
-			log.Printf("rollback failed: %v", err)
+	defer rollback(ctx, tx)
+
+	for _, st := range stmts {
+		tag, err := tx.Exec(withStatement(ctx, st.name), st.sql, st.args...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", st.name, err)
+		}
+		if st.guard != nil && tag.RowsAffected() == 0 {
+			return fmt.Errorf("order %s: %w", o.OrderUID, st.guard)
+		}
+	}
+
+	// фиксация транзакции
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// InsertOrders сохраняет пачку заказов одной транзакцией через pgx.Batch.
+// Возвращает ошибки по индексам заказов (nil — заказ сохранен).
+// Проверки журнала сообщений и версии не прерывают транзакцию (ON CONFLICT DO NOTHING
+// и условный upsert), поэтому за один проход находятся все повторные и устаревшие заказы;
+// они получают ErrDuplicate или ErrStale, а пачка без них записывается заново.
+// По одному повторно сохраняются только заказы, запросы которых завершились ошибкой.
+func (r *PostgresStorage) InsertOrders(ctx context.Context, orders []*models.Order) []error {
+	errs := make([]error, len(orders))
+	queued := make([]batchOrder, len(orders))
+	var pending []int
+	for i, o := range orders {
+		src := SourceFromContext(ctx, o)
+		stmts, err := orderStatements(o, src)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		queued[i] = batchOrder{order: o, stmts: stmts, keys: []string{o.OrderUID}}
+		if src != nil {
+			queued[i].keys = append(queued[i].keys, src.messageKey())
+		}
+		pending = append(pending, i)
+	}
+
+	// каждый проход убирает из пачки хотя бы один заказ, поэтому цикл конечен
+	var single []int
+	for len(pending) > 0 {
+		out := r.execBatch(ctx, queued, pending)
+		if out.err == nil && len(out.rejected) == 0 {
+			break
+		}
+		for i, err := range out.rejected {
+			errs[i] = err
+		}
+		if out.err != nil {
+			if ctx.Err() != nil {
+				for _, i := range pending {
+					if errs[i] == nil {
+						errs[i] = ctx.Err()
+					}
+				}
+				return errs
+			}
+			if out.failed < 0 {
+				slog.WarnContext(ctx, "batch insert failed, falling back to single inserts", "orders", len(pending), logging.Err(out.err))
+				single = append(single, pending...)
+				break
+			}
+			slog.WarnContext(ctx, "batch insert failed on order, retrying it alone", "order_uid", orders[out.failed].OrderUID, logging.Err(out.err))
+			single = append(single, out.failed)
 		}
-	}()
+		pending = slices.DeleteFunc(pending, func(i int) bool {
+			_, rejected := out.rejected[i]
+			return rejected || i == out.failed
+		})
+	}
+
+	for _, i := range single {
+		if errs[i] == nil {
+			errs[i] = r.InsertOrder(ctx, orders[i])
+		}
+	}
+	return errs
+}
+
+// batchOrder — заказ пачки и его запросы.
+type batchOrder struct {
+	order *models.Order
+	stmts []statement
+	// keys — ключи, по которым проверки заказа зависят от записей других заказов:
+	// order_uid и ключ сообщения в журнале.
+	keys []string
+}
+
+// batchOutcome — итог попытки записать пачку. Пачка записана, если err равен nil и rejected пуст.
+type batchOutcome struct {
+	// rejected — заказы, отклоненные проверками журнала сообщений или версии.
+	rejected map[int]error
+	// failed — индекс заказа, запрос которого завершился ошибкой err; -1, если ошибка
+	// не связана с отдельным заказом (начало транзакции, фиксация).
+	failed int
+	err    error
+}
+
+// execBatch выполняет запросы заказов с индексами idx в одной транзакции. Если какой-либо
+// заказ отклонен проверкой, транзакция откатывается: запросы отклоненного заказа уже выполнены.
+// Проверку заказа, который делит order_uid или ключ сообщения с уже отклоненным заказом,
+// могли исказить записи отклоненного, поэтому такой заказ остается на следующий проход.
+func (r *PostgresStorage) execBatch(ctx context.Context, orders []batchOrder, idx []int) batchOutcome {
+	out := batchOutcome{failed: -1}
+	batch := &pgx.Batch{}
+	var queued []statement
+	var owners []int
+	for _, i := range idx {
+		for _, st := range orders[i].stmts {
+			batch.Queue(st.sql, st.args...)
+			queued = append(queued, st)
+			owners = append(owners, i)
+		}
+	}
+	tainted := make(map[string]bool)
+	isTainted := func(i int) bool {
+		return slices.ContainsFunc(orders[i].keys, func(k string) bool { return tainted[k] })
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		out.err = fmt.Errorf("begin tx: %w", err)
+		return out
+	}
+	defer rollback(ctx, tx)
+
+	results := tx.SendBatch(withBatchStatements(withStatement(ctx, "insert orders batch"), queued), batch)
+	for n, st := range queued {
+		i := owners[n]
+		tag, err := results.Exec()
+		if err != nil {
+			_ = results.Close()
+			out.failed = i
+			out.err = fmt.Errorf("%s: %w", st.name, err)
+			return out
+		}
+		if _, rejected := out.rejected[i]; rejected || st.guard == nil || tag.RowsAffected() > 0 || isTainted(i) {
+			continue
+		}
+		if out.rejected == nil {
+			out.rejected = make(map[int]error)
+		}
+		out.rejected[i] = fmt.Errorf("order %s: %w", orders[i].order.OrderUID, st.guard)
+		for _, k := range orders[i].keys {
+			tainted[k] = true
+		}
+	}
+	if err := results.Close(); err != nil {
+		out.err = fmt.Errorf("close batch: %w", err)
+		return out
+	}
+	if len(out.rejected) > 0 {
+		return out
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		out.err = fmt.Errorf("commit: %w", err)
+	}
+	return out
+}
+
+// orderStatements строит запросы вставки или обновления заказа и связанных данных,
+// записи новой версии в историю и события в outbox, а если задан src — запись в журнал
+// обработанных сообщений.
+func orderStatements(o *models.Order, src *Source) ([]statement, error) {
+	builder := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
 
 	orderUUID, err := uuid.Parse(o.OrderUID)
 	if err != nil {
-		return fmt.Errorf("invalid UUID: %w", err)
+		return nil, fmt.Errorf("invalid UUID: %w", err)
 	}
 
 	// заказы
@@ -55,6 +240,7 @@ func (r *PostgresStorage) InsertOrder(ctx context.Context, o *models.Order) erro
 			"sm_id",
 			"date_created",
 			"oof_shard",
+			"updated_at",
 		).
 		Values(
 			orderUUID,
@@ -66,8 +252,10 @@ func (r *PostgresStorage) InsertOrder(ctx context.Context, o *models.Order) erro
 			o.DeliveryService,
 			o.ShardKey,
 			o.SmID,
-			o.DateCreated,
+			// колонка TIMESTAMP без зоны: pgx сохраняет локальное время как есть, поэтому приводим к UTC
+			o.DateCreated.UTC(),
 			o.OofShard,
+			o.Revision().UTC(),
 		).
 		Suffix(`ON CONFLICT (order_uid) DO UPDATE
         SET track_number = EXCLUDED.track_number,
@@ -79,14 +267,12 @@ func (r *PostgresStorage) InsertOrder(ctx context.Context, o *models.Order) erro
             shardkey = EXCLUDED.shardkey,
             sm_id = EXCLUDED.sm_id,
             date_created = EXCLUDED.date_created,
-            oof_shard = EXCLUDED.oof_shard`).
+            oof_shard = EXCLUDED.oof_shard,
+            updated_at = EXCLUDED.updated_at
+        WHERE orders.updated_at <= EXCLUDED.updated_at`).
 		ToSql()
 	if err != nil {
-		return fmt.Errorf("build orders insert: %w", err)
-	}
-	_, err = tx.Exec(ctx, orderSQL, orderArgs...)
-	if err != nil {
-		return fmt.Errorf("insert orders: %w", err)
+		return nil, fmt.Errorf("build orders insert: %w", err)
 	}
 
 	// доставка
@@ -108,11 +294,7 @@ func (r *PostgresStorage) InsertOrder(ctx context.Context, o *models.Order) erro
             region=EXCLUDED.region, email=EXCLUDED.email`).
 		ToSql()
 	if err != nil {
-		return fmt.Errorf("build delivery insert: %w", err)
-	}
-	_, err = tx.Exec(ctx, deliverySQL, deliveryArgs...)
-	if err != nil {
-		return fmt.Errorf("insert delivery: %w", err)
+		return nil, fmt.Errorf("build delivery insert: %w", err)
 	}
 
 	// оплата
@@ -151,11 +333,7 @@ func (r *PostgresStorage) InsertOrder(ctx context.Context, o *models.Order) erro
             goods_total=EXCLUDED.goods_total, custom_fee=EXCLUDED.custom_fee`).
 		ToSql()
 	if err != nil {
-		return fmt.Errorf("build payment insert: %w", err)
-	}
-	_, err = tx.Exec(ctx, paymentSQL, paymentArgs...)
-	if err != nil {
-		return fmt.Errorf("insert payment: %w", err)
+		return nil, fmt.Errorf("build payment insert: %w", err)
 	}
 
 	// товары
@@ -163,15 +341,32 @@ func (r *PostgresStorage) InsertOrder(ctx context.Context, o *models.Order) erro
 		Where(sq.Eq{"order_uid": orderUUID}).
 		ToSql()
 	if err != nil {
-		return fmt.Errorf("build delete items: %w", err)
+		return nil, fmt.Errorf("build delete items: %w", err)
 	}
-	_, err = tx.Exec(ctx, deleteSQL, deleteArgs...)
-	if err != nil {
-		return fmt.Errorf("delete items: %w", err)
+
+	var stmts []statement
+	// журнал сообщений идет первым: повторное сообщение отклоняется до записи заказа
+	if src != nil {
+		ledgerSQL, ledgerArgs, err := builder.Insert("processed_messages").
+			Columns("message_key", "order_uid").
+			Values(src.messageKey(), orderUUID).
+			Suffix("ON CONFLICT (message_key) DO NOTHING").
+			ToSql()
+		if err != nil {
+			return nil, fmt.Errorf("build processed message insert: %w", err)
+		}
+		stmts = append(stmts, statement{name: "insert processed message", sql: ledgerSQL, args: ledgerArgs, guard: ErrDuplicate})
 	}
 
-	for _, it := range o.Items {
-		itemSQL, itemArgs, err := builder.Insert("items").
+	stmts = append(stmts, []statement{
+		{name: "insert orders", sql: orderSQL, args: orderArgs, guard: ErrStale},
+		{name: "insert delivery", sql: deliverySQL, args: deliveryArgs},
+		{name: "insert payment", sql: paymentSQL, args: paymentArgs},
+		{name: "delete items", sql: deleteSQL, args: deleteArgs},
+	}...)
+
+	if len(o.Items) > 0 {
+		itemsInsert := builder.Insert("items").
 			Columns(
 				"order_uid",
 				"chrt_id",
@@ -185,8 +380,9 @@ func (r *PostgresStorage) InsertOrder(ctx context.Context, o *models.Order) erro
 				"nm_id",
 				"brand",
 				"status",
-			).
-			Values(
+			)
+		for _, it := range o.Items {
+			itemsInsert = itemsInsert.Values(
 				orderUUID,
 				it.ChrtID,
 				it.TrackNumber,
@@ -199,174 +395,507 @@ func (r *PostgresStorage) InsertOrder(ctx context.Context, o *models.Order) erro
 				it.NmID,
 				it.Brand,
 				it.Status,
-			).
-			ToSql()
-		if err != nil {
-			return fmt.Errorf("build insert item: %w", err)
+			)
 		}
-		_, err = tx.Exec(ctx, itemSQL, itemArgs...)
+		itemsSQL, itemsArgs, err := itemsInsert.ToSql()
 		if err != nil {
-			return fmt.Errorf("insert item: %w", err)
+			return nil, fmt.Errorf("build insert items: %w", err)
 		}
+		stmts = append(stmts, statement{name: "insert items", sql: itemsSQL, args: itemsArgs})
 	}
 
-	// фиксация транзакции
-	if err := tx.Commit(ctx); err != nil {
-		return fmt.Errorf("commit: %w", err)
+	// история: номер версии считается после upsert заказа, который блокирует строку orders
+	payload, checksum, err := encodeVersion(o)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	versionSQL, versionArgs, err := orderVersionInsert(orderUUID, payload, checksum, src)
+	if err != nil {
+		return nil, err
+	}
+	stmts = append(stmts, statement{name: "insert order version", sql: versionSQL, args: versionArgs})
+
+	// событие для outbox пишется последним, когда номер новой версии уже известен
+	outboxSQL, outboxArgs, err := orderOutboxInsert(orderUUID, payload)
+	if err != nil {
+		return nil, err
+	}
+	stmts = append(stmts, statement{name: "insert outbox event", sql: outboxSQL, args: outboxArgs})
+
+	return stmts, nil
+}
+
+// orderVersionInsert строит запрос записи следующей версии заказа в order_versions.
+func orderVersionInsert(orderUUID uuid.UUID, payload []byte, checksum string, src *Source) (string, []any, error) {
+	var topic, partition, offset, idempotencyKey any
+	if src != nil {
+		partition, offset = src.Partition, src.Offset
+		if src.Topic != "" {
+			topic = src.Topic
+		}
+		if src.IdempotencyKey != "" {
+			idempotencyKey = src.IdempotencyKey
+		}
+	}
+
+	next := sq.Select().
+		Column(sq.Expr("?::uuid", orderUUID)).
+		Column("COALESCE(MAX(version), 0) + 1").
+		Column(sq.Expr("?::jsonb", string(payload))).
+		Column(sq.Expr("?", checksum)).
+		Column(sq.Expr("?::text", topic)).
+		Column(sq.Expr("?::integer", partition)).
+		Column(sq.Expr("?::bigint", offset)).
+		Column(sq.Expr("?::text", idempotencyKey)).
+		From("order_versions").
+		Where(sq.Eq{"order_uid": orderUUID})
+
+	versionSQL, versionArgs, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Insert("order_versions").
+		Columns("order_uid", "version", "payload", "checksum", "source_topic", "source_partition", "source_offset", "source_idempotency_key").
+		Select(next).
+		ToSql()
+	if err != nil {
+		return "", nil, fmt.Errorf("build order version insert: %w", err)
+	}
+	return versionSQL, versionArgs, nil
 }
 
-// GetOrderByID загружает заказ по ID.
-func (r *PostgresStorage) GetOrderByID(ctx context.Context, orderUID string) (*models.Order, error) {
+// orderOutboxInsert строит запрос добавления события о последней версии заказа в outbox.
+func orderOutboxInsert(orderUUID uuid.UUID, payload []byte) (string, []any, error) {
+	event := sq.Select().
+		Column(sq.Expr("CASE WHEN MAX(version) = 1 THEN ? ELSE ? END", EventOrderCreated, EventOrderUpdated)).
+		Column(sq.Expr("?::uuid", orderUUID)).
+		Column("MAX(version)").
+		Column(sq.Expr("?::jsonb", string(payload))).
+		From("order_versions").
+		Where(sq.Eq{"order_uid": orderUUID})
+
+	outboxSQL, outboxArgs, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Insert("outbox").
+		Columns("event_type", "order_uid", "version", "payload").
+		Select(event).
+		ToSql()
+	if err != nil {
+		return "", nil, fmt.Errorf("build outbox insert: %w", err)
+	}
+	return outboxSQL, outboxArgs, nil
+}
+
+// PublishOutbox забирает неопубликованные события с блокировкой FOR UPDATE SKIP LOCKED
+// и удаляет их в той же транзакции после успешного publish. Строки, заблокированные
+// другим процессом, пропускаются, поэтому несколько реплик могут публиковать события одновременно.
+func (r *PostgresStorage) PublishOutbox(ctx context.Context, limit int, publish func(ctx context.Context, events []OutboxEvent) error) (_ int, err error) {
+	defer func() { err = classifyPgError(err) }()
+
 	builder := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
-	o := &models.Order{}
-	orderSQL, orderArgs, err := builder.Select(
-		"order_uid",
-		"track_number",
-		"entry",
-		"locale",
-		"internal_signature",
-		"customer_id",
-		"delivery_service",
-		"shardkey",
-		"sm_id",
-		"date_created",
-		"oof_shard",
-	).
-		From("orders").
-		Where(sq.Eq{"order_uid": orderUID}).
+	claimSQL, claimArgs, err := builder.
+		Select("id", "event_type", "order_uid", "version", "created_at", "payload").
+		From("outbox").
+		OrderBy("id").
+		Limit(uint64(max(limit, 1))).
+		Suffix("FOR UPDATE SKIP LOCKED").
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("build claim outbox: %w", err)
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+	defer rollback(ctx, tx)
+
+	rows, err := tx.Query(withStatement(ctx, "claim outbox"), claimSQL, claimArgs...)
+	if err != nil {
+		return 0, fmt.Errorf("claim outbox: %w", err)
+	}
+	var events []OutboxEvent
+	var ids []int64
+	for rows.Next() {
+		var e OutboxEvent
+		var orderUUID uuid.UUID
+		var payload []byte
+		if err := rows.Scan(&e.ID, &e.Type, &orderUUID, &e.Version, &e.CreatedAt, &payload); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("scan outbox event: %w", err)
+		}
+		e.OrderUID = orderUUID.String()
+		e.Order = payload
+		events = append(events, e)
+		ids = append(ids, e.ID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("claim outbox rows: %w", err)
+	}
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	if err := publish(ctx, events); err != nil {
+		return 0, err
+	}
+
+	deleteSQL, deleteArgs, err := builder.Delete("outbox").Where(sq.Eq{"id": ids}).ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("build delete outbox: %w", err)
+	}
+	if _, err := tx.Exec(withStatement(ctx, "delete outbox events"), deleteSQL, deleteArgs...); err != nil {
+		return 0, fmt.Errorf("delete outbox events: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return len(events), nil
+}
+
+// rollback откатывает транзакцию, если она не была зафиксирована.
+func rollback(ctx context.Context, tx pgx.Tx) {
+	if err := tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+		slog.ErrorContext(ctx, "rollback failed", logging.Err(err))
+	}
+}
+
+// iterateFetchSize — число строк, которое IterateOrders читает из курсора за раз.
+const iterateFetchSize = 500
+
+// GetOrderByID загружает заказ по ID одним запросом.
+func (r *PostgresStorage) GetOrderByID(ctx context.Context, orderUID string) (_ *models.Order, err error) {
+	defer func() { err = classifyPgError(err) }()
+
+	orderSQL, orderArgs, err := orderSelect().
+		Where(sq.Eq{"o.order_uid": orderUID}).
 		ToSql()
 	if err != nil {
 		return nil, fmt.Errorf("build get order: %w", err)
 	}
-	row := r.pool.QueryRow(ctx, orderSQL, orderArgs...)
-	if err := row.Scan(&o.OrderUID, &o.TrackNumber, &o.Entry, &o.Locale, &o.InternalSignature,
-		&o.CustomerID, &o.DeliveryService, &o.ShardKey, &o.SmID, &o.DateCreated, &o.OofShard); err != nil {
+	o, err := scanOrder(r.pool.QueryRow(withStatement(ctx, "get order"), orderSQL, orderArgs...))
+	if err != nil {
 		return nil, fmt.Errorf("get order: %w", err)
 	}
+	return o, nil
+}
 
-	deliverySQL, deliveryArgs, err := builder.Select(
-		"name",
-		"phone",
-		"zip",
-		"city",
-		"address",
-		"region",
-		"email",
-	).
-		From("deliveries").
-		Where(sq.Eq{"order_uid": orderUID}).
+// IterateOrders передает в fn последние limit заказов по date_created
+// в порядке от старых к новым (limit <= 0 — все заказы).
+// Заказы читаются серверным курсором порциями, без загрузки всей выборки в память.
+// Ошибка fn прерывает обход и возвращается вызывающему.
+func (r *PostgresStorage) IterateOrders(ctx context.Context, limit int, fn func(*models.Order) error) (err error) {
+	defer func() { err = classifyPgError(err) }()
+
+	builder := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	recent := orderSelect().OrderBy("o.date_created DESC", "o.order_uid DESC")
+	if limit > 0 {
+		recent = recent.Limit(uint64(limit))
+	}
+	iterSQL, iterArgs, err := builder.Select("*").
+		FromSelect(recent, "recent").
+		OrderBy("date_created", "order_uid").
 		ToSql()
 	if err != nil {
-		return nil, fmt.Errorf("build get delivery: %w", err)
-	}
-	row = r.pool.QueryRow(ctx, deliverySQL, deliveryArgs...)
-	if err := row.Scan(&o.Delivery.Name, &o.Delivery.Phone, &o.Delivery.Zip,
-		&o.Delivery.City, &o.Delivery.Address, &o.Delivery.Region, &o.Delivery.Email); err != nil {
-		return nil, fmt.Errorf("get delivery: %w", err)
-	}
-
-	paymentSQL, paymentArgs, err := builder.Select(
-		"transaction",
-		"request_id",
-		"currency",
-		"provider",
-		"amount",
-		"payment_dt",
-		"bank",
-		"delivery_cost",
-		"goods_total",
-		"custom_fee",
-	).
-		From("payments").
-		Where(sq.Eq{"order_uid": orderUID}).
-		ToSql()
+		return fmt.Errorf("build iterate orders: %w", err)
+	}
+
+	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
 	if err != nil {
-		return nil, fmt.Errorf("build get payment: %w", err)
+		return fmt.Errorf("begin tx: %w", err)
 	}
-	row = r.pool.QueryRow(ctx, paymentSQL, paymentArgs...)
-	if err := row.Scan(&o.Payment.Transaction, &o.Payment.RequestID, &o.Payment.Currency,
-		&o.Payment.Provider, &o.Payment.Amount, &o.Payment.PaymentDt, &o.Payment.Bank,
-		&o.Payment.DeliveryCost, &o.Payment.GoodsTotal, &o.Payment.CustomFee); err != nil {
-		return nil, fmt.Errorf("get payment: %w", err)
-	}
-
-	itemsSQL, itemsArgs, err := builder.Select(
-		"chrt_id",
-		"track_number",
-		"price",
-		"rid",
-		"name",
-		"sale",
-		"size",
-		"total_price",
-		"nm_id",
-		"brand",
-		"status",
-	).
-		From("items").
-		Where(sq.Eq{"order_uid": orderUID}).
-		ToSql()
+	defer rollback(ctx, tx)
+
+	// Служебные команды курсора выполняются простым протоколом, чтобы не кешировать их как prepared statements
+	declareArgs := append([]any{pgx.QueryExecModeSimpleProtocol}, iterArgs...)
+	if _, err := tx.Exec(withStatement(ctx, "declare orders cursor"), "DECLARE orders_iter NO SCROLL CURSOR FOR "+iterSQL, declareArgs...); err != nil {
+		return fmt.Errorf("declare orders cursor: %w", err)
+	}
+
+	fetchSQL := fmt.Sprintf("FETCH %d FROM orders_iter", iterateFetchSize)
+	for {
+		rows, err := tx.Query(withStatement(ctx, "fetch orders"), fetchSQL, pgx.QueryExecModeSimpleProtocol)
+		if err != nil {
+			return fmt.Errorf("fetch orders: %w", err)
+		}
+		fetched := 0
+		for rows.Next() {
+			o, err := scanOrder(rows)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("scan order: %w", err)
+			}
+			fetched++
+			if err := fn(o); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("fetch orders rows: %w", err)
+		}
+		if fetched < iterateFetchSize {
+			return nil
+		}
+	}
+}
+
+// ListOrders возвращает страницу заказов от новых к старым по ключу (date_created, order_uid).
+// Следующая страница запрашивается с курсором из OrderPage.NextCursor.
+func (r *PostgresStorage) ListOrders(ctx context.Context, filter OrderFilter) (_ *OrderPage, err error) {
+	defer func() { err = classifyPgError(err) }()
+
+	limit := filter.PageLimit()
+	query := orderSelect().
+		OrderBy("o.date_created DESC", "o.order_uid DESC").
+		Limit(uint64(limit + 1))
+
+	// Порядок условий фиксирован, чтобы текст запроса не менялся и кешировался pgx
+	for _, cond := range []struct{ column, value string }{
+		{"o.customer_id", filter.CustomerID},
+		{"o.track_number", filter.TrackNumber},
+		{"o.delivery_service", filter.DeliveryService},
+		{"o.entry", filter.Entry},
+		{"o.locale", filter.Locale},
+		{"p.currency", filter.Currency},
+	} {
+		if cond.value != "" {
+			query = query.Where(sq.Eq{cond.column: cond.value})
+		}
+	}
+	if !filter.CreatedFrom.IsZero() {
+		query = query.Where(sq.GtOrEq{"o.date_created": filter.CreatedFrom.UTC()})
+	}
+	if !filter.CreatedTo.IsZero() {
+		query = query.Where(sq.Lt{"o.date_created": filter.CreatedTo.UTC()})
+	}
+	if filter.Cursor != "" {
+		cursor, err := DecodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("(o.date_created, o.order_uid) < (?, ?)", cursor.DateCreated, cursor.OrderUID)
+	}
+
+	listSQL, listArgs, err := query.ToSql()
 	if err != nil {
-		return nil, fmt.Errorf("build get items: %w", err)
+		return nil, fmt.Errorf("build list orders: %w", err)
 	}
-	rows, err := r.pool.Query(ctx, itemsSQL, itemsArgs...)
+
+	rows, err := r.pool.Query(withStatement(ctx, "list orders"), listSQL, listArgs...)
 	if err != nil {
-		return nil, fmt.Errorf("get items: %w", err)
+		return nil, fmt.Errorf("list orders: %w", err)
 	}
 	defer rows.Close()
 
+	page := &OrderPage{Orders: make([]models.Order, 0, limit)}
 	for rows.Next() {
-		var it models.Item
-		if err := rows.Scan(&it.ChrtID, &it.TrackNumber, &it.Price, &it.Rid, &it.Name,
-			&it.Sale, &it.Size, &it.TotalPrice, &it.NmID, &it.Brand, &it.Status); err != nil {
-			return nil, fmt.Errorf("scan item: %w", err)
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan order: %w", err)
 		}
-		o.Items = append(o.Items, it)
+		page.Orders = append(page.Orders, *o)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("scan items rows: %w", err)
+		return nil, fmt.Errorf("list orders rows: %w", err)
 	}
 
-	return o, nil
+	if len(page.Orders) > limit {
+		page.Orders = page.Orders[:limit]
+		page.NextCursor = EncodeCursor(&page.Orders[limit-1])
+	}
+	return page, nil
 }
 
-// GetAllOrders загружает все заказы.
-func (r *PostgresStorage) GetAllOrders(ctx context.Context) ([]models.Order, error) {
-	builder := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
-	var orders []models.Order
+// ListOrderVersions возвращает историю версий заказа по возрастанию номера.
+// Если версий нет, возвращается ErrNotFound.
+func (r *PostgresStorage) ListOrderVersions(ctx context.Context, orderUID string) (_ []OrderVersion, err error) {
+	defer func() { err = classifyPgError(err) }()
 
-	allSQL, allArgs, err := builder.Select("order_uid").From("orders").ToSql()
+	listSQL, listArgs, err := versionSelect().
+		Where(sq.Eq{"order_uid": orderUID}).
+		OrderBy("version").
+		ToSql()
 	if err != nil {
-		return nil, fmt.Errorf("build query all orders: %w", err)
+		return nil, fmt.Errorf("build list order versions: %w", err)
 	}
-	rows, err := r.pool.Query(ctx, allSQL, allArgs...)
+
+	rows, err := r.pool.Query(withStatement(ctx, "list order versions"), listSQL, listArgs...)
 	if err != nil {
-		return nil, fmt.Errorf("query all orders: %w", err)
+		return nil, fmt.Errorf("list order versions: %w", err)
 	}
 	defer rows.Close()
 
-	var orderUIDs []string
+	var versions []OrderVersion
 	for rows.Next() {
-		var orderUID string
-		if err := rows.Scan(&orderUID); err != nil {
-			return nil, fmt.Errorf("scan order_uid: %w", err)
+		v, err := scanVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan order version: %w", err)
 		}
-		orderUIDs = append(orderUIDs, orderUID)
+		versions = append(versions, *v)
 	}
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("scan order_uid rows: %w", err)
+		return nil, fmt.Errorf("list order versions rows: %w", err)
 	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("list order versions %s: %w", orderUID, ErrNotFound)
+	}
+	return versions, nil
+}
 
-	for _, uid := range orderUIDs {
-		order, err := r.GetOrderByID(ctx, uid)
-		if err != nil {
-			log.Printf("Warning: failed to load order %s: %v", uid, err)
-			continue
+// GetOrderVersion возвращает версию заказа по номеру.
+func (r *PostgresStorage) GetOrderVersion(ctx context.Context, orderUID string, version int) (_ *OrderVersion, err error) {
+	defer func() { err = classifyPgError(err) }()
+
+	getSQL, getArgs, err := versionSelect().
+		Where(sq.Eq{"order_uid": orderUID, "version": version}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build get order version: %w", err)
+	}
+	v, err := scanVersion(r.pool.QueryRow(withStatement(ctx, "get order version"), getSQL, getArgs...))
+	if err != nil {
+		return nil, fmt.Errorf("get order version: %w", err)
+	}
+	return v, nil
+}
+
+// versionSelect строит запрос версий заказа из order_versions.
+func versionSelect() sq.SelectBuilder {
+	return sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Select(
+			"order_uid",
+			"version",
+			"checksum",
+			"source_topic",
+			"source_partition",
+			"source_offset",
+			"source_idempotency_key",
+			"created_at",
+			"payload",
+		).
+		From("order_versions")
+}
+
+// scanVersion читает строку, построенную versionSelect.
+func scanVersion(row pgx.Row) (*OrderVersion, error) {
+	v := &OrderVersion{}
+	var (
+		topic          *string
+		partition      *int
+		offset         *int64
+		idempotencyKey *string
+		payload        []byte
+	)
+	if err := row.Scan(&v.OrderUID, &v.Version, &v.Checksum, &topic, &partition, &offset, &idempotencyKey, &v.CreatedAt, &payload); err != nil {
+		return nil, err
+	}
+	if partition != nil && offset != nil {
+		v.Source = &Source{Partition: *partition, Offset: *offset}
+		if topic != nil {
+			v.Source.Topic = *topic
+		}
+		if idempotencyKey != nil {
+			v.Source.IdempotencyKey = *idempotencyKey
 		}
-		orders = append(orders, *order)
 	}
+	if err := json.Unmarshal(payload, &v.Order); err != nil {
+		return nil, fmt.Errorf("decode order version: %w", err)
+	}
+	return v, nil
+}
 
-	return orders, nil
+// PruneProcessedMessages удаляет записи журнала обработанных сообщений старше before.
+func (r *PostgresStorage) PruneProcessedMessages(ctx context.Context, before time.Time) (_ int64, err error) {
+	defer func() { err = classifyPgError(err) }()
+
+	pruneSQL, pruneArgs, err := sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Delete("processed_messages").
+		Where(sq.Lt{"processed_at": before}).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("build prune processed messages: %w", err)
+	}
+	tag, err := r.pool.Exec(withStatement(ctx, "prune processed messages"), pruneSQL, pruneArgs...)
+	if err != nil {
+		return 0, fmt.Errorf("prune processed messages: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// orderSelect строит запрос заказа вместе с доставкой, оплатой и товарами.
+// Товары агрегируются в JSON-массив, поэтому один заказ — одна строка.
+func orderSelect() sq.SelectBuilder {
+	return sq.StatementBuilder.PlaceholderFormat(sq.Dollar).
+		Select(
+			"o.order_uid",
+			"o.track_number",
+			"o.entry",
+			"o.locale",
+			"o.internal_signature",
+			"o.customer_id",
+			"o.delivery_service",
+			"o.shardkey",
+			"o.sm_id",
+			"o.date_created",
+			"o.oof_shard",
+			"o.updated_at",
+			"d.name",
+			"d.phone",
+			"d.zip",
+			"d.city",
+			"d.address",
+			"d.region",
+			"d.email",
+			"p.transaction",
+			"p.request_id",
+			"p.currency",
+			"p.provider",
+			"p.amount",
+			"p.payment_dt",
+			"p.bank",
+			"p.delivery_cost",
+			"p.goods_total",
+			"p.custom_fee",
+			`COALESCE((
+            SELECT json_agg(json_build_object(
+                'chrt_id', i.chrt_id,
+                'track_number', i.track_number,
+                'price', i.price,
+                'rid', i.rid,
+                'name', i.name,
+                'sale', i.sale,
+                'size', i.size,
+                'total_price', i.total_price,
+                'nm_id', i.nm_id,
+                'brand', i.brand,
+                'status', i.status
+            ) ORDER BY i.id)
+            FROM items i
+            WHERE i.order_uid = o.order_uid
+        ), '[]'::json) AS items`,
+		).
+		From("orders o").
+		Join("deliveries d ON d.order_uid = o.order_uid").
+		Join("payments p ON p.order_uid = o.order_uid")
+}
+
+// scanOrder читает строку, построенную orderSelect.
+func scanOrder(row pgx.Row) (*models.Order, error) {
+	o := &models.Order{}
+	var items []byte
+	if err := row.Scan(
+		&o.OrderUID, &o.TrackNumber, &o.Entry, &o.Locale, &o.InternalSignature,
+		&o.CustomerID, &o.DeliveryService, &o.ShardKey, &o.SmID, &o.DateCreated, &o.OofShard, &o.UpdatedAt,
+		&o.Delivery.Name, &o.Delivery.Phone, &o.Delivery.Zip, &o.Delivery.City,
+		&o.Delivery.Address, &o.Delivery.Region, &o.Delivery.Email,
+		&o.Payment.Transaction, &o.Payment.RequestID, &o.Payment.Currency,
+		&o.Payment.Provider, &o.Payment.Amount, &o.Payment.PaymentDt, &o.Payment.Bank,
+		&o.Payment.DeliveryCost, &o.Payment.GoodsTotal, &o.Payment.CustomFee,
+		&items,
+	); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(items, &o.Items); err != nil {
+		return nil, fmt.Errorf("decode items: %w", err)
+	}
+	return o, nil
 }
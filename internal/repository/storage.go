@@ -10,6 +10,9 @@ import (
 	"github.com/RoGogDBD/wb/internal/models"
 )
 
+// errCacheMiss возвращается, если заказа нет в кеше или запись протухла.
+var errCacheMiss = fmt.Errorf("order %w in cache", ErrNotFound)
+
 type (
 	// MemStorage — LRU-кеш в памяти с опциональным TTL.
 	MemStorage struct {
@@ -18,6 +21,13 @@ type (
 		mu       sync.RWMutex
 		maxItems int
 		ttl      time.Duration
+		metrics  cacheMetrics
+
+		// closeOnce защищает отмену регистрации метрик. Close не берет mu: callback
+		// метрик вызывает Len под блокировкой конвейера OpenTelemetry, а Unregister
+		// ждет ту же блокировку.
+		closeOnce sync.Once
+		closeErr  error
 	}
 
 	cacheEntry struct {
@@ -28,19 +38,22 @@ type (
 )
 
 // NewMemStorageWithConfig создает MemStorage с лимитами и TTL.
+// Попадания, промахи, вытеснения и размер кеша учитываются в метриках OpenTelemetry.
 func NewMemStorageWithConfig(maxItems int, ttl time.Duration) *MemStorage {
 	if maxItems <= 0 {
 		maxItems = 10000
 	}
-	return &MemStorage{
+	s := &MemStorage{
 		orders:   make(map[string]*list.Element),
 		lruList:  list.New(),
 		maxItems: maxItems,
 		ttl:      ttl,
 	}
+	s.metrics = newCacheMetrics(s)
+	return s
 }
 
-// Save сохраняет заказ в кеш.
+// Save сохраняет заказ в кеш. Версия старше закешированной (по Order.Revision) игнорируется.
 func (s *MemStorage) Save(order *models.Order) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -52,6 +65,10 @@ func (s *MemStorage) Save(order *models.Order) {
 	if elem, exists := s.orders[order.OrderUID]; exists {
 		s.lruList.MoveToFront(elem)
 		entry := elem.Value.(*cacheEntry)
+		// кеш не откатывается к более старой версии заказа
+		if entry.order.Revision().After(order.Revision()) {
+			return
+		}
 		entry.order = order
 		if s.ttl > 0 {
 			entry.expiresAt = time.Now().Add(s.ttl)
@@ -79,20 +96,25 @@ func (s *MemStorage) GetByID(orderUID string) (*models.Order, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	ctx := context.Background()
 	elem, exists := s.orders[orderUID]
 	if !exists {
-		return nil, fmt.Errorf("order not found in cache")
+		s.metrics.misses.Add(ctx, 1)
+		return nil, errCacheMiss
 	}
 
 	entry := elem.Value.(*cacheEntry)
 	if s.ttl > 0 && time.Now().After(entry.expiresAt) {
 		s.lruList.Remove(elem)
 		delete(s.orders, entry.key)
-		return nil, fmt.Errorf("order not found in cache")
+		s.metrics.expirations.Add(ctx, 1)
+		s.metrics.misses.Add(ctx, 1)
+		return nil, errCacheMiss
 	}
 
 	// Перемещаем в начало (использован недавно)
 	s.lruList.MoveToFront(elem)
+	s.metrics.hits.Add(ctx, 1)
 	return entry.order, nil
 }
 
@@ -102,6 +124,7 @@ func (s *MemStorage) evictOldest() {
 		s.lruList.Remove(elem)
 		entry := elem.Value.(*cacheEntry)
 		delete(s.orders, entry.key)
+		s.metrics.evictions.Add(context.Background(), 1)
 	}
 }
 
@@ -113,6 +136,7 @@ func (s *MemStorage) Len() int {
 }
 
 // PurgeExpired удаляет протухшие записи и возвращает количество.
+// Длительность очистки учитывается в метрике cache.purge.duration.
 func (s *MemStorage) PurgeExpired() int {
 	if s.ttl <= 0 {
 		return 0
@@ -122,7 +146,9 @@ func (s *MemStorage) PurgeExpired() int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.purgeExpiredLocked(now)
+	purged := s.purgeExpiredLocked(now)
+	s.metrics.purgeDuration.Record(context.Background(), time.Since(now).Seconds())
+	return purged
 }
 
 // StartJanitor запускает фоновую очистку.
@@ -145,6 +171,13 @@ func (s *MemStorage) StartJanitor(ctx context.Context, interval time.Duration) {
 	}()
 }
 
+// Close отменяет наблюдение за размером кеша в метриках; после него кеш перестает
+// попадать в cache.size и может быть собран сборщиком мусора. Кешем можно пользоваться и дальше.
+func (s *MemStorage) Close() error {
+	s.closeOnce.Do(func() { s.closeErr = s.metrics.unregister() })
+	return s.closeErr
+}
+
 // Clear удаляет все записи из кеша.
 func (s *MemStorage) Clear() {
 	s.mu.Lock()
@@ -165,5 +198,8 @@ func (s *MemStorage) purgeExpiredLocked(now time.Time) int {
 		}
 		elem = prev
 	}
+	if purged > 0 {
+		s.metrics.expirations.Add(context.Background(), int64(purged))
+	}
 	return purged
 }
@@ -1,11 +1,18 @@
 package repository
 
 import (
+	"context"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/RoGogDBD/wb/internal/models"
 	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 )
 
 func TestMemStorage(t *testing.T) {
@@ -32,6 +39,7 @@ func TestMemStorage(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			storage := NewMemStorageWithConfig(10, tt.ttl)
+			t.Cleanup(func() { _ = storage.Close() })
 			order := testOrder()
 
 			storage.Save(order)
@@ -50,6 +58,44 @@ func TestMemStorage(t *testing.T) {
 	}
 }
 
+func TestMemStorageKeepsNewestRevision(t *testing.T) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		saved     time.Time
+		incoming  time.Time
+		wantTrack string
+	}{
+		{name: "newer replaces", saved: base, incoming: base.Add(time.Minute), wantTrack: "incoming"},
+		{name: "same revision replaces", saved: base, incoming: base, wantTrack: "incoming"},
+		{name: "older ignored", saved: base.Add(time.Minute), incoming: base, wantTrack: "saved"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := NewMemStorageWithConfig(10, 0)
+			t.Cleanup(func() { _ = storage.Close() })
+			saved := testOrder()
+			saved.TrackNumber = "saved"
+			saved.UpdatedAt = tt.saved
+			storage.Save(saved)
+
+			incoming := *saved
+			incoming.TrackNumber = "incoming"
+			incoming.UpdatedAt = tt.incoming
+			storage.Save(&incoming)
+
+			got, err := storage.GetByID(saved.OrderUID)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got.TrackNumber != tt.wantTrack {
+				t.Fatalf("expected %s version, got %s", tt.wantTrack, got.TrackNumber)
+			}
+		})
+	}
+}
+
 func testOrder() *models.Order {
 	id := uuid.New().String()
 	return &models.Order{
@@ -100,3 +146,133 @@ func testOrder() *models.Order {
 		OofShard:        "1",
 	}
 }
+
+func TestMemStorageMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(noop.NewMeterProvider()) })
+
+	storage := NewMemStorageWithConfig(2, 100*time.Millisecond)
+	evicted, kept := testOrder(), testOrder()
+	storage.Save(evicted)
+	storage.Save(kept)
+	storage.Save(testOrder())
+
+	if _, err := storage.GetByID(kept.OrderUID); err != nil {
+		t.Fatalf("expected cache hit, got %v", err)
+	}
+	if _, err := storage.GetByID(evicted.OrderUID); err == nil {
+		t.Fatal("expected evicted order to miss")
+	}
+
+	got := collectInt64(t, reader)
+	want := map[string]int64{"cache.hits": 1, "cache.misses": 1, "cache.evictions": 1, "cache.size": 2, "cache.max_items": 2}
+	for name, v := range want {
+		if got[name] != v {
+			t.Errorf("%s: expected %d, got %d", name, v, got[name])
+		}
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if purged := storage.PurgeExpired(); purged != 2 {
+		t.Fatalf("expected 2 purged entries, got %d", purged)
+	}
+	got = collectInt64(t, reader)
+	if got["cache.expirations"] != 2 || got["cache.size"] != 0 || got["cache.purge.duration"] != 1 {
+		t.Fatalf("expected 2 expirations, empty cache and 1 purge, got %v", got)
+	}
+
+	if err := storage.Close(); err != nil {
+		t.Fatalf("unexpected close error: %v", err)
+	}
+	got = collectInt64(t, reader)
+	if _, ok := got["cache.size"]; ok {
+		t.Fatalf("expected closed cache to stop reporting its size, got %v", got)
+	}
+}
+
+func TestMemStorageCloseDuringCollect(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	t.Cleanup(func() { otel.SetMeterProvider(noop.NewMeterProvider()) })
+
+	// callback, зарегистрированный раньше кеша, задерживает сбор, чтобы Close начался,
+	// пока сбор держит блокировку конвейера и еще не дошел до размера кеша
+	meter := otel.Meter("test")
+	gauge, err := meter.Int64ObservableGauge("test.gauge")
+	if err != nil {
+		t.Fatalf("create gauge: %v", err)
+	}
+	collecting, release := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	reg, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		once.Do(func() { close(collecting) })
+		<-release
+		o.ObserveInt64(gauge, 1)
+		return nil
+	}, gauge)
+	if err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	storage := NewMemStorageWithConfig(10, 0)
+	storage.Save(testOrder())
+
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+		var rm metricdata.ResourceMetrics
+		_ = reader.Collect(context.Background(), &rm)
+	}()
+	<-collecting
+	closed := make(chan error, 1)
+	go func() { closed <- storage.Close() }()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Fatalf("unexpected close error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close deadlocked with a concurrent collect")
+	}
+	select {
+	case <-collected:
+	case <-time.After(5 * time.Second):
+		t.Fatal("collect deadlocked with a concurrent Close")
+	}
+	if err := reg.Unregister(); err != nil {
+		t.Fatalf("unregister callback: %v", err)
+	}
+}
+
+// collectInt64 собирает значения целочисленных метрик по именам; для гистограмм возвращается число измерений.
+func collectInt64(t *testing.T, reader sdkmetric.Reader) map[string]int64 {
+	t.Helper()
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("collect metrics: %v", err)
+	}
+	values := make(map[string]int64)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, dp := range data.DataPoints {
+					values[m.Name] += dp.Value
+				}
+			case metricdata.Gauge[int64]:
+				for _, dp := range data.DataPoints {
+					values[m.Name] = dp.Value
+				}
+			case metricdata.Histogram[float64]:
+				for _, dp := range data.DataPoints {
+					values[m.Name] += int64(dp.Count)
+				}
+			}
+		}
+	}
+	return values
+}
@@ -0,0 +1,54 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/RoGogDBD/wb/internal/logging"
+)
+
+// exportErrorWindow — сколько после ошибки экспорта проверка телеметрии считается проваленной.
+const exportErrorWindow = time.Minute
+
+// errorRecorder — обработчик ошибок OpenTelemetry: пишет их в лог и запоминает последнюю.
+type errorRecorder struct {
+	mu  sync.Mutex
+	err error
+	at  time.Time
+}
+
+// Handle реализует otel.ErrorHandler.
+func (r *errorRecorder) Handle(err error) {
+	slog.Error("telemetry error", logging.Err(err))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.err, r.at = err, time.Now()
+}
+
+func (r *errorRecorder) last() (error, time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.err, r.at
+}
+
+// Check проверяет экспортеры телеметрии: Prometheus-метрики собираются без ошибок,
+// и за последнюю минуту OpenTelemetry не сообщал об ошибках (например, недоступен OTLP-коллектор).
+func (p *Providers) Check(_ context.Context) error {
+	if p == nil {
+		return nil
+	}
+	if p.gatherer != nil {
+		if _, err := p.gatherer.Gather(); err != nil {
+			return fmt.Errorf("gather metrics: %w", err)
+		}
+	}
+	if p.errors != nil {
+		if err, at := p.errors.last(); err != nil && time.Since(at) < exportErrorWindow {
+			return fmt.Errorf("export failed %s ago: %w", time.Since(at).Round(time.Second), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package telemetry
+
+import (
+	"log/slog"
+
+	"github.com/RoGogDBD/wb/internal/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+// Int64Counter создает счетчик в глобальном MeterProvider для инструментирования scope.
+// При ошибке создания возвращается счетчик, ничего не записывающий.
+func Int64Counter(scope, name, description, unit string) metric.Int64Counter {
+	counter, err := otel.Meter(scope).Int64Counter(
+		name,
+		metric.WithDescription(description),
+		metric.WithUnit(unit),
+	)
+	if err != nil {
+		slog.Error("counter init error", "metric", name, logging.Err(err))
+		return noop.Int64Counter{}
+	}
+	return counter
+}
+
+// Float64Histogram создает гистограмму в глобальном MeterProvider для инструментирования scope.
+// При ошибке создания возвращается гистограмма, ничего не записывающая.
+func Float64Histogram(scope, name, description, unit string) metric.Float64Histogram {
+	histogram, err := otel.Meter(scope).Float64Histogram(
+		name,
+		metric.WithDescription(description),
+		metric.WithUnit(unit),
+	)
+	if err != nil {
+		slog.Error("histogram init error", "metric", name, logging.Err(err))
+		return noop.Float64Histogram{}
+	}
+	return histogram
+}
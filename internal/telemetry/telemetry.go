@@ -23,6 +23,8 @@ import (
 type Providers struct {
 	MetricsHandler http.Handler
 	shutdown       func(context.Context) error
+	gatherer       prom.Gatherer
+	errors         *errorRecorder
 }
 
 // Shutdown корректно завершает все провайдеры.
@@ -52,6 +54,9 @@ func Init(ctx context.Context, cfg config.TelemetryConfig) (*Providers, error) {
 
 	var shutdowns []func(context.Context) error
 	var metricsHandler http.Handler
+	var gatherer prom.Gatherer
+	errs := &errorRecorder{}
+	otel.SetErrorHandler(errs)
 
 	if cfg.TracesEnabled {
 		options := []otlptracehttp.Option{
@@ -86,6 +91,7 @@ func Init(ctx context.Context, cfg config.TelemetryConfig) (*Providers, error) {
 		)
 		otel.SetMeterProvider(metricProvider)
 		metricsHandler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+		gatherer = registry
 		shutdowns = append(shutdowns, metricProvider.Shutdown)
 	}
 
@@ -98,6 +104,8 @@ func Init(ctx context.Context, cfg config.TelemetryConfig) (*Providers, error) {
 
 	return &Providers{
 		MetricsHandler: metricsHandler,
+		gatherer:       gatherer,
+		errors:         errs,
 		shutdown: func(ctx context.Context) error {
 			var joined error
 			for _, shutdown := range shutdowns {
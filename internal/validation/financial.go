@@ -0,0 +1,119 @@
+package validation
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/RoGogDBD/wb/internal/models"
+)
+
+// Mode — режим правила согласованности сумм.
+type Mode string
+
+const (
+	// ModeStrict — нарушение делает заказ невалидным, сообщение уходит в DLQ.
+	ModeStrict Mode = "strict"
+	// ModeWarn — заказ сохраняется, нарушение возвращается как предупреждение.
+	ModeWarn Mode = "warn"
+)
+
+// Правила согласованности сумм заказа.
+const (
+	// RuleGoodsTotal — payment.goods_total равен сумме items[].total_price.
+	RuleGoodsTotal = "goods_total"
+	// RuleAmount — payment.amount равен goods_total + delivery_cost + custom_fee.
+	RuleAmount = "amount"
+	// RuleItemTotal — total_price товара равен price за вычетом скидки sale в процентах
+	// с точностью до округления.
+	RuleItemTotal = "item_total"
+)
+
+// ruleNames — все правила согласованности сумм.
+var ruleNames = []string{RuleGoodsTotal, RuleAmount, RuleItemTotal}
+
+// Rules задает режимы правил согласованности сумм. Правило без режима строгое.
+type Rules map[string]Mode
+
+// Check проверяет, что все правила и режимы известны.
+func (r Rules) Check() error {
+	for rule, mode := range r {
+		if !slices.Contains(ruleNames, rule) {
+			return fmt.Errorf("unknown validation rule %q (known: %s)", rule, strings.Join(ruleNames, ", "))
+		}
+		if mode != ModeStrict && mode != ModeWarn {
+			return fmt.Errorf("unknown mode %q for validation rule %q", mode, rule)
+		}
+	}
+	return nil
+}
+
+// Mode возвращает режим правила.
+func (r Rules) Mode(rule string) Mode {
+	if mode, ok := r[rule]; ok {
+		return mode
+	}
+	return ModeStrict
+}
+
+// Violation — нарушение правила валидации заказа.
+type Violation struct {
+	// Field — путь к полю в JSON заказа, например items[2].nm_id.
+	Field string `json:"field"`
+	// Rule — тег правила валидатора (required, phone_ru) или правило согласованности сумм.
+	Rule string `json:"rule"`
+	// Param — параметр правила; для правил согласованности сумм — ожидаемое значение.
+	Param string `json:"param,omitempty"`
+	// Value — значение поля; персональные данные маскируются.
+	Value   any    `json:"value,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (v Violation) String() string {
+	if v.Message != "" {
+		return fmt.Sprintf("%s: %s (rule %s)", v.Field, v.Message, v.Rule)
+	}
+	return fmt.Sprintf("%s: failed on %s", v.Field, v.Rule)
+}
+
+// CheckFinancials проверяет согласованность сумм заказа по всем правилам.
+func CheckFinancials(o *models.Order) []Violation {
+	var violations []Violation
+
+	goods := 0
+	for i, item := range o.Items {
+		goods += item.TotalPrice
+		// total_price должен лежать между округленными вниз и вверх price * (100 - sale) / 100
+		if diff := item.TotalPrice*100 - item.Price*(100-item.Sale); diff <= -100 || diff >= 100 {
+			violations = append(violations, Violation{
+				Rule:    RuleItemTotal,
+				Field:   fmt.Sprintf("items[%d].total_price", i),
+				Param:   strconv.Itoa(item.Price * (100 - item.Sale) / 100),
+				Value:   item.TotalPrice,
+				Message: fmt.Sprintf("total_price %d does not match price %d with sale %d%%", item.TotalPrice, item.Price, item.Sale),
+			})
+		}
+	}
+
+	p := o.Payment
+	if p.GoodsTotal != goods {
+		violations = append(violations, Violation{
+			Rule:    RuleGoodsTotal,
+			Field:   "payment.goods_total",
+			Param:   strconv.Itoa(goods),
+			Value:   p.GoodsTotal,
+			Message: fmt.Sprintf("goods_total %d differs from items total %d", p.GoodsTotal, goods),
+		})
+	}
+	if want := p.GoodsTotal + p.DeliveryCost + p.CustomFee; p.Amount != want {
+		violations = append(violations, Violation{
+			Rule:    RuleAmount,
+			Field:   "payment.amount",
+			Param:   strconv.Itoa(want),
+			Value:   p.Amount,
+			Message: fmt.Sprintf("amount %d differs from goods_total + delivery_cost + custom_fee = %d", p.Amount, want),
+		})
+	}
+	return violations
+}
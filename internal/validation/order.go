@@ -0,0 +1,69 @@
+package validation
+
+import (
+	"errors"
+
+	"github.com/RoGogDBD/wb/internal/models"
+	"github.com/go-playground/validator/v10"
+)
+
+// OrderValidator проверяет заказы: теги полей, пользовательские правила и согласованность сумм.
+// Нарушения строгих правил сумм возвращаются как ошибка валидации, нарушения правил
+// в режиме warn — как предупреждения.
+type OrderValidator struct {
+	validate *validator.Validate
+	rules    Rules
+}
+
+// NewOrderValidator создает валидатор заказов с заданными режимами правил.
+func NewOrderValidator(rules Rules) (*OrderValidator, error) {
+	if err := rules.Check(); err != nil {
+		return nil, err
+	}
+	v, err := New()
+	if err != nil {
+		return nil, err
+	}
+	ov := &OrderValidator{validate: v, rules: rules}
+	v.RegisterStructValidation(ov.validateFinancials, models.Order{})
+	return ov, nil
+}
+
+// MustNewOrderValidator возвращает валидатор заказов или паникует при ошибке инициализации.
+func MustNewOrderValidator(rules Rules) *OrderValidator {
+	ov, err := NewOrderValidator(rules)
+	if err != nil {
+		panic(err)
+	}
+	return ov
+}
+
+// Validate проверяет заказ и возвращает нарушения правил в режиме warn.
+// Если заказ невалиден, возвращается ошибка *Report со списком нарушений.
+func (ov *OrderValidator) Validate(o *models.Order) ([]Violation, error) {
+	if err := ov.validate.Struct(o); err != nil {
+		var fieldErrs validator.ValidationErrors
+		if errors.As(err, &fieldErrs) {
+			return nil, newReport(fieldErrs)
+		}
+		return nil, err
+	}
+	var warnings []Violation
+	for _, v := range CheckFinancials(o) {
+		if ov.rules.Mode(v.Rule) == ModeWarn {
+			warnings = append(warnings, v)
+		}
+	}
+	return warnings, nil
+}
+
+// validateFinancials сообщает валидатору о нарушениях строгих правил согласованности сумм.
+func (ov *OrderValidator) validateFinancials(sl validator.StructLevel) {
+	o := sl.Current().Interface().(models.Order)
+	for _, v := range CheckFinancials(&o) {
+		if ov.rules.Mode(v.Rule) != ModeStrict {
+			continue
+		}
+		sl.ReportError(v.Value, v.Field, v.Field, v.Rule, v.Param)
+	}
+}
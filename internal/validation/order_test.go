@@ -0,0 +1,203 @@
+package validation
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/RoGogDBD/wb/internal/models"
+)
+
+func TestOrderValidatorFinancialRules(t *testing.T) {
+	tests := []struct {
+		name         string
+		rules        Rules
+		mutate       func(o *models.Order)
+		wantErr      string
+		wantWarnings []string
+	}{
+		{
+			name:   "consistent order",
+			mutate: func(*models.Order) {},
+		},
+		{
+			name: "rounded item total",
+			mutate: func(o *models.Order) {
+				// 1253 * 0.85 = 1065.05
+				o.Items[0].Price, o.Items[0].Sale, o.Items[0].TotalPrice = 1253, 15, 1065
+				o.Payment.GoodsTotal, o.Payment.Amount = 1065, 2565
+			},
+		},
+		{
+			name:    "goods total differs from items",
+			mutate:  func(o *models.Order) { o.Payment.GoodsTotal++; o.Payment.Amount++ },
+			wantErr: "payment.goods_total: goods_total",
+		},
+		{
+			name:    "amount differs from components",
+			mutate:  func(o *models.Order) { o.Payment.Amount-- },
+			wantErr: "payment.amount: amount",
+		},
+		{
+			name:    "item total ignores sale",
+			mutate:  func(o *models.Order) { o.Items[0].Sale = 50 },
+			wantErr: "items[0].total_price: item_total",
+		},
+		{
+			name:         "warn mode keeps order valid",
+			rules:        Rules{RuleAmount: ModeWarn},
+			mutate:       func(o *models.Order) { o.Payment.Amount-- },
+			wantWarnings: []string{RuleAmount},
+		},
+		{
+			name:    "only warn rules become warnings",
+			rules:   Rules{RuleAmount: ModeWarn},
+			mutate:  func(o *models.Order) { o.Payment.GoodsTotal++ },
+			wantErr: "payment.goods_total: goods_total",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewOrderValidator(tt.rules)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			o := validOrder()
+			tt.mutate(o)
+
+			warnings, err := v.Validate(o)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error with %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []string
+			for _, w := range warnings {
+				got = append(got, w.Rule)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.wantWarnings, ",") {
+				t.Fatalf("expected warnings %v, got %v", tt.wantWarnings, warnings)
+			}
+		})
+	}
+}
+
+func TestOrderValidatorReport(t *testing.T) {
+	o := validOrder()
+	o.Delivery.Phone = "12345678"
+	o.Items = append(o.Items, o.Items[0], o.Items[0])
+	o.Items[2].NmID = 0
+	o.Payment.GoodsTotal, o.Payment.Amount = 951, 2451
+
+	_, err := MustNewOrderValidator(nil).Validate(o)
+	var report *Report
+	if !errors.As(err, &report) {
+		t.Fatalf("expected *Report, got %v", err)
+	}
+
+	want := []Violation{
+		{Field: "delivery.phone", Rule: "phone_ru", Value: "******78"},
+		{Field: "items[2].nm_id", Rule: "gt", Param: "0", Value: 0},
+	}
+	if !reflect.DeepEqual(report.Violations, want) {
+		t.Fatalf("unexpected violations:\n got: %+v\nwant: %+v", report.Violations, want)
+	}
+	if got := report.Rules(); !reflect.DeepEqual(got, []string{"phone_ru", "gt"}) {
+		t.Fatalf("unexpected rules: %v", got)
+	}
+}
+
+func TestMaskValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		field string
+		value any
+		want  any
+	}{
+		{name: "not pii", field: "track_number", value: "WBILMTESTTRACK", want: "WBILMTESTTRACK"},
+		{name: "empty", field: "delivery.name", value: "", want: ""},
+		{name: "short", field: "delivery.zip", value: "1234", want: "****"},
+		{name: "ascii", field: "delivery.phone", value: "12345678", want: "******78"},
+		{name: "cyrillic", field: "delivery.name", value: "Иван Петров", want: "*********ов"},
+		{name: "short cyrillic", field: "delivery.name", value: "Иван", want: "****"},
+		{name: "emoji", field: "delivery.address", value: "дом 🏠", want: "*** 🏠"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := maskValue(tt.field, tt.value)
+			if got != tt.want {
+				t.Fatalf("expected %q, got %q", tt.want, got)
+			}
+			if s, ok := got.(string); ok && !utf8.ValidString(s) {
+				t.Fatalf("masked value is not valid UTF-8: %q", s)
+			}
+		})
+	}
+}
+
+func TestRulesCheck(t *testing.T) {
+	if err := (Rules{RuleGoodsTotal: ModeWarn, RuleItemTotal: ModeStrict}).Check(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := (Rules{"discount": ModeWarn}).Check(); err == nil {
+		t.Fatalf("expected error for unknown rule")
+	}
+	if err := (Rules{RuleAmount: "lenient"}).Check(); err == nil {
+		t.Fatalf("expected error for unknown mode")
+	}
+}
+
+func validOrder() *models.Order {
+	return &models.Order{
+		OrderUID:    "b563feb7-b2b8-4b6a-9f5d-1a2b3c4d5e6f",
+		TrackNumber: "WBILMTESTTRACK",
+		Entry:       "WBIL",
+		Delivery: models.Delivery{
+			Name:    "Test Testov",
+			Phone:   "+79720000000",
+			Zip:     "263980",
+			City:    "Kiryat Mozkin",
+			Address: "Ploshad Mira 15",
+			Region:  "Kraiot",
+			Email:   "test@gmail.com",
+		},
+		Payment: models.Payment{
+			Transaction:  "b563feb7b2b84b6test",
+			Currency:     "USD",
+			Provider:     "wbpay",
+			Amount:       1817,
+			PaymentDt:    1637907727,
+			Bank:         "alpha",
+			DeliveryCost: 1500,
+			GoodsTotal:   317,
+		},
+		Items: []models.Item{{
+			ChrtID:      9934930,
+			TrackNumber: "WBILMTESTTRACK",
+			Price:       453,
+			Rid:         "ab4219087a764ae0btest",
+			Name:        "Mascaras",
+			Sale:        30,
+			Size:        "0",
+			TotalPrice:  317,
+			NmID:        2389212,
+			Brand:       "Vivienne Sabo",
+			Status:      202,
+		}},
+		Locale:          "en",
+		CustomerID:      "test",
+		DeliveryService: "meest",
+		ShardKey:        "9",
+		SmID:            99,
+		DateCreated:     time.Date(2021, 11, 26, 6, 22, 19, 0, time.UTC),
+		OofShard:        "1",
+	}
+}
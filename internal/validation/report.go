@@ -0,0 +1,78 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// piiFields — поля заказа с персональными данными; их значения в отчете маскируются.
+var piiFields = map[string]bool{
+	"delivery.name":    true,
+	"delivery.phone":   true,
+	"delivery.zip":     true,
+	"delivery.address": true,
+	"delivery.email":   true,
+}
+
+// Report — отчет о невалидном заказе. Используется как ошибка валидации и сериализуется в JSON,
+// поэтому его можно передать в заголовке DLQ или в ответе API.
+type Report struct {
+	Violations []Violation `json:"violations"`
+}
+
+// Error перечисляет нарушенные правила по полям.
+func (r *Report) Error() string {
+	parts := make([]string, len(r.Violations))
+	for i, v := range r.Violations {
+		parts[i] = v.Field + ": " + v.Rule
+	}
+	return "validation failed: " + strings.Join(parts, ", ")
+}
+
+// Rules возвращает нарушенные правила без повторов в порядке появления.
+func (r *Report) Rules() []string {
+	var rules []string
+	seen := make(map[string]bool)
+	for _, v := range r.Violations {
+		if !seen[v.Rule] {
+			seen[v.Rule] = true
+			rules = append(rules, v.Rule)
+		}
+	}
+	return rules
+}
+
+// newReport строит отчет из ошибок валидатора.
+func newReport(errs validator.ValidationErrors) *Report {
+	r := &Report{Violations: make([]Violation, len(errs))}
+	for i, fe := range errs {
+		// пространство имен начинается с имени типа: Order.items[2].nm_id
+		_, field, _ := strings.Cut(fe.Namespace(), ".")
+		r.Violations[i] = Violation{
+			Field: field,
+			Rule:  fe.Tag(),
+			Param: fe.Param(),
+			Value: maskValue(field, fe.Value()),
+		}
+	}
+	return r
+}
+
+// maskValue скрывает персональные данные, оставляя последние символы для сверки.
+// Значение маскируется посимвольно, чтобы не разрезать многобайтовые символы.
+func maskValue(field string, value any) any {
+	if !piiFields[field] {
+		return value
+	}
+	s := []rune(fmt.Sprint(value))
+	if len(s) == 0 {
+		return ""
+	}
+	keep := 0
+	if len(s) > 4 {
+		keep = 2
+	}
+	return strings.Repeat("*", len(s)-keep) + string(s[len(s)-keep:])
+}
@@ -3,7 +3,9 @@ package validation
 
 import (
 	"fmt"
+	"reflect"
 	"regexp"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 )
@@ -16,6 +18,14 @@ var (
 // New создает валидатор с пользовательскими правилами.
 func New() (*validator.Validate, error) {
 	v := validator.New()
+	// в ошибках используются имена полей из JSON, как их видит отправитель заказа
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
 	if err := v.RegisterValidation("phone_ru", func(fl validator.FieldLevel) bool {
 		return phoneRU.MatchString(fl.Field().String())
 	}); err != nil {
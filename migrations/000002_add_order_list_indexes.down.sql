@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS items_order_uid_idx;
+DROP INDEX IF EXISTS payments_currency_idx;
+DROP INDEX IF EXISTS orders_delivery_service_date_created_idx;
+DROP INDEX IF EXISTS orders_track_number_idx;
+DROP INDEX IF EXISTS orders_customer_id_date_created_idx;
+DROP INDEX IF EXISTS orders_date_created_uid_idx;
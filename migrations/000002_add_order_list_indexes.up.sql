@@ -0,0 +1,17 @@
+CREATE INDEX IF NOT EXISTS orders_date_created_uid_idx
+    ON orders (date_created DESC, order_uid DESC);
+
+CREATE INDEX IF NOT EXISTS orders_customer_id_date_created_idx
+    ON orders (customer_id, date_created DESC, order_uid DESC);
+
+CREATE INDEX IF NOT EXISTS orders_track_number_idx
+    ON orders (track_number);
+
+CREATE INDEX IF NOT EXISTS orders_delivery_service_date_created_idx
+    ON orders (delivery_service, date_created DESC, order_uid DESC);
+
+CREATE INDEX IF NOT EXISTS payments_currency_idx
+    ON payments (currency);
+
+CREATE INDEX IF NOT EXISTS items_order_uid_idx
+    ON items (order_uid);
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS order_versions (
+    order_uid UUID NOT NULL,
+    version INTEGER NOT NULL,
+    payload JSONB NOT NULL,
+    checksum TEXT NOT NULL,
+    source_topic TEXT,
+    source_partition INTEGER,
+    source_offset BIGINT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (order_uid, version)
+);
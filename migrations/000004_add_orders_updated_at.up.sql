@@ -0,0 +1,6 @@
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP;
+
+UPDATE orders SET updated_at = COALESCE(date_created, now()) WHERE updated_at IS NULL;
+
+ALTER TABLE orders ALTER COLUMN updated_at SET DEFAULT now();
+ALTER TABLE orders ALTER COLUMN updated_at SET NOT NULL;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS processed_messages (
+    message_key TEXT PRIMARY KEY,
+    order_uid UUID NOT NULL,
+    processed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS idx_processed_messages_processed_at ON processed_messages (processed_at);
@@ -0,0 +1 @@
+ALTER TABLE order_versions ADD COLUMN IF NOT EXISTS source_idempotency_key TEXT;
@@ -4,14 +4,22 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
-	"log"
+	"log/slog"
+	"os"
 	"time"
 
 	"github.com/RoGogDBD/wb/internal/config"
+	wbkafka "github.com/RoGogDBD/wb/internal/kafka"
+	"github.com/RoGogDBD/wb/internal/logging"
 	"github.com/RoGogDBD/wb/internal/models"
+	"github.com/RoGogDBD/wb/internal/telemetry"
 	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func main() {
@@ -20,11 +28,28 @@ func main() {
 
 	cfg, err := config.LoadConfig()
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		fatal("failed to load config", err)
+	}
+	if err := logging.Setup(cfg.Logging.Format, cfg.Logging.Level); err != nil {
+		fatal("failed to set up logging", err)
 	}
 	if len(cfg.Kafka.Brokers) == 0 || cfg.Kafka.Topic == "" {
-		log.Fatal("Kafka brokers or topic not configured")
+		fatal("invalid config", errors.New("kafka brokers or topic not configured"))
+	}
+
+	// спан продюсера передается консьюмеру через заголовки сообщения
+	providers, err := telemetry.Init(context.Background(), cfg.Telemetry)
+	if err != nil {
+		fatal("failed to init telemetry", err)
 	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := providers.Shutdown(ctx); err != nil {
+			slog.Error("telemetry shutdown error", logging.Err(err))
+		}
+	}()
+	tracer := otel.Tracer("github.com/RoGogDBD/wb/scripts")
 
 	w := &kafka.Writer{
 		Addr:     kafka.TCP(cfg.Kafka.Brokers...),
@@ -33,7 +58,7 @@ func main() {
 	}
 	defer func() {
 		if err := w.Close(); err != nil {
-			log.Printf("kafka writer close error: %v", err)
+			slog.Warn("kafka writer close error", logging.Err(err))
 		}
 	}()
 
@@ -65,11 +90,11 @@ func main() {
 				RequestID:    "",
 				Currency:     "USD",
 				Provider:     "wbpay",
-				Amount:       1817,
+				Amount:       2882,
 				PaymentDt:    time.Now().Unix(),
 				Bank:         "alpha",
 				DeliveryCost: 1500,
-				GoodsTotal:   317,
+				GoodsTotal:   1382,
 				CustomFee:    0,
 			},
 			Items: []models.Item{
@@ -104,19 +129,34 @@ func main() {
 
 		orderJSON, err := json.Marshal(order)
 		if err != nil {
-			log.Fatalf("Failed to marshal order: %v", err)
+			fatal("failed to marshal order", err)
 		}
 
-		err = w.WriteMessages(context.Background(),
-			kafka.Message{
-				Key:   []byte(orderUID),
-				Value: orderJSON,
-			},
-		)
+		ctx, span := tracer.Start(context.Background(), cfg.Kafka.Topic+" publish",
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(
+				attribute.String("messaging.system", "kafka"),
+				attribute.String("messaging.destination.name", cfg.Kafka.Topic),
+				attribute.String("order_uid", orderUID),
+			))
+		msg := kafka.Message{
+			Key:   []byte(orderUID),
+			Value: orderJSON,
+		}
+		otel.GetTextMapPropagator().Inject(ctx, (*wbkafka.HeaderCarrier)(&msg.Headers))
+
+		err = w.WriteMessages(ctx, msg)
+		span.End()
 		if err != nil {
-			log.Fatalf("Failed to send message: %v", err)
+			fatal("failed to send message", err)
 		}
 
-		log.Printf("Message %d sent successfully with order_uid: %s", i+1, orderUID)
+		slog.InfoContext(ctx, "message sent", "n", i+1, "order_uid", orderUID)
 	}
 }
+
+// fatal пишет ошибку в лог и завершает процесс с кодом 1.
+func fatal(msg string, err error) {
+	slog.Error(msg, logging.Err(err))
+	os.Exit(1)
+}